@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/app/service"
+	"github.com/aldge/cine_stream/logger"
+)
+
+// AdPodSave 保存广告组和广告切片（服务端插入广告使用）
+func AdPodSave(ctx *gin.Context) error {
+	var req entity.AdPodSaveRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		logger.WithContext(ctx).Warnf("[AdPodSave] 参数绑定失败: %v", err)
+		return RespJsonError(ctx, 1001, "参数绑定失败")
+	}
+
+	pod, err := service.NewAdPod(ctx).Save(&req)
+	if errors.Is(err, service.ErrAdPodNotFound) {
+		logger.WithContext(ctx).Warnf("[AdPodSave] %v, ad_pod_id: %d", err, req.AdPodID)
+		return RespJsonError(ctx, 1004, err.Error())
+	}
+	if err != nil {
+		logger.WithContext(ctx).Errorf("[AdPodSave] 保存广告组失败: %v", err)
+		return RespJsonError(ctx, 1002, err.Error())
+	}
+	return RespJsonSuccess(ctx, map[string]interface{}{
+		"ad_pod_id": pod.AdPodID,
+	})
+}
+
+// AdPodList 获取广告组列表
+func AdPodList(ctx *gin.Context) error {
+	podList, err := service.NewAdPod(ctx).GetList()
+	if err != nil {
+		logger.WithContext(ctx).Errorf("[AdPodList] 查询广告组列表失败: %v", err)
+		return RespJsonError(ctx, 1002, "查询广告组列表失败")
+	}
+	return RespJsonSuccess(ctx, map[string]interface{}{
+		"ad_pod_list": podList,
+	})
+}
@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/app/service"
+	"github.com/aldge/cine_stream/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// CDNList 获取所有 CDN 当前生效的状态
+func CDNList(ctx *gin.Context) error {
+	return RespJsonSuccess(ctx, map[string]interface{}{
+		"cdn_list": service.GetCDNStatusList(ctx),
+	})
+}
+
+// CDNStatus 运行时调整 CDN 的健康状态和权重
+func CDNStatus(ctx *gin.Context) error {
+	var req entity.CDNStatusRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		logger.WithContext(ctx).Warnf("[CDNStatus] 参数绑定失败: %v", err)
+		return RespJsonError(ctx, 1001, "参数绑定失败")
+	}
+	if err := service.SetCDNStatus(ctx, req.Name, req.Status, req.Weight); err != nil {
+		logger.WithContext(ctx).Warnf("[CDNStatus] 调整CDN状态失败: %v", err)
+		return RespJsonError(ctx, 1002, err.Error())
+	}
+	return RespJsonSuccess(ctx, map[string]interface{}{
+		"cdn_list": service.GetCDNStatusList(ctx),
+	})
+}
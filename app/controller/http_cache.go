@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aldge/cine_stream/app/service"
+	"github.com/aldge/cine_stream/config"
+	"github.com/aldge/cine_stream/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// loadPlayRevision 计算播放接口响应内容的版本，失败时返回 nil，不影响播放（只是不处理条件请求）
+func loadPlayRevision(ctx *gin.Context, funcName, videoID string, sources service.PlayRevisionSource, variant string) *service.PlayRevision {
+	revision, err := service.NewPlay(ctx).GetPlayRevision(ctx, videoID, sources, variant)
+	if err != nil {
+		logger.WithContext(ctx).Warnf("[%s] 计算内容版本失败: %v, video_id: %s", funcName, err, videoID)
+		return nil
+	}
+	return revision
+}
+
+// trialRevisionVariant 试看影响响应内容，计算版本时区分试看范围
+func trialRevisionVariant(trial *service.PlayTrial) string {
+	if trial == nil {
+		return ""
+	}
+	return fmt.Sprintf("trial:%d:%t:%g", trial.VodID, trial.Episode, trial.Duration)
+}
+
+// respPlayNotModified 客户端缓存的内容仍然有效时返回 304，返回 true 表示已响应
+func respPlayNotModified(ctx *gin.Context, endpoint string, revision *service.PlayRevision) bool {
+	if revision == nil || config.GetAppConf().GetHTTPCachePolicy(endpoint).NoStore {
+		return false
+	}
+	if !requestNotModified(ctx.Request, revision) {
+		return false
+	}
+	setPlayCacheHeaders(ctx, endpoint, revision)
+	ctx.Status(http.StatusNotModified)
+	return true
+}
+
+// setPlayCacheHeaders 按接口的缓存策略输出 Cache-Control、ETag 和 Last-Modified
+func setPlayCacheHeaders(ctx *gin.Context, endpoint string, revision *service.PlayRevision) {
+	policy := config.GetAppConf().GetHTTPCachePolicy(endpoint)
+	if policy.NoStore {
+		ctx.Header("Cache-Control", "private, no-store")
+		return
+	}
+	directives := []string{"private"}
+	if policy.MaxAge > 0 {
+		directives = append(directives, "max-age="+strconv.Itoa(policy.MaxAge))
+	} else {
+		directives = append(directives, "no-cache")
+	}
+	if policy.StaleWhileRevalidate > 0 {
+		directives = append(directives, "stale-while-revalidate="+strconv.Itoa(policy.StaleWhileRevalidate))
+	}
+	ctx.Header("Cache-Control", strings.Join(directives, ", "))
+	if revision != nil {
+		ctx.Header("ETag", revision.ETag)
+		ctx.Header("Last-Modified", revision.LastModified.Format(http.TimeFormat))
+	}
+}
+
+// requestNotModified 判断条件请求：有 If-None-Match 时只比较 ETag（弱比较），否则比较 If-Modified-Since
+func requestNotModified(req *http.Request, revision *service.PlayRevision) bool {
+	if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		for _, etag := range strings.Split(ifNoneMatch, ",") {
+			etag = strings.TrimSpace(etag)
+			if etag == "*" || strings.TrimPrefix(etag, "W/") == revision.ETag {
+				return true
+			}
+		}
+		return false
+	}
+	if ifModifiedSince := req.Header.Get("If-Modified-Since"); ifModifiedSince != "" {
+		modifiedSince, err := http.ParseTime(ifModifiedSince)
+		return err == nil && !revision.LastModified.After(modifiedSince)
+	}
+	return false
+}
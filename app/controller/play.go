@@ -3,23 +3,30 @@ package controller
 import (
 	"encoding/base64"
 	"encoding/hex"
-	"fmt"
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/aldge/cine_stream/app/entity"
 	"github.com/aldge/cine_stream/app/service"
+	"github.com/aldge/cine_stream/config"
 	"github.com/aldge/cine_stream/logger"
 	"github.com/aldge/cine_stream/utils"
 	"github.com/aldge/gopkg/app"
 	"github.com/gin-gonic/gin"
 )
 
+// v1 协议固定的密钥和 nonce，只在开启 C3u8.legacy 的 app 中使用
 const (
 	cinePlayerKey    = "0123456789abcdef" // 16字节
 	cinePlayerNonce  = "0123456789ab"     // 12字节
 	cinePlayerNonce2 = "0123456789ac"     // 12字节
 )
 
+// errC3u8LegacyDisabled 播放器没有上报公钥，且 app 没有开启 v1 协议
+var errC3u8LegacyDisabled = errors.New("不支持的 c3u8 协议版本，请升级播放器")
+
 // Play 获取播放的 m3u8 文件
 func Play(ctx *gin.Context) error {
 	videoID := ctx.Param("video_id")
@@ -28,25 +35,38 @@ func Play(ctx *gin.Context) error {
 		return RespJsonError(ctx, 1001, "视频ID不能为空")
 	}
 
-	// 检查播放权限
-	if !service.CheckPlayRights(ctx, videoID) {
-		logger.WithContext(ctx).Warnf("[Play] 用户无播放权限, video_id: %s", videoID)
-		ctx.JSON(http.StatusForbidden, &entity.Response{
-			Code:    403,
-			Message: "无播放权限",
-			Data:    make(map[string]interface{}),
-		})
+	// 检查播放权限，没有权限时尝试试看
+	trial, ok := checkPlayRightsOrTrial(ctx, "Play", videoID)
+	if !ok {
+		return nil
+	}
+	// 正常播放时登记当前设备的播放会话，试看不限制设备数
+	if trial == nil && !checkPlaySession(ctx, "Play", entity.ContextValueLoginUserID(ctx)) {
 		return nil
 	}
 
-	appName := app.GetAppName(ctx)
+	// 内容没有变化时返回 304
+	revision := loadPlayRevision(ctx, "Play", videoID, service.PlayRevisionSegments|service.PlayRevisionAudios|service.PlayRevisionSubtitles, trialRevisionVariant(trial))
+	if respPlayNotModified(ctx, config.HTTPCacheMaster, revision) {
+		return nil
+	}
 
-	// 生成主 m3u8
-	m3u8Content := `#EXTM3U
-#EXT-X-STREAM-INF:PROGRAM-ID=1,BANDWIDTH=4096000,RESOLUTION=1920x1080
-/play/%s/index.m3u8?app=%s`
+	// 生成主 m3u8（每个清晰度一路）
+	playService := service.NewPlay(ctx)
+	var m3u8Content string
+	var err error
+	if trial != nil {
+		m3u8Content, err = playService.GenerateTrialMasterM3U8Content(ctx, videoID, trial)
+	} else {
+		m3u8Content, err = playService.GenerateMasterM3U8Content(ctx, videoID)
+	}
+	if err != nil {
+		logger.WithContext(ctx).Errorf("[Play] 生成主m3u8内容失败: %v", err)
+		return RespJsonError(ctx, 1002, "生成主m3u8内容失败")
+	}
+	setPlayCacheHeaders(ctx, config.HTTPCacheMaster, revision)
 	ctx.Header("Content-Type", "application/vnd.apple.mpegurl")
-	ctx.String(http.StatusOK, fmt.Sprintf(m3u8Content, videoID, appName))
+	ctx.String(http.StatusOK, m3u8Content)
 
 	return nil
 }
@@ -60,41 +80,242 @@ func PlayHlsIndexM3u8(ctx *gin.Context) error {
 		return RespJsonError(ctx, 1001, "视频ID不能为空")
 	}
 
-	// 检查播放权限
-	if !service.CheckPlayRights(ctx, videoID) {
-		logger.WithContext(ctx).Warnf("[PlayHlsIndexM3u8] 用户无播放权限, video_id: %s", videoID)
-		ctx.JSON(http.StatusForbidden, &entity.Response{
-			Code:    403,
-			Message: "无播放权限",
-			Data:    make(map[string]interface{}),
-		})
+	// 检查播放权限，没有权限时尝试试看
+	trial, ok := checkPlayRightsOrTrial(ctx, "PlayHlsIndexM3u8", videoID)
+	if !ok {
+		return nil
+	}
+	// 正常播放时登记当前设备的播放会话，试看不限制设备数
+	if trial == nil && !checkPlaySession(ctx, "PlayHlsIndexM3u8", entity.ContextValueLoginUserID(ctx)) {
+		return nil
+	}
+
+	// 内容没有变化时返回 304
+	revision := loadPlayRevision(ctx, "PlayHlsIndexM3u8", videoID, mediaRevisionSources, trialRevisionVariant(trial))
+	if respPlayNotModified(ctx, config.HTTPCacheMedia, revision) {
 		return nil
 	}
 
 	// 获取 app 参数，确保中间件验证通过（虽然 service 层也会获取，但这里显式获取以确保验证）
 	_ = app.GetAppName(ctx)
 
-	// 获取所有的 ts 分片
-	tsService := service.NewVideoTS(ctx)
-	tsList, err := tsService.GetList(videoID, "")
+	// 生成清晰度对应的媒体 m3u8
+	m3u8Content, err := generatePlayMediaM3U8(ctx, videoID, trial)
+	if errors.Is(err, service.ErrDefinitionNotFound) {
+		logger.WithContext(ctx).Warnf("[PlayHlsIndexM3u8] %v, video_id: %s", err, videoID)
+		return respDefinitionNotFound(ctx, err)
+	}
+	if errors.Is(err, service.ErrTrialUnavailable) {
+		logger.WithContext(ctx).Warnf("[PlayHlsIndexM3u8] %v, video_id: %s", err, videoID)
+		return respPlayForbidden(ctx)
+	}
 	if err != nil {
-		logger.WithContext(ctx).Errorf("[PlayHlsIndexM3u8] 查询TS切片列表失败: %v", err)
-		return RespJsonError(ctx, 1002, "查询TS切片列表失败")
+		logger.WithContext(ctx).Errorf("[PlayHlsIndexM3u8] 生成m3u8内容失败: %v", err)
+		return RespJsonError(ctx, 1003, "生成m3u8内容失败")
+	}
+
+	// 返回给前端 m3u8 文件
+	setPlayCacheHeaders(ctx, config.HTTPCacheMedia, revision)
+	ctx.Header("Content-Type", "application/vnd.apple.mpegurl")
+	ctx.String(http.StatusOK, m3u8Content)
+	return nil
+}
+
+// PlayHlsIFrameM3u8 获取清晰度的 I-frame m3u8 文件（快进快退预览）
+func PlayHlsIFrameM3u8(ctx *gin.Context) error {
+	videoID := ctx.Param("video_id")
+	if videoID == "" {
+		logger.WithContext(ctx).Warnf("[PlayHlsIFrameM3u8] 视频ID不能为空")
+		return RespJsonError(ctx, 1001, "视频ID不能为空")
+	}
+
+	// 检查播放权限
+	if !service.CheckPlayRights(ctx, videoID) {
+		logger.WithContext(ctx).Warnf("[PlayHlsIFrameM3u8] 用户无播放权限, video_id: %s", videoID)
+		return respPlayForbidden(ctx)
+	}
+	if !checkPlaySession(ctx, "PlayHlsIFrameM3u8", entity.ContextValueLoginUserID(ctx)) {
+		return nil
+	}
+
+	// 内容没有变化时返回 304
+	revision := loadPlayRevision(ctx, "PlayHlsIFrameM3u8", videoID, service.PlayRevisionSegments|service.PlayRevisionKeys, "")
+	if respPlayNotModified(ctx, config.HTTPCacheIFrame, revision) {
+		return nil
 	}
 
 	playService := service.NewPlay(ctx)
-	m3u8Content, err := playService.GenerateM3U8Content(ctx, videoID, tsList)
+	m3u8Content, err := playService.GenerateIFrameM3U8Content(ctx, videoID, getPlayDefinition(ctx))
+	if errors.Is(err, service.ErrDefinitionNotFound) || errors.Is(err, service.ErrIFrameNotFound) ||
+		errors.Is(err, service.ErrIFrameEncrypted) {
+		logger.WithContext(ctx).Warnf("[PlayHlsIFrameM3u8] %v, video_id: %s", err, videoID)
+		return respDefinitionNotFound(ctx, err)
+	}
 	if err != nil {
-		logger.WithContext(ctx).Errorf("[PlayHlsIndexM3u8] 生成m3u8内容失败: %v", err)
+		logger.WithContext(ctx).Errorf("[PlayHlsIFrameM3u8] 生成I-frame m3u8内容失败: %v", err)
 		return RespJsonError(ctx, 1003, "生成m3u8内容失败")
 	}
 
-	// 返回给前端 m3u8 文件
+	setPlayCacheHeaders(ctx, config.HTTPCacheIFrame, revision)
 	ctx.Header("Content-Type", "application/vnd.apple.mpegurl")
 	ctx.String(http.StatusOK, m3u8Content)
 	return nil
 }
 
+// PlayDashManifest 获取播放的 DASH mpd 文件
+func PlayDashManifest(ctx *gin.Context) error {
+	videoID := ctx.Param("video_id")
+	if videoID == "" {
+		logger.WithContext(ctx).Warnf("[PlayDashManifest] 视频ID不能为空")
+		return RespJsonError(ctx, 1001, "视频ID不能为空")
+	}
+
+	// 检查播放权限；DASH 不提供试看，能试看的用户返回单独的错误码，由播放器改用 HLS 试看
+	if !service.CheckPlayRights(ctx, videoID) {
+		if _, err := service.ResolvePlayTrial(ctx, videoID, GetParamInt64(ctx, "vod_id")); err == nil {
+			logger.WithContext(ctx).Warnf("[PlayDashManifest] DASH 不提供试看, video_id: %s", videoID)
+			ctx.JSON(http.StatusForbidden, &entity.Response{
+				Code:    1009,
+				Message: "DASH 不提供试看，请使用 HLS 试看",
+				Data:    make(map[string]interface{}),
+			})
+			return nil
+		}
+		logger.WithContext(ctx).Warnf("[PlayDashManifest] 用户无播放权限, video_id: %s", videoID)
+		return respPlayForbidden(ctx)
+	}
+	if !checkPlaySession(ctx, "PlayDashManifest", entity.ContextValueLoginUserID(ctx)) {
+		return nil
+	}
+
+	// 内容没有变化时返回 304
+	revision := loadPlayRevision(ctx, "PlayDashManifest", videoID, mediaRevisionSources|service.PlayRevisionAudios, "")
+	if respPlayNotModified(ctx, config.HTTPCacheDash, revision) {
+		return nil
+	}
+
+	// 生成 mpd（每个清晰度一个 Representation）
+	playService := service.NewPlay(ctx)
+	mpdContent, err := playService.GenerateDASHManifest(ctx, videoID)
+	if errors.Is(err, service.ErrDashLiveUnsupported) || errors.Is(err, service.ErrDashEncryptedUnsupported) {
+		logger.WithContext(ctx).Warnf("[PlayDashManifest] %v, video_id: %s", err, videoID)
+		return RespJsonError(ctx, 1004, err.Error())
+	}
+	if err != nil {
+		logger.WithContext(ctx).Errorf("[PlayDashManifest] 生成mpd内容失败: %v", err)
+		return RespJsonError(ctx, 1002, "生成mpd内容失败")
+	}
+
+	setPlayCacheHeaders(ctx, config.HTTPCacheDash, revision)
+	ctx.Header("Content-Type", "application/dash+xml")
+	ctx.String(http.StatusOK, mpdContent)
+	return nil
+}
+
+// mediaRevisionSources 媒体 m3u8 的内容来源：切片、密钥和直播状态
+const mediaRevisionSources = service.PlayRevisionSegments | service.PlayRevisionKeys | service.PlayRevisionLive
+
+// sealCineM3u8 加密 c3u8 响应的 m3u8 内容
+// 请求带 pk（播放器临时公钥，base64url）时使用 v2 协议，curve 为 x25519（默认）或 p256；
+// 否则在 app 开启 legacy 时使用 v1 协议（固定密钥和 nonce）
+func sealCineM3u8(ctx *gin.Context, m3u8Content string) (map[string]interface{}, error) {
+	if clientPublicKey := GetParamString(ctx, "pk"); clientPublicKey != "" {
+		envelope, err := service.SealC3u8Envelope(m3u8Content, GetParamString(ctx, "curve"), clientPublicKey)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"v":     envelope.Version,
+			"kid":   envelope.KeyID,
+			"alg":   envelope.Algorithm,
+			"epk":   envelope.EphemeralPublicKey,
+			"nonce": envelope.Nonce,
+			"info":  envelope.Info,
+		}, nil
+	}
+
+	if !config.GetAppConf().GetC3u8Conf(string(app.GetAppName(ctx))).Legacy {
+		return nil, errC3u8LegacyDisabled
+	}
+	m3u8Data, _, err := utils.AESEncrypt(m3u8Content, []byte(cinePlayerKey), []byte(cinePlayerNonce), utils.ModeGCM)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"info": base64.StdEncoding.EncodeToString(m3u8Data),
+	}, nil
+}
+
+// getPlayDefinition 获取播放的清晰度，路径参数优先，其次是 query 参数
+func getPlayDefinition(ctx *gin.Context) string {
+	if definition := ctx.Param("definition"); definition != "" {
+		return definition
+	}
+	return GetParamString(ctx, "definition")
+}
+
+// respDefinitionNotFound 返回清晰度不存在
+func respDefinitionNotFound(ctx *gin.Context, err error) error {
+	ctx.JSON(http.StatusNotFound, &entity.Response{
+		Code:    1004,
+		Message: err.Error(),
+		Data:    make(map[string]interface{}),
+	})
+	return nil
+}
+
+// respPlayForbidden 返回无播放权限
+func respPlayForbidden(ctx *gin.Context) error {
+	ctx.JSON(http.StatusForbidden, &entity.Response{
+		Code:    403,
+		Message: "无播放权限",
+		Data:    make(map[string]interface{}),
+	})
+	return nil
+}
+
+// checkPlayRightsOrTrial 检查播放权限，没有权限时按试看配置返回试看范围并设置试看响应头
+// 既没有权限也不能试看时返回 403，ok 为 false
+func checkPlayRightsOrTrial(ctx *gin.Context, funcName, videoID string) (*service.PlayTrial, bool) {
+	if service.CheckPlayRights(ctx, videoID) {
+		return nil, true
+	}
+	trial, err := service.ResolvePlayTrial(ctx, videoID, GetParamInt64(ctx, "vod_id"))
+	if err != nil {
+		logger.WithContext(ctx).Warnf("[%s] 用户无播放权限, video_id: %s", funcName, videoID)
+		_ = respPlayForbidden(ctx)
+		return nil, false
+	}
+	ctx.Header("X-Play-Trial", "1")
+	if trial.Duration > 0 {
+		ctx.Header("X-Play-Trial-Duration", strconv.FormatInt(int64(trial.Duration), 10))
+	}
+	return trial, true
+}
+
+// generatePlayMediaM3U8 生成清晰度对应的媒体 m3u8，trial 不为空时生成试看 m3u8
+func generatePlayMediaM3U8(ctx *gin.Context, videoID string, trial *service.PlayTrial) (string, error) {
+	playService := service.NewPlay(ctx)
+	if trial != nil {
+		return playService.GenerateTrialMediaM3U8Content(ctx, videoID, getPlayDefinition(ctx), trial)
+	}
+	return playService.GenerateMediaM3U8Content(ctx, videoID, getPlayDefinition(ctx))
+}
+
+// checkPlayTrialKeyRights 校验试看 token，且请求的密钥在 token 允许的范围内
+func checkPlayTrialKeyRights(ctx *gin.Context, videoID, token string, keyID uint64) bool {
+	scope, err := service.VerifyPlayTrialKeyToken(ctx, videoID, token)
+	if err != nil {
+		return false
+	}
+	for _, id := range scope.KeyIDs {
+		if id == keyID {
+			return true
+		}
+	}
+	return false
+}
+
 // PlayHlsIndexEncKey 获取播放的 hls 加密 key（通过 video_encrypt_id）
 func PlayHlsIndexEncKey(ctx *gin.Context) error {
 
@@ -104,24 +325,44 @@ func PlayHlsIndexEncKey(ctx *gin.Context) error {
 		return RespJsonError(ctx, 1001, "video_encrypt_id 不能为空")
 	}
 
-	// 检查播放权限
-	if !service.CheckPlayRights(ctx, videIDStr) {
+	// 检查播放权限（优先校验 m3u8 中签发的 token，避免每次请求 passport）
+	// 试看 token 只能获取试看切片的密钥
+	keyID := uint64(GetParamInt64(ctx, "key_id"))
+	token := GetParamString(ctx, "token")
+	if service.IsPlayTrialKeyToken(token) {
+		if !checkPlayTrialKeyRights(ctx, videIDStr, token, keyID) {
+			logger.WithContext(ctx).Warnf("[PlayHlsIndexEncKey] 试看 token 无权获取密钥, video_id: %s, key_id: %d", videIDStr, keyID)
+			return respPlayForbidden(ctx)
+		}
+	} else if !service.CheckPlayKeyRights(ctx, videIDStr, token) {
 		logger.WithContext(ctx).Warnf("[PlayHlsIndexEncKey] 用户无播放权限, video_id: %s", videIDStr)
-		ctx.JSON(http.StatusForbidden, &entity.Response{
-			Code:    403,
-			Message: "无播放权限",
-			Data:    make(map[string]interface{}),
-		})
-		return nil
+		return respPlayForbidden(ctx)
+	}
+	// 正常播放的密钥请求登记或续期播放会话
+	// hls.js 请求密钥时可能没有登录信息，此时按 token 中的用户和套餐登记，同样受设备数上限限制
+	if !service.IsPlayTrialKeyToken(token) {
+		if userID := entity.ContextValueLoginUserID(ctx); userID != "" {
+			if !checkPlaySession(ctx, "PlayHlsIndexEncKey", userID) {
+				return nil
+			}
+		} else if err := service.TouchKeyTokenPlaySession(ctx, token); err != nil {
+			logger.WithContext(ctx).Warnf("[PlayHlsIndexEncKey] %v, user_id: %s", err, service.PlayKeyTokenUserID(token))
+			return respPlaySessionLimit(ctx, err)
+		}
 	}
 
-	// 获取视频加密信息
+	// 获取视频加密信息，key_id 指定密钥轮换中的某个密钥
 	encryptService := service.NewVideoEncrypt(ctx)
-	encrypt, err := encryptService.GetEncryptInfoByVideoID(videIDStr)
+	encrypt, err := encryptService.GetEncryptInfo(videIDStr, keyID)
 	if err != nil {
 		logger.WithContext(ctx).Errorf("[PlayHlsIndexEncKey] 获取视频加密信息失败: %v", err)
 		return RespJsonError(ctx, 1002, "获取视频加密信息失败")
 	}
+	// 密钥内容不变，客户端缓存的密钥仍然有效时返回 304
+	revision := service.GetKeyRevision(encrypt)
+	if respPlayNotModified(ctx, config.HTTPCacheKey, revision) {
+		return nil
+	}
 
 	// 返回前端的 application/octet-stream
 	ctx.Header("Content-Type", "application/octet-stream")
@@ -131,10 +372,81 @@ func PlayHlsIndexEncKey(ctx *gin.Context) error {
 		logger.WithContext(ctx).Errorf("[PlayHlsIndexEncKey] 解码加密 key 失败: %v", err)
 		return RespJsonError(ctx, 1003, "解码加密 key 失败")
 	}
+	setPlayCacheHeaders(ctx, config.HTTPCacheKey, revision)
 	ctx.Data(http.StatusOK, "application/octet-stream", keyBytes)
 	return nil
 }
 
+// PlaySegment 切片代理：开启代理的 app 播放列表中的切片地址指向该接口，从源站回源后输出，支持 Range
+func PlaySegment(ctx *gin.Context) error {
+	videoID := ctx.Param("video_id")
+	sequence, err := strconv.ParseInt(ctx.Param("seq"), 10, 64)
+	definition := GetParamString(ctx, "definition")
+	if videoID == "" || definition == "" || err != nil {
+		logger.WithContext(ctx).Warnf("[PlaySegment] 切片参数错误, seq: %s, definition: %s", ctx.Param("seq"), definition)
+		return RespJsonError(ctx, 1001, "切片参数错误")
+	}
+
+	// 检查播放权限（m3u8 中签发的 token），试看 token 只能获取试看范围内的切片及其初始化切片
+	token := GetParamString(ctx, "token")
+	if service.IsPlayTrialKeyToken(token) {
+		scope, err := service.VerifyPlayTrialKeyToken(ctx, videoID, token)
+		if err != nil {
+			logger.WithContext(ctx).Warnf("[PlaySegment] 试看 token 无效, video_id: %s", videoID)
+			return respPlayForbidden(ctx)
+		}
+		if !scope.CoversSegment(definition, sequence) {
+			logger.WithContext(ctx).Warnf("[PlaySegment] 切片不在试看范围内, video_id: %s, definition: %s, seq: %d", videoID, definition, sequence)
+			return respPlayForbidden(ctx)
+		}
+	} else if !service.CheckPlayKeyRights(ctx, videoID, token) {
+		logger.WithContext(ctx).Warnf("[PlaySegment] 用户无播放权限, video_id: %s", videoID)
+		return respPlayForbidden(ctx)
+	}
+
+	// A/B 水印的版本由服务端按 token 的用户选择
+	init := GetParamString(ctx, "part") == "init"
+	segment, err := service.NewPlay(ctx).OpenSegment(ctx, videoID, definition, sequence, init, token)
+	switch {
+	case errors.Is(err, service.ErrSegmentProxyDisabled), errors.Is(err, service.ErrSegmentNotFound):
+		return respDefinitionNotFound(ctx, err)
+	case errors.Is(err, service.ErrSegmentProxyBusy):
+		logger.WithContext(ctx).Warnf("[PlaySegment] 回源请求过多, video_id: %s, seq: %d", videoID, sequence)
+		ctx.Header("Retry-After", "1")
+		ctx.JSON(http.StatusServiceUnavailable, &entity.Response{
+			Code:    1006,
+			Message: err.Error(),
+			Data:    make(map[string]interface{}),
+		})
+		return nil
+	case err != nil:
+		logger.WithContext(ctx).Errorf("[PlaySegment] 获取切片失败: %v, video_id: %s, seq: %d", err, videoID, sequence)
+		ctx.JSON(http.StatusBadGateway, &entity.Response{
+			Code:    1007,
+			Message: service.ErrSegmentOriginFailed.Error(),
+			Data:    make(map[string]interface{}),
+		})
+		return nil
+	}
+	defer segment.Close()
+
+	setPlayCacheHeaders(ctx, config.HTTPCacheSegment, nil)
+	ctx.Header("Content-Type", segment.ContentType)
+	// 磁盘缓存的切片由 http.ServeContent 处理 Range、If-Range 和条件请求
+	if segment.File != nil {
+		http.ServeContent(ctx.Writer, ctx.Request, "", segment.ModTime, segment.File)
+		return nil
+	}
+	for name, values := range segment.OriginHeaders() {
+		ctx.Writer.Header()[name] = values
+	}
+	ctx.Status(segment.Response.StatusCode)
+	if _, err = io.Copy(ctx.Writer, segment.Response.Body); err != nil {
+		logger.WithContext(ctx).Warnf("[PlaySegment] 输出切片中断: %v, video_id: %s, seq: %d", err, videoID, sequence)
+	}
+	return nil
+}
+
 // PlayCine cine 播放器协议播放接口（私有协议暂时不用一级m3u8）
 // func PlayCine(ctx *gin.Context) error {
 // 	videoID := ctx.Param("video_id")
@@ -174,42 +486,52 @@ func PlayCineHlsIndexC3u8(ctx *gin.Context) error {
 		return RespJsonError(ctx, 1001, "视频ID不能为空")
 	}
 
-	// 检查播放权限
-	if !service.CheckPlayRights(ctx, videoID) {
-		logger.WithContext(ctx).Warnf("[PlayCineHlsIndexC3u8] 用户无播放权限, video_id: %s", videoID)
-		ctx.JSON(http.StatusForbidden, &entity.Response{
-			Code:    403,
-			Message: "无播放权限",
-			Data:    make(map[string]interface{}),
-		})
+	// 检查播放权限，没有权限时尝试试看
+	trial, ok := checkPlayRightsOrTrial(ctx, "PlayCineHlsIndexC3u8", videoID)
+	if !ok {
+		return nil
+	}
+	// 正常播放时登记当前设备的播放会话，试看不限制设备数
+	if trial == nil && !checkPlaySession(ctx, "PlayCineHlsIndexC3u8", entity.ContextValueLoginUserID(ctx)) {
 		return nil
 	}
 
-	// 获取所有的 ts 分片
-	tsService := service.NewVideoTS(ctx)
-	tsList, err := tsService.GetList(videoID, "")
-	if err != nil {
-		logger.WithContext(ctx).Errorf("[PlayCineHlsIndexM3u8] 查询TS切片列表失败: %v", err)
-		return RespJsonError(ctx, 1002, "查询TS切片列表失败")
+	// 内容没有变化时返回 304
+	revision := loadPlayRevision(ctx, "PlayCineHlsIndexC3u8", videoID, mediaRevisionSources, trialRevisionVariant(trial))
+	if respPlayNotModified(ctx, config.HTTPCacheC3u8, revision) {
+		return nil
 	}
 
-	playService := service.NewPlay(ctx)
-	m3u8Content, err := playService.GenerateM3U8Content(ctx, videoID, tsList)
+	// 生成清晰度对应的媒体 m3u8
+	m3u8Content, err := generatePlayMediaM3U8(ctx, videoID, trial)
+	if errors.Is(err, service.ErrDefinitionNotFound) {
+		logger.WithContext(ctx).Warnf("[PlayCineHlsIndexM3u8] %v, video_id: %s", err, videoID)
+		return respDefinitionNotFound(ctx, err)
+	}
+	if errors.Is(err, service.ErrTrialUnavailable) {
+		logger.WithContext(ctx).Warnf("[PlayCineHlsIndexC3u8] %v, video_id: %s", err, videoID)
+		return respPlayForbidden(ctx)
+	}
 	if err != nil {
 		logger.WithContext(ctx).Errorf("[PlayCineHlsIndexM3u8] 生成m3u8内容失败: %v", err)
 		return RespJsonError(ctx, 1003, "生成m3u8内容失败")
 	}
 
-	// m3u8 数据加密为二进制数据， GCM模式示例
-	m3u8Data, _, err := utils.AESEncrypt(m3u8Content, []byte(cinePlayerKey), []byte(cinePlayerNonce), utils.ModeGCM)
+	// m3u8 内容加密：v2 使用播放器上报的临时公钥协商密钥，没有公钥时按 app 配置决定是否使用 v1
+	result, err := sealCineM3u8(ctx, m3u8Content)
+	if errors.Is(err, service.ErrC3u8ClientKeyInvalid) || errors.Is(err, errC3u8LegacyDisabled) {
+		logger.WithContext(ctx).Warnf("[PlayCineHlsIndexC3u8] %v, video_id: %s", err, videoID)
+		return RespJsonError(ctx, 1005, err.Error())
+	}
 	if err != nil {
 		logger.WithContext(ctx).Errorf("[PlayCineHlsIndexM3u8] GCM加密失败：%v", err)
 		return RespJsonError(ctx, 1003, "获取视频信息失败 crypto err")
 	}
-	m3u8base64Str := base64.StdEncoding.EncodeToString(m3u8Data)
-	var result = map[string]interface{}{
-		"info": m3u8base64Str,
+	// 试看时告诉播放器试看范围，用于提示购买
+	if trial != nil {
+		result["trial"] = trial
 	}
 
+	setPlayCacheHeaders(ctx, config.HTTPCacheC3u8, revision)
 	return RespJsonSuccess(ctx, result)
 }
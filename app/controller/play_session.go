@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/app/service"
+	"github.com/aldge/cine_stream/config"
+	"github.com/aldge/cine_stream/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// checkPlaySession 登记或续期当前设备的播放会话，同时播放的设备数已达上限时返回 429，ok 为 false
+func checkPlaySession(ctx *gin.Context, funcName, userID string) bool {
+	err := service.TouchPlaySession(ctx, userID)
+	if err == nil {
+		return true
+	}
+	logger.WithContext(ctx).Warnf("[%s] %v, user_id: %s", funcName, err, userID)
+	_ = respPlaySessionLimit(ctx, err)
+	return false
+}
+
+// respPlaySessionLimit 返回同时播放的设备数已达上限
+func respPlaySessionLimit(ctx *gin.Context, err error) error {
+	ctx.JSON(http.StatusTooManyRequests, &entity.Response{
+		Code:    1008,
+		Message: err.Error(),
+		Data:    make(map[string]interface{}),
+	})
+	return nil
+}
+
+// respNotLogin 返回没有登录
+func respNotLogin(ctx *gin.Context) error {
+	ctx.JSON(http.StatusUnauthorized, &entity.Response{
+		Code:    401,
+		Message: "请先登录",
+		Data:    make(map[string]interface{}),
+	})
+	return nil
+}
+
+// PlayHeartbeat 播放心跳，续期当前设备的播放会话并保存观看进度；stopped 为 true 时释放会话
+func PlayHeartbeat(ctx *gin.Context) error {
+	videoID := ctx.Param("video_id")
+	if videoID == "" {
+		logger.WithContext(ctx).Warnf("[PlayHeartbeat] 视频ID不能为空")
+		return RespJsonError(ctx, 1001, "视频ID不能为空")
+	}
+	userID := entity.ContextValueLoginUserID(ctx)
+	if userID == "" {
+		return respNotLogin(ctx)
+	}
+	// 没有请求体时按普通心跳处理
+	var req entity.PlayHeartbeatRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		logger.WithContext(ctx).Warnf("[PlayHeartbeat] 参数绑定失败: %v", err)
+		return RespJsonError(ctx, 1002, "参数绑定失败")
+	}
+
+	// 观看进度保存失败不影响播放
+	if err := service.NewWatchProgress(ctx).Report(userID, videoID, &req); err != nil {
+		logger.WithContext(ctx).Warnf("[PlayHeartbeat] 保存观看进度失败: %v, user_id: %s, video_id: %s", err, userID, videoID)
+	}
+
+	if req.Stopped {
+		service.ReleasePlaySession(ctx, userID)
+		return RespJsonSuccess(ctx, nil)
+	}
+	if !checkPlaySession(ctx, "PlayHeartbeat", userID) {
+		return nil
+	}
+	return RespJsonSuccess(ctx, &entity.PlayHeartbeatResult{
+		Interval: max(config.GetAppConf().GetPlaySessionConf().TTLSeconds/3, 1),
+		KeyToken: service.RefreshPlayKeyToken(ctx, videoID, req.KeyToken),
+	})
+}
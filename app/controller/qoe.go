@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/app/service"
+	"github.com/aldge/cine_stream/logger"
+	"github.com/aldge/gopkg/app"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// qoeBeaconMaxBodyBytes 播放质量上报请求体的最大长度
+	qoeBeaconMaxBodyBytes = 64 << 10
+	// qoeReportDefaultRange 查询播放质量时默认的时间范围（最近 24 小时）
+	qoeReportDefaultRange = 24 * time.Hour
+	// qoeReportMaxRange 查询播放质量的最大时间范围
+	qoeReportMaxRange = 31 * 24 * time.Hour
+)
+
+// QoEBeacon 接收播放器上报的播放质量事件（起播耗时、卡顿、码率切换、播放失败、播放时长）
+// 事件提交给后台任务汇总，不等待写入数据库
+func QoEBeacon(ctx *gin.Context) error {
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, qoeBeaconMaxBodyBytes)
+	// sendBeacon 的 Content-Type 为 text/plain，ShouldBindJSON 不检查 Content-Type
+	var req entity.QoEBeaconRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		logger.WithContext(ctx).Warnf("[QoEBeacon] 参数绑定失败: %v", err)
+		return RespJsonError(ctx, 1001, "参数绑定失败")
+	}
+
+	accepted, err := service.NewQoE(ctx).Ingest(ctx, &req)
+	if errors.Is(err, service.ErrQoEDisabled) {
+		return RespJsonError(ctx, 1004, err.Error())
+	}
+	if errors.Is(err, service.ErrQoEBusy) {
+		return RespJsonError(ctx, 1003, err.Error())
+	}
+	if err != nil {
+		logger.WithContext(ctx).Warnf("[QoEBeacon] 上报失败: %v, video_id: %s", err, req.VideoID)
+		return RespJsonError(ctx, 1002, err.Error())
+	}
+	return RespJsonSuccess(ctx, map[string]interface{}{
+		"accepted": accepted,
+	})
+}
+
+// QoEReport 查询当前 app 的播放质量汇总，按时间段、视频或 CDN 分组
+func QoEReport(ctx *gin.Context) error {
+	now := time.Now()
+	query := entity.QoEReportQuery{
+		App:       string(app.GetAppName(ctx)),
+		StartTime: GetParamInt64Def(ctx, "start_time", now.Add(-qoeReportDefaultRange).Unix()),
+		EndTime:   GetParamInt64Def(ctx, "end_time", now.Unix()),
+		VideoID:   GetParamString(ctx, "video_id"),
+		CDN:       GetParamString(ctx, "cdn"),
+		GroupBy:   GetParamStringDef(ctx, "group_by", entity.QoEGroupByBucket),
+	}
+	if query.StartTime <= 0 || query.EndTime <= query.StartTime {
+		return RespJsonError(ctx, 1001, "时间范围不合法")
+	}
+	if query.EndTime-query.StartTime > int64(qoeReportMaxRange/time.Second) {
+		return RespJsonError(ctx, 1001, "时间范围不能超过 31 天")
+	}
+	switch query.GroupBy {
+	case entity.QoEGroupByBucket, entity.QoEGroupByVideo, entity.QoEGroupByCDN:
+	default:
+		return RespJsonError(ctx, 1001, "分组方式不合法")
+	}
+
+	items, err := service.NewQoE(ctx).Report(&query)
+	if err != nil {
+		return RespJsonError(ctx, 1002, err.Error())
+	}
+	return RespJsonSuccess(ctx, map[string]interface{}{
+		"group_by":  query.GroupBy,
+		"stat_list": items,
+	})
+}
@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/app/service"
+	"github.com/aldge/cine_stream/logger"
+)
+
+// VideoAudioSave 保存视频的音轨（多语言配音）和音轨切片
+func VideoAudioSave(ctx *gin.Context) error {
+	var req entity.VideoAudioSaveRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		logger.WithContext(ctx).Warnf("[VideoAudioSave] 参数绑定失败: %v", err)
+		return RespJsonError(ctx, 1001, "参数绑定失败")
+	}
+	for _, ts := range req.TSData {
+		if ts.TSPath == "" {
+			logger.WithContext(ctx).Warnf("[VideoAudioSave] 音轨切片path不能为空, ts: %+v", ts)
+			return RespJsonError(ctx, 1001, fmt.Sprintf("音轨切片path不能为空, ts: %+v", ts))
+		}
+	}
+	for _, key := range req.Keys {
+		if key.Key == "" {
+			logger.WithContext(ctx).Warnf("[VideoAudioSave] 加密区间Key不能为空, key: %+v", key)
+			return RespJsonError(ctx, 1001, fmt.Sprintf("加密区间Key不能为空, start_sequence: %d", key.StartSequence))
+		}
+	}
+
+	audio, err := service.NewVideoAudio(ctx).Save(&req)
+	if err != nil {
+		logger.WithContext(ctx).Errorf("[VideoAudioSave] 保存音轨失败: %v", err)
+		return RespJsonError(ctx, 1002, err.Error())
+	}
+	return RespJsonSuccess(ctx, map[string]interface{}{
+		"video_id":       req.VideoID,
+		"video_audio_id": audio.VideoAudioID,
+		"definition":     audio.Definition,
+	})
+}
+
+// VideoAudioList 获取视频的音轨列表
+func VideoAudioList(ctx *gin.Context) error {
+	videoID := GetParamString(ctx, "video_id")
+	if videoID == "" {
+		logger.WithContext(ctx).Warnf("[VideoAudioList] 视频ID不能为空")
+		return RespJsonError(ctx, 1001, "视频ID不能为空")
+	}
+
+	audioList, err := service.NewVideoAudio(ctx).GetList(videoID)
+	if err != nil {
+		logger.WithContext(ctx).Errorf("[VideoAudioList] 查询音轨列表失败: %v", err)
+		return RespJsonError(ctx, 1002, "查询音轨列表失败")
+	}
+	return RespJsonSuccess(ctx, map[string]interface{}{
+		"video_id":   videoID,
+		"audio_list": audioList,
+	})
+}
@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/app/service"
+	"github.com/aldge/cine_stream/logger"
+)
+
+// VideoLiveStart 开始直播（live 滑动窗口 / event 只追加）
+func VideoLiveStart(ctx *gin.Context) error {
+	var req entity.VideoLiveStartRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		logger.WithContext(ctx).Warnf("[VideoLiveStart] 参数绑定失败: %v", err)
+		return RespJsonError(ctx, 1001, "参数绑定失败")
+	}
+
+	live, err := service.NewVideoLive(ctx).Start(&req)
+	if err != nil {
+		logger.WithContext(ctx).Errorf("[VideoLiveStart] 开始直播失败: %v", err)
+		return RespJsonError(ctx, 1002, err.Error())
+	}
+	return RespJsonSuccess(ctx, map[string]interface{}{
+		"live": live,
+	})
+}
+
+// VideoLiveAppend 编码器追加直播切片
+func VideoLiveAppend(ctx *gin.Context) error {
+	var req entity.VideoLiveAppendRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		logger.WithContext(ctx).Warnf("[VideoLiveAppend] 参数绑定失败: %v", err)
+		return RespJsonError(ctx, 1001, "参数绑定失败")
+	}
+	if len(req.TSData) == 0 {
+		logger.WithContext(ctx).Warnf("[VideoLiveAppend] TS列表不能为空")
+		return RespJsonError(ctx, 1001, "TS列表不能为空")
+	}
+	for _, ts := range req.TSData {
+		if ts.TSPath == "" {
+			logger.WithContext(ctx).Warnf("[VideoLiveAppend] TS切片path不能为空, ts: %+v", ts)
+			return RespJsonError(ctx, 1001, fmt.Sprintf("TS切片path不能为空, ts: %+v", ts))
+		}
+		if ts.TSSequence < 0 {
+			logger.WithContext(ctx).Warnf("[VideoLiveAppend] TS切片序号不能为空, ts: %+v", ts)
+			return RespJsonError(ctx, 1001, fmt.Sprintf("TS切片序号不能为空, ts: %+v", ts))
+		}
+	}
+
+	err := service.NewVideoLive(ctx).Append(&req)
+	if errors.Is(err, service.ErrLiveNotFound) || errors.Is(err, service.ErrLiveEnded) {
+		logger.WithContext(ctx).Warnf("[VideoLiveAppend] 追加直播切片失败: %v, video_id: %s", err, req.VideoID)
+		return RespJsonError(ctx, 1003, err.Error())
+	}
+	if err != nil {
+		logger.WithContext(ctx).Errorf("[VideoLiveAppend] 追加直播切片失败: %v", err)
+		return RespJsonError(ctx, 1002, err.Error())
+	}
+	return RespJsonSuccess(ctx, map[string]interface{}{
+		"video_id": req.VideoID,
+	})
+}
+
+// VideoLiveFinalize 结束直播，m3u8 开始输出 EXT-X-ENDLIST
+func VideoLiveFinalize(ctx *gin.Context) error {
+	var req entity.VideoLiveFinalizeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		logger.WithContext(ctx).Warnf("[VideoLiveFinalize] 参数绑定失败: %v", err)
+		return RespJsonError(ctx, 1001, "参数绑定失败")
+	}
+
+	err := service.NewVideoLive(ctx).Finalize(req.VideoID)
+	if errors.Is(err, service.ErrLiveNotFound) {
+		logger.WithContext(ctx).Warnf("[VideoLiveFinalize] 直播不存在, video_id: %s", req.VideoID)
+		return RespJsonError(ctx, 1003, err.Error())
+	}
+	if err != nil {
+		logger.WithContext(ctx).Errorf("[VideoLiveFinalize] 结束直播失败: %v", err)
+		return RespJsonError(ctx, 1002, err.Error())
+	}
+	return RespJsonSuccess(ctx, map[string]interface{}{
+		"video_id": req.VideoID,
+	})
+}
@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/app/service"
+	"github.com/aldge/cine_stream/config"
+	"github.com/aldge/cine_stream/logger"
+	"github.com/aldge/cine_stream/utils"
+)
+
+// VideoSubtitleSave 保存视频的字幕轨道（WebVTT 切片）
+func VideoSubtitleSave(ctx *gin.Context) error {
+	var req entity.VideoSubtitleSaveRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		logger.WithContext(ctx).Warnf("[VideoSubtitleSave] 参数绑定失败: %v", err)
+		return RespJsonError(ctx, 1001, "参数绑定失败")
+	}
+
+	subtitle, err := service.NewVideoSubtitle(ctx).Save(&req)
+	if err != nil {
+		logger.WithContext(ctx).Errorf("[VideoSubtitleSave] 保存字幕失败: %v", err)
+		return RespJsonError(ctx, 1002, err.Error())
+	}
+	return RespJsonSuccess(ctx, map[string]interface{}{
+		"video_id":          req.VideoID,
+		"video_subtitle_id": subtitle.VideoSubtitleID,
+	})
+}
+
+// VideoSubtitleUpload 上传 SRT/ASS 字幕，转换为 WebVTT 并按视频切片切分后保存
+func VideoSubtitleUpload(ctx *gin.Context) error {
+	var req entity.VideoSubtitleUploadRequest
+	if err := ctx.ShouldBind(&req); err != nil {
+		logger.WithContext(ctx).Warnf("[VideoSubtitleUpload] 参数绑定失败: %v", err)
+		return RespJsonError(ctx, 1001, "参数绑定失败")
+	}
+	fileHeader, err := ctx.FormFile("file")
+	if err != nil {
+		logger.WithContext(ctx).Warnf("[VideoSubtitleUpload] 字幕文件不能为空: %v", err)
+		return RespJsonError(ctx, 1001, "字幕文件不能为空")
+	}
+	if fileHeader.Size > config.GetAppConf().GetSubtitleConf().MaxUploadSize {
+		logger.WithContext(ctx).Warnf("[VideoSubtitleUpload] 字幕文件过大, size: %d", fileHeader.Size)
+		return RespJsonError(ctx, 1001, "字幕文件过大")
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		logger.WithContext(ctx).Errorf("[VideoSubtitleUpload] 打开字幕文件失败: %v", err)
+		return RespJsonError(ctx, 1002, "读取字幕文件失败")
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		logger.WithContext(ctx).Errorf("[VideoSubtitleUpload] 读取字幕文件失败: %v", err)
+		return RespJsonError(ctx, 1002, "读取字幕文件失败")
+	}
+
+	subtitle, segmentCount, err := service.NewVideoSubtitle(ctx).Upload(&req, fileHeader.Filename, data)
+	if err != nil {
+		logger.WithContext(ctx).Errorf("[VideoSubtitleUpload] 上传字幕失败: %v", err)
+		return RespJsonError(ctx, 1003, err.Error())
+	}
+	return RespJsonSuccess(ctx, map[string]interface{}{
+		"video_id":          req.VideoID,
+		"video_subtitle_id": subtitle.VideoSubtitleID,
+		"segment_count":     segmentCount,
+	})
+}
+
+// VideoSubtitleList 获取视频的字幕轨道列表
+func VideoSubtitleList(ctx *gin.Context) error {
+	videoID := GetParamString(ctx, "video_id")
+	if videoID == "" {
+		logger.WithContext(ctx).Warnf("[VideoSubtitleList] 视频ID不能为空")
+		return RespJsonError(ctx, 1001, "视频ID不能为空")
+	}
+
+	subtitleList, err := service.NewVideoSubtitle(ctx).GetList(videoID)
+	if err != nil {
+		logger.WithContext(ctx).Errorf("[VideoSubtitleList] 查询字幕列表失败: %v", err)
+		return RespJsonError(ctx, 1002, "查询字幕列表失败")
+	}
+	return RespJsonSuccess(ctx, map[string]interface{}{
+		"video_id":      videoID,
+		"subtitle_list": subtitleList,
+	})
+}
+
+// PlaySubtitleM3u8 获取字幕轨道的 m3u8 文件
+func PlaySubtitleM3u8(ctx *gin.Context) error {
+	videoID := ctx.Param("video_id")
+	subtitleID := uint64(utils.Convert.StringToInt64(ctx.Param("subtitle_id")))
+	if videoID == "" || subtitleID == 0 {
+		logger.WithContext(ctx).Warnf("[PlaySubtitleM3u8] 视频ID或字幕ID不能为空")
+		return RespJsonError(ctx, 1001, "视频ID或字幕ID不能为空")
+	}
+
+	// 检查播放权限
+	if !service.CheckPlayRights(ctx, videoID) {
+		logger.WithContext(ctx).Warnf("[PlaySubtitleM3u8] 用户无播放权限, video_id: %s", videoID)
+		return respPlayForbidden(ctx)
+	}
+
+	// 内容没有变化时返回 304
+	revision := loadPlayRevision(ctx, "PlaySubtitleM3u8", videoID, service.PlayRevisionSubtitles, "")
+	if respPlayNotModified(ctx, config.HTTPCacheSubtitle, revision) {
+		return nil
+	}
+
+	playService := service.NewPlay(ctx)
+	m3u8Content, err := playService.GenerateSubtitleM3U8Content(ctx, videoID, subtitleID)
+	if errors.Is(err, service.ErrSubtitleNotFound) {
+		logger.WithContext(ctx).Warnf("[PlaySubtitleM3u8] 字幕不存在, video_id: %s, subtitle_id: %d", videoID, subtitleID)
+		ctx.JSON(http.StatusNotFound, &entity.Response{
+			Code:    1004,
+			Message: err.Error(),
+			Data:    make(map[string]interface{}),
+		})
+		return nil
+	}
+	if err != nil {
+		logger.WithContext(ctx).Errorf("[PlaySubtitleM3u8] 生成字幕m3u8内容失败: %v", err)
+		return RespJsonError(ctx, 1003, "生成字幕m3u8内容失败")
+	}
+
+	setPlayCacheHeaders(ctx, config.HTTPCacheSubtitle, revision)
+	ctx.Header("Content-Type", "application/vnd.apple.mpegurl")
+	ctx.String(http.StatusOK, m3u8Content)
+	return nil
+}
+
+// PlaySubtitleSegment 获取上传转换生成的 WebVTT 字幕切片
+func PlaySubtitleSegment(ctx *gin.Context) error {
+	videoID := ctx.Param("video_id")
+	subtitleID := uint64(utils.Convert.StringToInt64(ctx.Param("subtitle_id")))
+	sequence, err := strconv.ParseInt(strings.TrimSuffix(ctx.Param("segment"), ".vtt"), 10, 64)
+	if videoID == "" || subtitleID == 0 || err != nil {
+		logger.WithContext(ctx).Warnf("[PlaySubtitleSegment] 字幕切片参数错误, segment: %s", ctx.Param("segment"))
+		return RespJsonError(ctx, 1001, "字幕切片参数错误")
+	}
+
+	// 检查播放权限（字幕 m3u8 中签发的 token）
+	if !service.CheckPlayKeyRights(ctx, videoID, GetParamString(ctx, "token")) {
+		logger.WithContext(ctx).Warnf("[PlaySubtitleSegment] 用户无播放权限, video_id: %s", videoID)
+		return respPlayForbidden(ctx)
+	}
+
+	// 内容没有变化时返回 304
+	revision := loadPlayRevision(ctx, "PlaySubtitleSegment", videoID, service.PlayRevisionSubtitles, "")
+	if respPlayNotModified(ctx, config.HTTPCacheSubtitleSegment, revision) {
+		return nil
+	}
+
+	content, err := service.NewVideoSubtitle(ctx).GetSegmentContent(videoID, subtitleID, sequence)
+	if errors.Is(err, service.ErrSubtitleNotFound) {
+		ctx.JSON(http.StatusNotFound, &entity.Response{
+			Code:    1004,
+			Message: err.Error(),
+			Data:    make(map[string]interface{}),
+		})
+		return nil
+	}
+	if err != nil {
+		logger.WithContext(ctx).Errorf("[PlaySubtitleSegment] 获取字幕切片失败: %v", err)
+		return RespJsonError(ctx, 1002, "获取字幕切片失败")
+	}
+
+	setPlayCacheHeaders(ctx, config.HTTPCacheSubtitleSegment, revision)
+	ctx.Data(http.StatusOK, "text/vtt; charset=utf-8", []byte(content))
+	return nil
+}
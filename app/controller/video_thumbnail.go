@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/app/service"
+	"github.com/aldge/cine_stream/config"
+	"github.com/aldge/cine_stream/logger"
+)
+
+// VideoThumbnailSave 保存视频的缩略图雪碧图（进度条预览）
+func VideoThumbnailSave(ctx *gin.Context) error {
+	var req entity.VideoThumbnailSaveRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		logger.WithContext(ctx).Warnf("[VideoThumbnailSave] 参数绑定失败: %v", err)
+		return RespJsonError(ctx, 1001, "参数绑定失败")
+	}
+
+	thumbnails, err := service.NewVideoThumbnail(ctx).Save(&req)
+	if err != nil {
+		logger.WithContext(ctx).Errorf("[VideoThumbnailSave] 保存雪碧图失败: %v", err)
+		return RespJsonError(ctx, 1002, err.Error())
+	}
+	return RespJsonSuccess(ctx, map[string]interface{}{
+		"video_id": req.VideoID,
+		"count":    len(thumbnails),
+	})
+}
+
+// VideoThumbnailList 获取视频的缩略图雪碧图列表
+func VideoThumbnailList(ctx *gin.Context) error {
+	videoID := GetParamString(ctx, "video_id")
+	if videoID == "" {
+		logger.WithContext(ctx).Warnf("[VideoThumbnailList] 视频ID不能为空")
+		return RespJsonError(ctx, 1001, "视频ID不能为空")
+	}
+
+	thumbnailList, err := service.NewVideoThumbnail(ctx).GetList(videoID)
+	if err != nil {
+		logger.WithContext(ctx).Errorf("[VideoThumbnailList] 查询雪碧图列表失败: %v", err)
+		return RespJsonError(ctx, 1002, "查询雪碧图列表失败")
+	}
+	return RespJsonSuccess(ctx, map[string]interface{}{
+		"video_id":       videoID,
+		"thumbnail_list": thumbnailList,
+	})
+}
+
+// PlayThumbnailVTT 获取视频的 WebVTT 缩略图轨道
+func PlayThumbnailVTT(ctx *gin.Context) error {
+	videoID := ctx.Param("video_id")
+	if videoID == "" {
+		logger.WithContext(ctx).Warnf("[PlayThumbnailVTT] 视频ID不能为空")
+		return RespJsonError(ctx, 1001, "视频ID不能为空")
+	}
+
+	// 检查播放权限
+	if !service.CheckPlayRights(ctx, videoID) {
+		logger.WithContext(ctx).Warnf("[PlayThumbnailVTT] 用户无播放权限, video_id: %s", videoID)
+		return respPlayForbidden(ctx)
+	}
+
+	// 内容没有变化时返回 304
+	revision := loadPlayRevision(ctx, "PlayThumbnailVTT", videoID, service.PlayRevisionThumbnails, "")
+	if respPlayNotModified(ctx, config.HTTPCacheThumbnail, revision) {
+		return nil
+	}
+
+	vttContent, err := service.NewPlay(ctx).GenerateThumbnailVTT(ctx, videoID)
+	if errors.Is(err, service.ErrThumbnailNotFound) {
+		logger.WithContext(ctx).Warnf("[PlayThumbnailVTT] %v, video_id: %s", err, videoID)
+		ctx.JSON(http.StatusNotFound, &entity.Response{
+			Code:    1004,
+			Message: err.Error(),
+			Data:    make(map[string]interface{}),
+		})
+		return nil
+	}
+	if err != nil {
+		logger.WithContext(ctx).Errorf("[PlayThumbnailVTT] 生成缩略图轨道失败: %v", err)
+		return RespJsonError(ctx, 1003, "生成缩略图轨道失败")
+	}
+
+	setPlayCacheHeaders(ctx, config.HTTPCacheThumbnail, revision)
+	ctx.Header("Content-Type", "text/vtt; charset=utf-8")
+	ctx.String(http.StatusOK, vttContent)
+	return nil
+}
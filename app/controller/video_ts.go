@@ -1,8 +1,8 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
-	"net/http"
 
 	"github.com/gin-gonic/gin"
 
@@ -22,13 +22,22 @@ func VideoTsSave(ctx *gin.Context) error {
 		logger.WithContext(ctx).Warnf("[VideoTsSave] 视频ID不能为空")
 		return RespJsonError(ctx, 1001, "视频ID不能为空")
 	}
-	if req.Key == "" {
-		logger.WithContext(ctx).Warnf("[VideoTsSave] 视频加密Key不能为空")
-		return RespJsonError(ctx, 1001, "视频加密Key不能为空")
+	// 没有按区间指定密钥时，key/iv 作用于所有切片
+	if len(req.Keys) == 0 {
+		if req.Key == "" {
+			logger.WithContext(ctx).Warnf("[VideoTsSave] 视频加密Key不能为空")
+			return RespJsonError(ctx, 1001, "视频加密Key不能为空")
+		}
+		if req.IV == "" {
+			logger.WithContext(ctx).Warnf("[VideoTsSave] 视频加密向量不能为空")
+			return RespJsonError(ctx, 1001, "视频加密向量不能为空")
+		}
 	}
-	if req.IV == "" {
-		logger.WithContext(ctx).Warnf("[VideoTsSave] 视频加密向量不能为空")
-		return RespJsonError(ctx, 1001, "视频加密向量不能为空")
+	for _, key := range req.Keys {
+		if key.Key == "" {
+			logger.WithContext(ctx).Warnf("[VideoTsSave] 加密区间Key不能为空, key: %+v", key)
+			return RespJsonError(ctx, 1001, fmt.Sprintf("加密区间Key不能为空, start_sequence: %d", key.StartSequence))
+		}
 	}
 	if len(req.TSData) == 0 {
 		logger.WithContext(ctx).Warnf("[VideoTsSave] TS列表不能为空")
@@ -47,26 +56,42 @@ func VideoTsSave(ctx *gin.Context) error {
 		}
 	}
 
-	// 保存TS切片
-	tsService := service.NewVideoTS(ctx)
-	err := tsService.BatchCreate(req.VideoID, req.TSData)
+	// 先保存切片的加密信息再保存切片，切片可以播放时密钥已经存在
+	encryptService := service.NewVideoEncrypt(ctx)
+	var err error
+	var trialEnds map[string]int64
+	if len(req.Keys) > 0 {
+		err = encryptService.BatchCreate(req.VideoID, req.Keys)
+	} else {
+		trialEnds, err = encryptService.Create(req.VideoID, req.Key, req.IV, req.TrialKey, req.TrialIV, req.TSData)
+	}
 	if err != nil {
-		logger.WithContext(ctx).Errorf("[VideoTsSave] 批量保存TS切片失败: %v", err)
-		return RespJsonError(ctx, 1002, "批量保存TS切片失败")
+		logger.WithContext(ctx).Errorf("[VideoTsSave] 保存视频加密信息失败: %v", err)
+		return RespJsonError(ctx, 1003, err.Error())
 	}
 
-	// 保存每个切片的加密信息
-	encryptService := service.NewVideoEncrypt(ctx)
-	err = encryptService.Create(req.VideoID, req.Key, req.IV)
+	// 保存TS切片，需要时在后台扫描关键帧
+	err = service.NewVideoTS(ctx).BatchCreate(req.VideoID, req.TSData)
+	if errors.Is(err, service.ErrAudioDefinitionNotFound) {
+		logger.WithContext(ctx).Warnf("[VideoTsSave] %v, video_id: %s", err, req.VideoID)
+		return RespJsonError(ctx, 1001, err.Error())
+	}
 	if err != nil {
-		logger.WithContext(ctx).Errorf("[VideoTsSave] 保存视频加密信息失败: %v", err)
-		return RespJsonError(ctx, 1003, "保存视频加密信息失败")
+		logger.WithContext(ctx).Errorf("[VideoTsSave] 批量保存TS切片失败: %v", err)
+		return RespJsonError(ctx, 1002, "批量保存TS切片失败")
+	}
+	if req.ScanKeyframes {
+		service.NewVideoTS(ctx.Copy()).ScanKeyframes(req.VideoID, req.TSData)
 	}
 
 	logger.WithContext(ctx).Infof("[VideoTsSave] 批量保存TS切片成功, video_id: %s, count: %d", req.VideoID, len(req.TSData))
-	return RespJsonSuccess(ctx, map[string]interface{}{
+	result := map[string]interface{}{
 		"video_id": req.VideoID,
-	})
+	}
+	if len(trialEnds) > 0 {
+		result["trial_end_sequence"] = trialEnds
+	}
+	return RespJsonSuccess(ctx, result)
 }
 
 // VideoTsList 获取TS切片列表
@@ -82,12 +107,7 @@ func VideoTsList(ctx *gin.Context) error {
 	// 检查播放权限
 	if !service.CheckPlayRights(ctx, videoID) {
 		logger.WithContext(ctx).Warnf("[VideoTsList] 用户无播放权限, video_id: %s", videoID)
-		ctx.JSON(http.StatusForbidden, &entity.Response{
-			Code:    403,
-			Message: "无播放权限",
-			Data:    make(map[string]interface{}),
-		})
-		return nil
+		return respPlayForbidden(ctx)
 	}
 
 	tsService := service.NewVideoTS(ctx)
@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/app/service"
+	"github.com/aldge/cine_stream/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// 继续观看列表的默认和最大条数
+const (
+	watchContinueDefaultLimit = 20
+	watchContinueMaxLimit     = 100
+)
+
+// PlayProgress 获取当前用户某个视频的观看进度，播放器据此续播
+func PlayProgress(ctx *gin.Context) error {
+	videoID := ctx.Param("video_id")
+	if videoID == "" {
+		logger.WithContext(ctx).Warnf("[PlayProgress] 视频ID不能为空")
+		return RespJsonError(ctx, 1001, "视频ID不能为空")
+	}
+	userID := entity.ContextValueLoginUserID(ctx)
+	if userID == "" {
+		return respNotLogin(ctx)
+	}
+
+	progress, err := service.NewWatchProgress(ctx).Get(userID, videoID)
+	if err != nil {
+		return RespJsonError(ctx, 1002, err.Error())
+	}
+	return RespJsonSuccess(ctx, progress)
+}
+
+// WatchContinueList 获取当前用户的继续观看列表，按最后观看时间倒序
+func WatchContinueList(ctx *gin.Context) error {
+	userID := entity.ContextValueLoginUserID(ctx)
+	if userID == "" {
+		return respNotLogin(ctx)
+	}
+	limit := GetParamIntDef(ctx, "limit", watchContinueDefaultLimit)
+	if limit <= 0 || limit > watchContinueMaxLimit {
+		limit = watchContinueDefaultLimit
+	}
+
+	items, err := service.NewWatchProgress(ctx).ContinueWatching(userID, limit)
+	if err != nil {
+		return RespJsonError(ctx, 1002, err.Error())
+	}
+	return RespJsonSuccess(ctx, map[string]interface{}{
+		"progress_list": items,
+	})
+}
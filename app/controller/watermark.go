@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"errors"
+
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/app/service"
+	"github.com/aldge/cine_stream/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// WatermarkDecode 从泄露视频中识别出的 A/B 切片序列解码水印，返回匹配的用户
+func WatermarkDecode(ctx *gin.Context) error {
+	var req entity.WatermarkDecodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		logger.WithContext(ctx).Warnf("[WatermarkDecode] 参数绑定失败: %v", err)
+		return RespJsonError(ctx, 1001, "参数绑定失败")
+	}
+
+	result, err := service.NewWatermark(ctx).Decode(&req)
+	if errors.Is(err, service.ErrWatermarkUserNotFound) {
+		return RespJsonError(ctx, 1004, err.Error())
+	}
+	if errors.Is(err, service.ErrWatermarkIncomplete) {
+		return RespJsonError(ctx, 1002, err.Error())
+	}
+	if err != nil {
+		logger.WithContext(ctx).Warnf("[WatermarkDecode] 解码水印失败: %v", err)
+		return RespJsonError(ctx, 1003, err.Error())
+	}
+	logger.WithContext(ctx).Infof("[WatermarkDecode] 解码水印成功, user_id: %s, code: %s, observed: %d, conflicts: %d",
+		result.UserID, result.Code, result.Observed, result.Conflicts)
+	return RespJsonSuccess(ctx, result)
+}
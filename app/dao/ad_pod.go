@@ -0,0 +1,125 @@
+package dao
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aldge/cine_stream/app/entity"
+	"gorm.io/gorm"
+)
+
+const (
+	adPodTableName     = "cine_ad_pod"     // 广告组表名
+	adSegmentTableName = "cine_ad_segment" // 广告切片表名
+)
+
+// AdPod 广告组数据访问对象
+type AdPod struct {
+	ctx context.Context
+	db  *gorm.DB
+}
+
+// NewAdPod 创建广告组数据访问对象
+func NewAdPod(ctx context.Context) *AdPod {
+	ap := &AdPod{
+		ctx: ctx,
+	}
+	dbName := getAppDBName(ctx, videoTsDBName)
+	ap.db = GetDB(dbName)
+	// 如果找不到带 app 后缀的数据库配置，回退到默认数据库配置
+	if ap.db == nil && dbName != videoTsDBName {
+		ap.db = GetDB(videoTsDBName)
+	}
+	return ap
+}
+
+// SaveWithSegments 保存广告组并替换它的全部切片，ad_pod_id 不存在时返回 ErrRecordNotFound
+func (ap *AdPod) SaveWithSegments(pod *entity.AdPodEntity, segments []*entity.AdSegmentEntity) error {
+	if len(segments) == 0 {
+		return ErrInvalidParam
+	}
+	if ap.db == nil {
+		return ErrDBConfNotFound
+	}
+	return ap.db.Transaction(func(tx *gorm.DB) error {
+		if pod.AdPodID == 0 {
+			if err := tx.Table(adPodTableName).Create(pod).Error; err != nil {
+				return err
+			}
+		} else {
+			var exist entity.AdPodEntity
+			err := tx.Table(adPodTableName).Where("ad_pod_id = ?", pod.AdPodID).First(&exist).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRecordNotFound
+			}
+			if err != nil {
+				return err
+			}
+			pod.CreateTime = exist.CreateTime
+			if err = tx.Table(adPodTableName).Save(pod).Error; err != nil {
+				return err
+			}
+		}
+
+		err := tx.Table(adSegmentTableName).
+			Where("ad_pod_id = ?", pod.AdPodID).
+			Delete(&entity.AdSegmentEntity{}).Error
+		if err != nil {
+			return err
+		}
+		for _, segment := range segments {
+			segment.AdPodID = pod.AdPodID
+		}
+		return tx.Table(adSegmentTableName).CreateInBatches(segments, 100).Error
+	})
+}
+
+// GetList 查询所有广告组
+func (ap *AdPod) GetList() ([]entity.AdPodEntity, error) {
+	if ap.db == nil {
+		return nil, ErrDBConfNotFound
+	}
+	var podList []entity.AdPodEntity
+	err := ap.db.Table(adPodTableName).Order("ad_pod_id ASC").Find(&podList).Error
+	if err != nil {
+		return nil, err
+	}
+	return podList, nil
+}
+
+// GetEnabledByIDs 查询启用的广告组
+func (ap *AdPod) GetEnabledByIDs(podIDs []uint64) ([]entity.AdPodEntity, error) {
+	if len(podIDs) == 0 {
+		return nil, nil
+	}
+	if ap.db == nil {
+		return nil, ErrDBConfNotFound
+	}
+	var podList []entity.AdPodEntity
+	err := ap.db.Table(adPodTableName).
+		Where("ad_pod_id IN ? AND status = ?", podIDs, entity.AdPodStatusEnabled).
+		Find(&podList).Error
+	if err != nil {
+		return nil, err
+	}
+	return podList, nil
+}
+
+// GetSegmentsByPodIDs 查询广告组的切片（按广告组、序号排序）
+func (ap *AdPod) GetSegmentsByPodIDs(podIDs []uint64) ([]entity.AdSegmentEntity, error) {
+	if len(podIDs) == 0 {
+		return nil, nil
+	}
+	if ap.db == nil {
+		return nil, ErrDBConfNotFound
+	}
+	var segmentList []entity.AdSegmentEntity
+	err := ap.db.Table(adSegmentTableName).
+		Where("ad_pod_id IN ?", podIDs).
+		Order("ad_pod_id ASC, sequence ASC").
+		Find(&segmentList).Error
+	if err != nil {
+		return nil, err
+	}
+	return segmentList, nil
+}
@@ -0,0 +1,124 @@
+package dao
+
+import (
+	"context"
+
+	"github.com/aldge/cine_stream/app/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	qoeStatTableName = "cine_qoe_stat" // 播放质量汇总表名
+	// qoeStatReportMaxRows 查询播放质量时最多返回的行数
+	qoeStatReportMaxRows = 1000
+	// qoeStatBatchSize 批量写入汇总结果时每条 SQL 的行数
+	qoeStatBatchSize = 500
+)
+
+// QoEStat 播放质量汇总数据访问对象
+type QoEStat struct {
+	ctx context.Context
+	db  *gorm.DB
+}
+
+// NewQoEStat 创建播放质量汇总数据访问对象
+// 后台汇总任务没有请求上下文，按参数 appName 选择数据库，为空时使用默认数据库
+func NewQoEStat(ctx context.Context, appName string) *QoEStat {
+	qs := &QoEStat{
+		ctx: ctx,
+	}
+	dbName := videoTsDBName
+	if appName != "" {
+		dbName = videoTsDBName + "_" + appName
+	}
+	qs.db = GetDB(dbName)
+	// 如果找不到带 app 后缀的数据库配置，回退到默认数据库配置
+	if qs.db == nil && dbName != videoTsDBName {
+		qs.db = GetDB(videoTsDBName)
+	}
+	return qs
+}
+
+// BatchIncrement 把多个时间段的汇总结果累加到数据库，记录不存在时新增
+// 按 qoeStatBatchSize 行一条 INSERT ... ON DUPLICATE KEY UPDATE 写入，所有行在一个事务中，失败时都不写入；
+// 各计数累加，最长起播耗时取较大值；多个实例同时写入同一时间段时结果仍然正确
+func (qs *QoEStat) BatchIncrement(stats []*entity.QoEStatEntity) error {
+	if len(stats) == 0 {
+		return nil
+	}
+	for _, stat := range stats {
+		if stat.BucketTime <= 0 || stat.VideoID == "" {
+			return ErrInvalidParam
+		}
+	}
+	if qs.db == nil {
+		return ErrDBConfNotFound
+	}
+	updates := []clause.Assignment{{
+		Column: clause.Column{Name: "startup_ms_max"},
+		Value:  gorm.Expr("GREATEST(startup_ms_max, VALUES(startup_ms_max))"),
+	}, {
+		Column: clause.Column{Name: "update_time"},
+		Value:  gorm.Expr("VALUES(update_time)"),
+	}}
+	for _, column := range []string{"plays", "startup_ms_total", "rebuffers", "rebuffer_ms_total", "watch_ms_total",
+		"bitrate_switches", "bitrate_total", "bitrate_samples", "errors"} {
+		updates = append(updates, clause.Assignment{
+			Column: clause.Column{Name: column},
+			Value:  gorm.Expr(column + " + VALUES(" + column + ")"),
+		})
+	}
+	return qs.db.Transaction(func(tx *gorm.DB) error {
+		return tx.Table(qoeStatTableName).
+			Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "bucket_time"}, {Name: "app"}, {Name: "video_id"}, {Name: "cdn"}},
+				DoUpdates: updates,
+			}).
+			CreateInBatches(stats, qoeStatBatchSize).Error
+	})
+}
+
+// Report 按查询条件汇总播放质量，按时间段分组时按时间升序，其它分组按起播次数倒序，最多返回 1000 行
+// 返回的每行只有分组字段和各计数的合计，最长起播耗时为各时间段的最大值
+func (qs *QoEStat) Report(query *entity.QoEReportQuery) ([]entity.QoEStatEntity, error) {
+	if query.StartTime <= 0 || query.EndTime <= query.StartTime {
+		return nil, ErrInvalidParam
+	}
+	if qs.db == nil {
+		return nil, ErrDBConfNotFound
+	}
+	var groupColumn, order string
+	switch query.GroupBy {
+	case entity.QoEGroupByBucket, "":
+		groupColumn, order = "bucket_time", "bucket_time ASC"
+	case entity.QoEGroupByVideo:
+		groupColumn, order = "video_id", "plays DESC, video_id ASC"
+	case entity.QoEGroupByCDN:
+		groupColumn, order = "cdn", "plays DESC, cdn ASC"
+	default:
+		return nil, ErrInvalidParam
+	}
+
+	db := qs.db.Table(qoeStatTableName).
+		Select(groupColumn+", SUM(plays) AS plays, SUM(startup_ms_total) AS startup_ms_total, "+
+			"MAX(startup_ms_max) AS startup_ms_max, SUM(rebuffers) AS rebuffers, SUM(rebuffer_ms_total) AS rebuffer_ms_total, "+
+			"SUM(watch_ms_total) AS watch_ms_total, SUM(bitrate_switches) AS bitrate_switches, "+
+			"SUM(bitrate_total) AS bitrate_total, SUM(bitrate_samples) AS bitrate_samples, SUM(errors) AS errors").
+		Where("app = ? AND bucket_time >= ? AND bucket_time < ?", query.App, query.StartTime, query.EndTime)
+	if query.VideoID != "" {
+		db = db.Where("video_id = ?", query.VideoID)
+	}
+	if query.CDN != "" {
+		db = db.Where("cdn = ?", query.CDN)
+	}
+	var stats []entity.QoEStatEntity
+	err := db.Group(groupColumn).
+		Order(order).
+		Limit(qoeStatReportMaxRows).
+		Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
@@ -0,0 +1,39 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"github.com/aldge/cine_stream/config"
+	"github.com/aldge/cine_stream/logger"
+	"github.com/redis/go-redis/v9"
+)
+
+var redisClient *redis.Client
+
+// InitRedis 初始化 Redis 客户端，没有配置地址时不初始化
+func InitRedis() {
+	redisConf := config.GetAppConf().Redis
+	if redisConf.Addr == "" {
+		return
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr:         redisConf.Addr,
+		Password:     redisConf.Password,
+		DB:           redisConf.DB,
+		DialTimeout:  time.Second,
+		ReadTimeout:  500 * time.Millisecond,
+		WriteTimeout: 500 * time.Millisecond,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		logger.Fatalf("[InitRedis] addr=%s conn err=%+v", redisConf.Addr, err)
+	}
+	redisClient = client
+}
+
+// GetRedis 获取 Redis 客户端，没有配置 Redis 时返回 nil
+func GetRedis() *redis.Client {
+	return redisClient
+}
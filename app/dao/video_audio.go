@@ -0,0 +1,126 @@
+package dao
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aldge/cine_stream/app/entity"
+	"gorm.io/gorm"
+)
+
+const (
+	videoAudioTableName = "cine_video_audio" // 音轨表名
+)
+
+// VideoAudio 音轨数据访问对象
+type VideoAudio struct {
+	ctx context.Context
+	db  *gorm.DB
+}
+
+// NewVideoAudio 创建音轨数据访问对象
+func NewVideoAudio(ctx context.Context) *VideoAudio {
+	va := &VideoAudio{
+		ctx: ctx,
+	}
+	dbName := getAppDBName(ctx, videoTsDBName)
+	va.db = GetDB(dbName)
+	// 如果找不到带 app 后缀的数据库配置，回退到默认数据库配置
+	if va.db == nil && dbName != videoTsDBName {
+		va.db = GetDB(videoTsDBName)
+	}
+	return va
+}
+
+// Save 保存音轨，同一视频 definition 相同的音轨已存在时更新；设为默认时取消该视频其他音轨的默认
+func (va *VideoAudio) Save(audio *entity.VideoAudioEntity) error {
+	if audio.VideoID == "" || audio.Definition == "" {
+		return ErrInvalidParam
+	}
+	if va.db == nil {
+		return ErrDBConfNotFound
+	}
+	return va.db.Transaction(func(tx *gorm.DB) error {
+		return saveAudio(tx, audio)
+	})
+}
+
+// Replace 在一个事务中保存音轨，并用 tsList、encryptList 替换音轨原有的切片和只作用于该音轨的加密信息
+// 切片表、加密信息表和音轨表在同一个数据库；任一步失败时全部回滚，不会留下删了旧切片却没有新切片的音轨
+func (va *VideoAudio) Replace(audio *entity.VideoAudioEntity, tsList []*entity.VideoTSEntity, encryptList []*entity.VideoEncryptEntity) error {
+	if audio.VideoID == "" || audio.Definition == "" || len(tsList) == 0 {
+		return ErrInvalidParam
+	}
+	if va.db == nil {
+		return ErrDBConfNotFound
+	}
+	tsTableName := NewVideoTS(va.ctx).getTableName(audio.VideoID)
+	return va.db.Transaction(func(tx *gorm.DB) error {
+		if err := saveAudio(tx, audio); err != nil {
+			return err
+		}
+		err := tx.Table(tsTableName).
+			Where("video_id = ? AND definition = ?", audio.VideoID, audio.Definition).
+			Delete(&entity.VideoTSEntity{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Table(videoEncryptTableName).
+			Where("video_id = ? AND definition = ?", audio.VideoID, audio.Definition).
+			Delete(&entity.VideoEncryptEntity{}).Error
+		if err != nil {
+			return err
+		}
+		if err = tx.Table(tsTableName).CreateInBatches(tsList, 100).Error; err != nil {
+			return err
+		}
+		if len(encryptList) == 0 {
+			return nil
+		}
+		return tx.Table(videoEncryptTableName).CreateInBatches(encryptList, 100).Error
+	})
+}
+
+// saveAudio 在事务中保存音轨，同一视频 definition 相同的音轨已存在时更新；设为默认时取消该视频其他音轨的默认
+func saveAudio(tx *gorm.DB, audio *entity.VideoAudioEntity) error {
+	var exist entity.VideoAudioEntity
+	err := tx.Table(videoAudioTableName).
+		Where("video_id = ? AND definition = ?", audio.VideoID, audio.Definition).
+		First(&exist).Error
+	switch {
+	case err == nil:
+		audio.VideoAudioID = exist.VideoAudioID
+		audio.CreateTime = exist.CreateTime
+		err = tx.Table(videoAudioTableName).Save(audio).Error
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		err = tx.Table(videoAudioTableName).Create(audio).Error
+	}
+	if err != nil {
+		return err
+	}
+	if !audio.IsDefault {
+		return nil
+	}
+	return tx.Table(videoAudioTableName).
+		Where("video_id = ? AND video_audio_id <> ?", audio.VideoID, audio.VideoAudioID).
+		Update("is_default", false).Error
+}
+
+// GetListByVideoID 查询视频的所有音轨（默认音轨在前）
+func (va *VideoAudio) GetListByVideoID(videoID string) ([]entity.VideoAudioEntity, error) {
+	if videoID == "" {
+		return nil, ErrInvalidParam
+	}
+	if va.db == nil {
+		return nil, ErrDBConfNotFound
+	}
+	var audioList []entity.VideoAudioEntity
+	err := va.db.Table(videoAudioTableName).
+		Where("video_id = ?", videoID).
+		Order("is_default DESC, video_audio_id ASC").
+		Find(&audioList).Error
+	if err != nil {
+		return nil, err
+	}
+	return audioList, nil
+}
@@ -53,6 +53,31 @@ func (ve *VideoEncrypt) BatchInsert(encryptList []*entity.VideoEncryptEntity) er
 	return ve.db.Table(videoEncryptTableName).CreateInBatches(encryptList, 100).Error
 }
 
+// BatchSave 批量保存视频加密信息，同时结束被新区间接替的未结束区间（closeList 中的 end_sequence）
+// 两者在一个事务中完成，不会出现新旧区间同时作用于同一切片
+func (ve *VideoEncrypt) BatchSave(encryptList []*entity.VideoEncryptEntity, closeList []*entity.VideoEncryptEntity) error {
+	if len(encryptList) == 0 && len(closeList) == 0 {
+		return ErrInvalidParam
+	}
+	if ve.db == nil {
+		return ErrDBConfNotFound
+	}
+	return ve.db.Transaction(func(tx *gorm.DB) error {
+		for _, encrypt := range closeList {
+			err := tx.Table(videoEncryptTableName).
+				Where("video_encrypt_id = ?", encrypt.VideoEncryptID).
+				Update("end_sequence", encrypt.EndSequence).Error
+			if err != nil {
+				return err
+			}
+		}
+		if len(encryptList) == 0 {
+			return nil
+		}
+		return tx.Table(videoEncryptTableName).CreateInBatches(encryptList, 100).Error
+	})
+}
+
 // GetByVideoID 根据video_id查询视频加密信息列表
 func (ve *VideoEncrypt) GetByVideoID(videoID string) (*entity.VideoEncryptEntity, error) {
 	if videoID == "" {
@@ -69,6 +94,43 @@ func (ve *VideoEncrypt) GetByVideoID(videoID string) (*entity.VideoEncryptEntity
 	return &encrypt, nil
 }
 
+// GetListByVideoID 根据video_id查询视频所有的加密信息（按起始TS序号排序）
+func (ve *VideoEncrypt) GetListByVideoID(videoID string) ([]entity.VideoEncryptEntity, error) {
+	if videoID == "" {
+		return nil, ErrInvalidParam
+	}
+	if ve.db == nil {
+		return nil, ErrDBConfNotFound
+	}
+	var encryptList []entity.VideoEncryptEntity
+	err := ve.db.Table(videoEncryptTableName).
+		Where("video_id = ?", videoID).
+		Order("start_sequence ASC, video_encrypt_id ASC").
+		Find(&encryptList).Error
+	if err != nil {
+		return nil, err
+	}
+	return encryptList, nil
+}
+
+// GetByID 根据video_id和video_encrypt_id查询单个加密信息
+func (ve *VideoEncrypt) GetByID(videoID string, videoEncryptID uint64) (*entity.VideoEncryptEntity, error) {
+	if videoID == "" || videoEncryptID == 0 {
+		return nil, ErrInvalidParam
+	}
+	if ve.db == nil {
+		return nil, ErrDBConfNotFound
+	}
+	var encrypt = entity.VideoEncryptEntity{}
+	err := ve.db.Table(videoEncryptTableName).
+		Where("video_id = ? AND video_encrypt_id = ?", videoID, videoEncryptID).
+		First(&encrypt).Error
+	if err != nil {
+		return nil, err
+	}
+	return &encrypt, nil
+}
+
 // DeleteByVideoID 删除指定视频的加密信息
 func (ve *VideoEncrypt) DeleteByVideoID(videoID string) error {
 	if videoID == "" {
@@ -0,0 +1,75 @@
+package dao
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aldge/cine_stream/app/entity"
+	"gorm.io/gorm"
+)
+
+const (
+	videoLiveTableName = "cine_video_live" // 直播信息表名
+)
+
+// VideoLive 直播信息数据访问对象
+type VideoLive struct {
+	ctx context.Context
+	db  *gorm.DB
+}
+
+// NewVideoLive 创建直播信息数据访问对象
+func NewVideoLive(ctx context.Context) *VideoLive {
+	vl := &VideoLive{
+		ctx: ctx,
+	}
+	dbName := getAppDBName(ctx, videoTsDBName)
+	vl.db = GetDB(dbName)
+	// 如果找不到带 app 后缀的数据库配置，回退到默认数据库配置
+	if vl.db == nil && dbName != videoTsDBName {
+		vl.db = GetDB(videoTsDBName)
+	}
+	return vl
+}
+
+// Insert 保存直播信息
+func (vl *VideoLive) Insert(live *entity.VideoLiveEntity) error {
+	if live.VideoID == "" {
+		return ErrInvalidParam
+	}
+	if vl.db == nil {
+		return ErrDBConfNotFound
+	}
+	return vl.db.Table(videoLiveTableName).Create(live).Error
+}
+
+// GetByVideoID 根据video_id查询直播信息，不是直播时返回 ErrRecordNotFound
+func (vl *VideoLive) GetByVideoID(videoID string) (*entity.VideoLiveEntity, error) {
+	if videoID == "" {
+		return nil, ErrInvalidParam
+	}
+	if vl.db == nil {
+		return nil, ErrDBConfNotFound
+	}
+	var live = entity.VideoLiveEntity{}
+	err := vl.db.Table(videoLiveTableName).Where("video_id = ?", videoID).First(&live).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRecordNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &live, nil
+}
+
+// UpdateStatus 更新直播状态
+func (vl *VideoLive) UpdateStatus(videoID string, status int, updateTime int64) error {
+	if videoID == "" {
+		return ErrInvalidParam
+	}
+	if vl.db == nil {
+		return ErrDBConfNotFound
+	}
+	return vl.db.Table(videoLiveTableName).Where("video_id = ?", videoID).
+		Updates(map[string]interface{}{"status": status, "update_time": updateTime}).Error
+}
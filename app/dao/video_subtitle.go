@@ -0,0 +1,166 @@
+package dao
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aldge/cine_stream/app/entity"
+	"gorm.io/gorm"
+)
+
+const (
+	videoSubtitleTableName        = "cine_video_subtitle"         // 字幕轨道表名
+	videoSubtitleSegmentTableName = "cine_video_subtitle_segment" // 字幕切片表名
+)
+
+// VideoSubtitle 字幕数据访问对象
+type VideoSubtitle struct {
+	ctx context.Context
+	db  *gorm.DB
+}
+
+// NewVideoSubtitle 创建字幕数据访问对象
+func NewVideoSubtitle(ctx context.Context) *VideoSubtitle {
+	vs := &VideoSubtitle{
+		ctx: ctx,
+	}
+	dbName := getAppDBName(ctx, videoTsDBName)
+	vs.db = GetDB(dbName)
+	// 如果找不到带 app 后缀的数据库配置，回退到默认数据库配置
+	if vs.db == nil && dbName != videoTsDBName {
+		vs.db = GetDB(videoTsDBName)
+	}
+	return vs
+}
+
+// SaveWithSegments 保存字幕轨道并替换它的全部切片
+// 同一视频 language + forced 相同的轨道已存在时更新；设为默认时取消该视频其他轨道的默认
+func (vs *VideoSubtitle) SaveWithSegments(subtitle *entity.VideoSubtitleEntity, segments []*entity.VideoSubtitleSegmentEntity) error {
+	if subtitle.VideoID == "" || len(segments) == 0 {
+		return ErrInvalidParam
+	}
+	if vs.db == nil {
+		return ErrDBConfNotFound
+	}
+	return vs.db.Transaction(func(tx *gorm.DB) error {
+		var exist entity.VideoSubtitleEntity
+		err := tx.Table(videoSubtitleTableName).
+			Where("video_id = ? AND language = ? AND is_forced = ?", subtitle.VideoID, subtitle.Language, subtitle.IsForced).
+			First(&exist).Error
+		switch {
+		case err == nil:
+			subtitle.VideoSubtitleID = exist.VideoSubtitleID
+			subtitle.CreateTime = exist.CreateTime
+			if err = tx.Table(videoSubtitleTableName).Save(subtitle).Error; err != nil {
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err = tx.Table(videoSubtitleTableName).Create(subtitle).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		if subtitle.IsDefault {
+			err = tx.Table(videoSubtitleTableName).
+				Where("video_id = ? AND video_subtitle_id <> ?", subtitle.VideoID, subtitle.VideoSubtitleID).
+				Update("is_default", false).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		err = tx.Table(videoSubtitleSegmentTableName).
+			Where("video_subtitle_id = ?", subtitle.VideoSubtitleID).
+			Delete(&entity.VideoSubtitleSegmentEntity{}).Error
+		if err != nil {
+			return err
+		}
+		for _, segment := range segments {
+			segment.VideoSubtitleID = subtitle.VideoSubtitleID
+		}
+		return tx.Table(videoSubtitleSegmentTableName).CreateInBatches(segments, 100).Error
+	})
+}
+
+// GetListByVideoID 查询视频的所有字幕轨道（默认轨道在前）
+func (vs *VideoSubtitle) GetListByVideoID(videoID string) ([]entity.VideoSubtitleEntity, error) {
+	if videoID == "" {
+		return nil, ErrInvalidParam
+	}
+	if vs.db == nil {
+		return nil, ErrDBConfNotFound
+	}
+	var subtitleList []entity.VideoSubtitleEntity
+	err := vs.db.Table(videoSubtitleTableName).
+		Where("video_id = ?", videoID).
+		Order("is_default DESC, video_subtitle_id ASC").
+		Find(&subtitleList).Error
+	if err != nil {
+		return nil, err
+	}
+	return subtitleList, nil
+}
+
+// GetByID 查询视频的指定字幕轨道，不存在时返回 ErrRecordNotFound
+func (vs *VideoSubtitle) GetByID(videoID string, subtitleID uint64) (*entity.VideoSubtitleEntity, error) {
+	if videoID == "" || subtitleID == 0 {
+		return nil, ErrInvalidParam
+	}
+	if vs.db == nil {
+		return nil, ErrDBConfNotFound
+	}
+	var subtitle entity.VideoSubtitleEntity
+	err := vs.db.Table(videoSubtitleTableName).
+		Where("video_id = ? AND video_subtitle_id = ?", videoID, subtitleID).
+		First(&subtitle).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRecordNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &subtitle, nil
+}
+
+// GetSegments 查询字幕轨道的所有切片（按序号排序，不查询切片内容）
+func (vs *VideoSubtitle) GetSegments(subtitleID uint64) ([]entity.VideoSubtitleSegmentEntity, error) {
+	if subtitleID == 0 {
+		return nil, ErrInvalidParam
+	}
+	if vs.db == nil {
+		return nil, ErrDBConfNotFound
+	}
+	var segmentList []entity.VideoSubtitleSegmentEntity
+	err := vs.db.Table(videoSubtitleSegmentTableName).
+		Select("video_subtitle_segment_id, video_subtitle_id, video_id, sequence, path, duration, create_time").
+		Where("video_subtitle_id = ?", subtitleID).
+		Order("sequence ASC").
+		Find(&segmentList).Error
+	if err != nil {
+		return nil, err
+	}
+	return segmentList, nil
+}
+
+// GetSegment 查询字幕轨道的单个切片（包含切片内容），不存在时返回 ErrRecordNotFound
+func (vs *VideoSubtitle) GetSegment(videoID string, subtitleID uint64, sequence int64) (*entity.VideoSubtitleSegmentEntity, error) {
+	if videoID == "" || subtitleID == 0 {
+		return nil, ErrInvalidParam
+	}
+	if vs.db == nil {
+		return nil, ErrDBConfNotFound
+	}
+	var segment entity.VideoSubtitleSegmentEntity
+	err := vs.db.Table(videoSubtitleSegmentTableName).
+		Where("video_id = ? AND video_subtitle_id = ? AND sequence = ?", videoID, subtitleID, sequence).
+		First(&segment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRecordNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &segment, nil
+}
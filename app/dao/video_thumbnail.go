@@ -0,0 +1,70 @@
+package dao
+
+import (
+	"context"
+
+	"github.com/aldge/cine_stream/app/entity"
+	"gorm.io/gorm"
+)
+
+const (
+	videoThumbnailTableName = "cine_video_thumbnail" // 缩略图雪碧图表名
+)
+
+// VideoThumbnail 缩略图雪碧图数据访问对象
+type VideoThumbnail struct {
+	ctx context.Context
+	db  *gorm.DB
+}
+
+// NewVideoThumbnail 创建缩略图雪碧图数据访问对象
+func NewVideoThumbnail(ctx context.Context) *VideoThumbnail {
+	vt := &VideoThumbnail{
+		ctx: ctx,
+	}
+	dbName := getAppDBName(ctx, videoTsDBName)
+	vt.db = GetDB(dbName)
+	// 如果找不到带 app 后缀的数据库配置，回退到默认数据库配置
+	if vt.db == nil && dbName != videoTsDBName {
+		vt.db = GetDB(videoTsDBName)
+	}
+	return vt
+}
+
+// Replace 替换视频的全部雪碧图
+func (vt *VideoThumbnail) Replace(videoID string, thumbnails []*entity.VideoThumbnailEntity) error {
+	if videoID == "" || len(thumbnails) == 0 {
+		return ErrInvalidParam
+	}
+	if vt.db == nil {
+		return ErrDBConfNotFound
+	}
+	return vt.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Table(videoThumbnailTableName).
+			Where("video_id = ?", videoID).
+			Delete(&entity.VideoThumbnailEntity{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Table(videoThumbnailTableName).CreateInBatches(thumbnails, 100).Error
+	})
+}
+
+// GetListByVideoID 查询视频的所有雪碧图（按序号排序）
+func (vt *VideoThumbnail) GetListByVideoID(videoID string) ([]entity.VideoThumbnailEntity, error) {
+	if videoID == "" {
+		return nil, ErrInvalidParam
+	}
+	if vt.db == nil {
+		return nil, ErrDBConfNotFound
+	}
+	var thumbnailList []entity.VideoThumbnailEntity
+	err := vt.db.Table(videoThumbnailTableName).
+		Where("video_id = ?", videoID).
+		Order("sequence ASC").
+		Find(&thumbnailList).Error
+	if err != nil {
+		return nil, err
+	}
+	return thumbnailList, nil
+}
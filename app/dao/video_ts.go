@@ -79,6 +79,78 @@ func (vs *VideoTS) GetByVideoID(videoID string, definitions string) ([]entity.Vi
 	return tsList, nil
 }
 
+// GetByVideoDefinition 根据视频ID和清晰度获取TS切片列表（清晰度精确匹配，包括空清晰度）
+func (vs *VideoTS) GetByVideoDefinition(videoID string, definition string) ([]entity.VideoTSEntity, error) {
+	if videoID == "" {
+		return nil, ErrInvalidParam
+	}
+	if vs.db == nil {
+		return nil, ErrDBConfNotFound
+	}
+
+	var tsList []entity.VideoTSEntity
+	err := vs.db.Table(vs.getTableName(videoID)).
+		Where("video_id = ? AND definition = ?", videoID, definition).
+		Order("ts_sequence ASC").
+		Find(&tsList).Error
+	if err != nil {
+		return nil, err
+	}
+	return tsList, nil
+}
+
+// GetLastByVideoDefinition 获取视频某个清晰度最新的 limit 个TS切片（按序号升序返回）
+func (vs *VideoTS) GetLastByVideoDefinition(videoID string, definition string, limit int) ([]entity.VideoTSEntity, error) {
+	if videoID == "" || limit <= 0 {
+		return nil, ErrInvalidParam
+	}
+	if vs.db == nil {
+		return nil, ErrDBConfNotFound
+	}
+
+	var tsList []entity.VideoTSEntity
+	err := vs.db.Table(vs.getTableName(videoID)).
+		Where("video_id = ? AND definition = ?", videoID, definition).
+		Order("ts_sequence DESC").
+		Limit(limit).
+		Find(&tsList).Error
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(tsList)-1; i < j; i, j = i+1, j-1 {
+		tsList[i], tsList[j] = tsList[j], tsList[i]
+	}
+	return tsList, nil
+}
+
+// GetDefinitionStats 按清晰度统计指定视频的TS切片
+func (vs *VideoTS) GetDefinitionStats(videoID string) ([]entity.VideoTSDefinitionStat, error) {
+	if videoID == "" {
+		return nil, ErrInvalidParam
+	}
+	if vs.db == nil {
+		return nil, ErrDBConfNotFound
+	}
+
+	var statList []entity.VideoTSDefinitionStat
+	err := vs.db.Table(vs.getTableName(videoID)).
+		Select("definition, COUNT(*) AS ts_count, "+
+			"COALESCE(SUM(duration), 0) AS total_duration, "+
+			"COALESCE(SUM(ts_size), 0) AS total_size, "+
+			"COALESCE(MIN(ts_size), 0) AS min_size, "+
+			"COALESCE(MAX(ts_size * 8 / duration), 0) AS peak_bitrate, "+
+			"MAX(codecs) AS codecs, "+
+			"COALESCE(SUM(CASE WHEN keyframes IS NULL OR keyframes = '' THEN 0 ELSE 1 END), 0) AS keyframe_count").
+		Where("video_id = ?", videoID).
+		Group("definition").
+		Order("definition ASC").
+		Scan(&statList).Error
+	if err != nil {
+		return nil, err
+	}
+	return statList, nil
+}
+
 // DeleteByVideoID 删除指定视频的所有TS切片
 func (vs *VideoTS) DeleteByVideoID(videoID string) error {
 	if videoID == "" {
@@ -106,3 +178,16 @@ func (vs *VideoTS) GetCountByVideoID(videoID string) (int64, error) {
 	}
 	return count, nil
 }
+
+// UpdateKeyframes 更新切片的关键帧信息
+func (vs *VideoTS) UpdateKeyframes(videoID, definition string, tsSequence int64, keyframes string) error {
+	if videoID == "" {
+		return ErrInvalidParam
+	}
+	if vs.db == nil {
+		return ErrDBConfNotFound
+	}
+	return vs.db.Table(vs.getTableName(videoID)).
+		Where("video_id = ? AND definition = ? AND ts_sequence = ?", videoID, definition, tsSequence).
+		Update("keyframes", keyframes).Error
+}
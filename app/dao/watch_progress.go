@@ -0,0 +1,96 @@
+package dao
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aldge/cine_stream/app/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	watchProgressTableName = "cine_watch_progress" // 观看进度表名
+)
+
+// WatchProgress 观看进度数据访问对象
+type WatchProgress struct {
+	ctx context.Context
+	db  *gorm.DB
+}
+
+// NewWatchProgress 创建观看进度数据访问对象
+func NewWatchProgress(ctx context.Context) *WatchProgress {
+	wp := &WatchProgress{
+		ctx: ctx,
+	}
+	dbName := getAppDBName(ctx, videoTsDBName)
+	wp.db = GetDB(dbName)
+	// 如果找不到带 app 后缀的数据库配置，回退到默认数据库配置
+	if wp.db == nil && dbName != videoTsDBName {
+		wp.db = GetDB(videoTsDBName)
+	}
+	return wp
+}
+
+// Save 保存观看进度，用户的视频已有进度时更新位置、时长和上报时间；上报的影片 ID 为 0 时保留原来的影片 ID
+func (wp *WatchProgress) Save(progress *entity.WatchProgressEntity) error {
+	if progress.UserID == "" || progress.VideoID == "" {
+		return ErrInvalidParam
+	}
+	if wp.db == nil {
+		return ErrDBConfNotFound
+	}
+	updates := clause.AssignmentColumns([]string{"position", "duration", "update_time"})
+	updates = append(updates, clause.Assignment{
+		Column: clause.Column{Name: "vod_id"},
+		Value:  gorm.Expr("IF(VALUES(vod_id) > 0, VALUES(vod_id), vod_id)"),
+	})
+	return wp.db.Table(watchProgressTableName).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "video_id"}},
+			DoUpdates: updates,
+		}).
+		Create(progress).Error
+}
+
+// Get 查询用户某个视频的观看进度
+func (wp *WatchProgress) Get(userID, videoID string) (*entity.WatchProgressEntity, error) {
+	if userID == "" || videoID == "" {
+		return nil, ErrInvalidParam
+	}
+	if wp.db == nil {
+		return nil, ErrDBConfNotFound
+	}
+	var progress entity.WatchProgressEntity
+	err := wp.db.Table(watchProgressTableName).
+		Where("user_id = ? AND video_id = ?", userID, videoID).
+		First(&progress).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRecordNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &progress, nil
+}
+
+// GetRecentListByUserID 查询用户最近的观看进度（按最后上报时间倒序），最多 limit 条
+func (wp *WatchProgress) GetRecentListByUserID(userID string, limit int) ([]entity.WatchProgressEntity, error) {
+	if userID == "" || limit <= 0 {
+		return nil, ErrInvalidParam
+	}
+	if wp.db == nil {
+		return nil, ErrDBConfNotFound
+	}
+	var progressList []entity.WatchProgressEntity
+	err := wp.db.Table(watchProgressTableName).
+		Where("user_id = ?", userID).
+		Order("update_time DESC, watch_progress_id DESC").
+		Limit(limit).
+		Find(&progressList).Error
+	if err != nil {
+		return nil, err
+	}
+	return progressList, nil
+}
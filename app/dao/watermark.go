@@ -0,0 +1,63 @@
+package dao
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aldge/cine_stream/app/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	watermarkUserTableName = "cine_watermark_user" // A/B 水印用户表名
+)
+
+// WatermarkUser A/B 水印用户数据访问对象
+type WatermarkUser struct {
+	ctx context.Context
+	db  *gorm.DB
+}
+
+// NewWatermarkUser 创建 A/B 水印用户数据访问对象
+func NewWatermarkUser(ctx context.Context) *WatermarkUser {
+	wu := &WatermarkUser{
+		ctx: ctx,
+	}
+	dbName := getAppDBName(ctx, videoTsDBName)
+	wu.db = GetDB(dbName)
+	// 如果找不到带 app 后缀的数据库配置，回退到默认数据库配置
+	if wu.db == nil && dbName != videoTsDBName {
+		wu.db = GetDB(videoTsDBName)
+	}
+	return wu
+}
+
+// Save 保存用户的水印码，水印码已存在时不修改
+func (wu *WatermarkUser) Save(user *entity.WatermarkUserEntity) error {
+	if user.UserID == "" {
+		return ErrInvalidParam
+	}
+	if wu.db == nil {
+		return ErrDBConfNotFound
+	}
+	return wu.db.Table(watermarkUserTableName).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(user).Error
+}
+
+// GetByCode 根据水印码查询用户
+func (wu *WatermarkUser) GetByCode(code uint64) (*entity.WatermarkUserEntity, error) {
+	if wu.db == nil {
+		return nil, ErrDBConfNotFound
+	}
+	var user entity.WatermarkUserEntity
+	err := wu.db.Table(watermarkUserTableName).Where("code = ?", code).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRecordNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
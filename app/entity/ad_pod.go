@@ -0,0 +1,50 @@
+package entity
+
+// 广告组状态
+const (
+	AdPodStatusEnabled  = 1 // 启用
+	AdPodStatusDisabled = 2 // 停用
+)
+
+// 广告位
+const (
+	AdBreakPositionPre  = "pre"  // 片头广告
+	AdBreakPositionMid  = "mid"  // 中插广告
+	AdBreakPositionPost = "post" // 片尾广告
+)
+
+// AdPodEntity 广告组实体，一个广告组包含按顺序播放的若干广告切片
+// 对应数据库表 cine_ad_pod
+// 详细字段说明请参考 docs/video.sql
+type AdPodEntity struct {
+	AdPodID    uint64 `gorm:"column:ad_pod_id;primaryKey;autoIncrement" json:"ad_pod_id"`
+	Name       string `gorm:"column:name;size:64;not null" json:"name"`
+	Status     int    `gorm:"column:status;not null" json:"status"`
+	CreateTime int64  `gorm:"column:create_time;not null" json:"create_time"`
+	UpdateTime int64  `gorm:"column:update_time;not null" json:"update_time"`
+}
+
+// AdSegmentEntity 广告切片实体，广告切片为不加密的 MPEG-TS
+// 对应数据库表 cine_ad_segment
+type AdSegmentEntity struct {
+	AdSegmentID uint64  `gorm:"column:ad_segment_id;primaryKey;autoIncrement" json:"ad_segment_id"`
+	AdPodID     uint64  `gorm:"column:ad_pod_id;not null" json:"ad_pod_id"`
+	Sequence    int64   `gorm:"column:sequence;not null" json:"sequence"`
+	Path        string  `gorm:"column:path;size:512;not null" json:"path"`
+	Duration    float64 `gorm:"column:duration;not null" json:"duration"`
+	CreateTime  int64   `gorm:"column:create_time;not null" json:"create_time"`
+}
+
+// AdPodSaveRequest 保存广告组请求参数，ad_pod_id 不为 0 时更新该广告组并替换它的全部切片
+type AdPodSaveRequest struct {
+	AdPodID  uint64               `json:"ad_pod_id"`
+	Name     string               `json:"name" binding:"required"`
+	Status   int                  `json:"status"` // 1 启用 2 停用，默认启用
+	Segments []*AdSegmentSaveItem `json:"segments" binding:"required"`
+}
+
+// AdSegmentSaveItem 保存广告组请求参数中的单个广告切片
+type AdSegmentSaveItem struct {
+	Path     string  `json:"path" binding:"required"`
+	Duration float64 `json:"duration" binding:"required"`
+}
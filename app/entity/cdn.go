@@ -0,0 +1,17 @@
+package entity
+
+// CDNStatusRequest 运行时调整 CDN 状态请求参数
+type CDNStatusRequest struct {
+	Name   string `json:"name" binding:"required"` // CDN 配置名
+	Status string `json:"status"`                  // up | down，为空保持不变
+	Weight int    `json:"weight"`                  // 权重，<= 0 保持不变
+}
+
+// CDNStatusItem CDN 当前生效的状态
+type CDNStatusItem struct {
+	Name    string   `json:"name"`
+	URL     string   `json:"url"`
+	Regions []string `json:"regions"`
+	Weight  int      `json:"weight"`
+	Status  string   `json:"status"`
+}
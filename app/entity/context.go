@@ -99,3 +99,30 @@ func ContextValueApplicationName(ctx context.Context) string {
 	applicationName := ctx.Value(consts.BizContextKeyApplicationName)
 	return fmt.Sprintf("%v", applicationName)
 }
+
+// ContextWithLoginPlan context 添加登录用户的套餐
+func ContextWithLoginPlan(ctx context.Context, plan string) context.Context {
+	if ginCtx, ok := ctx.(*gin.Context); ok {
+		ginCtx.Set(consts.BizContextKeyLoginPlan, plan)
+		return ctx
+	}
+	return context.WithValue(ctx, consts.BizContextKeyLoginPlan, plan)
+}
+
+// ContextValueLoginPlan context 获取登录用户的套餐
+func ContextValueLoginPlan(ctx context.Context) string {
+	if ginCtx, ok := ctx.(*gin.Context); ok {
+		return ginCtx.GetString(consts.BizContextKeyLoginPlan)
+	}
+	plan, _ := ctx.Value(consts.BizContextKeyLoginPlan).(string)
+	return plan
+}
+
+// ContextValueLoginUserID context 获取登录用户ID（Passport 用户ID 为字符串）
+func ContextValueLoginUserID(ctx context.Context) string {
+	if ginCtx, ok := ctx.(*gin.Context); ok {
+		return ginCtx.GetString(consts.BizContextKeyLoginAccountID)
+	}
+	userID, _ := ctx.Value(consts.BizContextKeyLoginAccountID).(string)
+	return userID
+}
@@ -0,0 +1,16 @@
+package entity
+
+// PlayHeartbeatRequest 播放心跳请求参数，播放过程中定时上报，续期当前设备的播放会话并保存观看进度
+type PlayHeartbeatRequest struct {
+	Stopped  bool    `json:"stopped"`   // 播放结束（关闭播放器），释放当前设备的播放会话
+	Position float64 `json:"position"`  // 当前播放位置(秒)，为 0 时不保存观看进度
+	Duration float64 `json:"duration"`  // 视频总时长(秒)
+	VodID    int64   `json:"vod_id"`    // 影片 ID（可选），用于继续观看列表
+	KeyToken string  `json:"key_token"` // 当前使用的播放密钥 token（可选），快过期时在结果中返回新 token
+}
+
+// PlayHeartbeatResult 播放心跳结果
+type PlayHeartbeatResult struct {
+	Interval int    `json:"interval"`            // 建议的心跳间隔（秒），为会话过期时间的 1/3
+	KeyToken string `json:"key_token,omitempty"` // 新的播放密钥 token，播放器替换密钥地址中的 token；不需要刷新时没有
+}
@@ -0,0 +1,96 @@
+package entity
+
+// 播放质量事件类型
+const (
+	QoEEventStartup       = "startup"        // 起播：从开始加载到第一次播放的耗时，附带起播码率
+	QoEEventRebuffer      = "rebuffer"       // 卡顿：播放中（非拖动）等待缓冲的时长
+	QoEEventBitrateSwitch = "bitrate_switch" // 码率切换：切换后的码率
+	QoEEventError         = "error"          // 播放失败：不可恢复的错误
+	QoEEventWatch         = "watch"          // 播放时长：两次上报之间实际播放的时长
+)
+
+// QoEBeaconRequest 播放器上报的播放质量事件
+// 播放器使用 navigator.sendBeacon 上报，Content-Type 可能是 text/plain，请求体始终是 JSON
+type QoEBeaconRequest struct {
+	VideoID string           `json:"video_id" binding:"required"`
+	CDNHost string           `json:"cdn_host"` // 切片所在的域名，事件没有单独指定时使用
+	Events  []QoEBeaconEvent `json:"events"`
+}
+
+// QoEBeaconEvent 一个播放质量事件
+type QoEBeaconEvent struct {
+	Type       string `json:"type"`        // 事件类型，见 QoEEventXxx
+	StartupMs  int64  `json:"startup_ms"`  // 起播耗时（毫秒），startup 事件
+	DurationMs int64  `json:"duration_ms"` // 卡顿或播放时长（毫秒），rebuffer 和 watch 事件
+	Bitrate    int64  `json:"bitrate"`     // 码率（bit/s），startup 和 bitrate_switch 事件
+	CDNHost    string `json:"cdn_host"`    // 事件发生时切片所在的域名，为空时使用请求的 cdn_host
+	Error      string `json:"error"`       // 错误描述，error 事件，只记录日志
+}
+
+// QoEEvent 校验后等待汇总的播放质量事件
+type QoEEvent struct {
+	App     string
+	VideoID string
+	CDN     string
+	Time    int64 // 服务端接收时间，按服务端时间划分时间段
+	Type    string
+	Value   int64 // startup/rebuffer/watch 为毫秒，bitrate_switch 为码率
+	Bitrate int64 // startup 事件的起播码率
+}
+
+// QoEStatEntity 播放质量汇总实体，每个时间段、app、视频、CDN 一条记录
+// 对应数据库表 cine_qoe_stat
+// 详细字段说明请参考 docs/video.sql
+type QoEStatEntity struct {
+	QoEStatID       uint64 `gorm:"column:qoe_stat_id;primaryKey;autoIncrement" json:"qoe_stat_id"`
+	BucketTime      int64  `gorm:"column:bucket_time;not null" json:"bucket_time"`
+	App             string `gorm:"column:app;size:64;not null" json:"app"`
+	VideoID         string `gorm:"column:video_id;size:32;not null" json:"video_id"`
+	CDN             string `gorm:"column:cdn;size:128;not null" json:"cdn"`
+	Plays           int64  `gorm:"column:plays;not null" json:"plays"`
+	StartupMsTotal  int64  `gorm:"column:startup_ms_total;not null" json:"startup_ms_total"`
+	StartupMsMax    int64  `gorm:"column:startup_ms_max;not null" json:"startup_ms_max"`
+	Rebuffers       int64  `gorm:"column:rebuffers;not null" json:"rebuffers"`
+	RebufferMsTotal int64  `gorm:"column:rebuffer_ms_total;not null" json:"rebuffer_ms_total"`
+	WatchMsTotal    int64  `gorm:"column:watch_ms_total;not null" json:"watch_ms_total"`
+	BitrateSwitches int64  `gorm:"column:bitrate_switches;not null" json:"bitrate_switches"`
+	BitrateTotal    int64  `gorm:"column:bitrate_total;not null" json:"bitrate_total"`
+	BitrateSamples  int64  `gorm:"column:bitrate_samples;not null" json:"bitrate_samples"`
+	Errors          int64  `gorm:"column:errors;not null" json:"errors"`
+	UpdateTime      int64  `gorm:"column:update_time;not null" json:"update_time"`
+}
+
+// QoEReportQuery 播放质量查询条件
+type QoEReportQuery struct {
+	App       string
+	StartTime int64  // 时间段开始时间 >= StartTime
+	EndTime   int64  // 时间段开始时间 < EndTime
+	VideoID   string // 为空时不限制
+	CDN       string // 为空时不限制
+	GroupBy   string // 分组方式，见 QoEGroupByXxx
+}
+
+// 播放质量查询的分组方式
+const (
+	QoEGroupByBucket = "bucket" // 按时间段
+	QoEGroupByVideo  = "video"  // 按视频
+	QoEGroupByCDN    = "cdn"    // 按 CDN
+)
+
+// QoEReportItem 播放质量查询结果的一行，按分组方式只有 bucket_time、video_id 或 cdn 之一有值
+type QoEReportItem struct {
+	BucketTime      int64   `json:"bucket_time,omitempty"`
+	VideoID         string  `json:"video_id,omitempty"`
+	CDN             string  `json:"cdn,omitempty"`
+	Plays           int64   `json:"plays"`            // 起播次数
+	AvgStartupMs    int64   `json:"avg_startup_ms"`   // 平均起播耗时（毫秒）
+	MaxStartupMs    int64   `json:"max_startup_ms"`   // 最长起播耗时（毫秒）
+	Rebuffers       int64   `json:"rebuffers"`        // 卡顿次数
+	RebufferMs      int64   `json:"rebuffer_ms"`      // 卡顿时长合计（毫秒）
+	RebufferRatio   float64 `json:"rebuffer_ratio"`   // 卡顿率：卡顿时长 / (播放时长 + 卡顿时长)
+	WatchMs         int64   `json:"watch_ms"`         // 播放时长合计（毫秒）
+	BitrateSwitches int64   `json:"bitrate_switches"` // 码率切换次数
+	AvgBitrate      int64   `json:"avg_bitrate"`      // 起播和切换后码率的平均值（bit/s）
+	Errors          int64   `json:"errors"`           // 播放失败次数
+	ErrorRate       float64 `json:"error_rate"`       // 播放失败率：播放失败次数 / (起播次数 + 播放失败次数)，起播前失败的播放没有起播事件
+}
@@ -0,0 +1,36 @@
+package entity
+
+// VideoAudioDefinitionPrefix 音轨切片 definition 的默认前缀，完整形式为 audio-<language>
+const VideoAudioDefinitionPrefix = "audio-"
+
+// VideoAudioEntity 音轨实体，音轨的切片保存在 cine_video_ts 中，definition 与音轨相同
+// 对应数据库表 cine_video_audio
+// 详细字段说明请参考 docs/video.sql
+type VideoAudioEntity struct {
+	VideoAudioID uint64 `gorm:"column:video_audio_id;primaryKey;autoIncrement" json:"video_audio_id"`
+	VideoID      string `gorm:"column:video_id;size:32;not null" json:"video_id"`
+	Definition   string `gorm:"column:definition;size:50;not null" json:"definition"`
+	Language     string `gorm:"column:language;size:35;not null" json:"language"`
+	Name         string `gorm:"column:name;size:64;not null" json:"name"`
+	Channels     int    `gorm:"column:channels;not null" json:"channels"`
+	Codecs       string `gorm:"column:codecs;size:64;not null" json:"codecs"`
+	IsDefault    bool   `gorm:"column:is_default;not null" json:"is_default"`
+	CreateTime   int64  `gorm:"column:create_time;not null" json:"create_time"`
+	UpdateTime   int64  `gorm:"column:update_time;not null" json:"update_time"`
+}
+
+// VideoAudioSaveRequest 保存音轨请求参数，同一视频 definition 相同时覆盖原音轨并替换全部切片
+// Key/IV 只作用于该音轨的切片；Keys 中没有指定清晰度的区间也只作用于该音轨
+type VideoAudioSaveRequest struct {
+	VideoID    string                  `json:"video_id" binding:"required"`
+	Language   string                  `json:"language" binding:"required"`
+	Name       string                  `json:"name"`
+	Channels   int                     `json:"channels"`   // 声道数，默认 2
+	Codecs     string                  `json:"codecs"`     // 编码，默认 mp4a.40.2
+	Default    bool                    `json:"default"`    // 默认音轨
+	Definition string                  `json:"definition"` // 音轨切片的 definition，默认 audio-<language>
+	Key        string                  `json:"key"`
+	IV         string                  `json:"iv"`
+	Keys       []*VideoEncryptSaveItem `json:"keys"`
+	TSData     []*VideoTsSaveDataItem  `json:"ts_data" binding:"required"`
+}
@@ -8,5 +8,28 @@ type VideoEncryptEntity struct {
 	VideoID        string `gorm:"column:video_id;size:32;not null;index" json:"video_id"`
 	Key            string `gorm:"column:key;size:64;not null" json:"key"`
 	IV             string `gorm:"column:iv;size:64;not null" json:"iv"`
+	Definition     string `gorm:"column:definition;size:50;not null" json:"definition"`
+	StartSequence  int64  `gorm:"column:start_sequence;not null" json:"start_sequence"`
+	EndSequence    int64  `gorm:"column:end_sequence;not null" json:"end_sequence"`
 	CreateTime     uint64 `gorm:"column:create_time;not null;index" json:"create_time"`
 }
+
+// Covers 加密信息是否作用于指定清晰度的切片
+func (e *VideoEncryptEntity) Covers(definition string, sequence int64) bool {
+	if e.Definition != "" && e.Definition != definition {
+		return false
+	}
+	if sequence < e.StartSequence {
+		return false
+	}
+	return e.EndSequence < 0 || sequence <= e.EndSequence
+}
+
+// VideoEncryptSaveItem 保存TS切片请求参数中的单个加密区间
+type VideoEncryptSaveItem struct {
+	Key           string `json:"key" binding:"required"`
+	IV            string `json:"iv"`
+	Definition    string `json:"definition"`     // 清晰度，空表示所有清晰度
+	StartSequence int64  `json:"start_sequence"` // 起始TS序号(包含)
+	EndSequence   *int64 `json:"end_sequence"`   // 结束TS序号(包含)，不传或 -1 表示到最后
+}
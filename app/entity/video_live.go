@@ -0,0 +1,52 @@
+package entity
+
+// 直播 m3u8 类型
+const (
+	VideoLivePlaylistTypeLive  = "live"  // 滑动窗口
+	VideoLivePlaylistTypeEvent = "event" // 只追加，EXT-X-PLAYLIST-TYPE:EVENT
+)
+
+// 直播状态
+const (
+	VideoLiveStatusLive  = 1 // 直播中
+	VideoLiveStatusEnded = 2 // 已结束，m3u8 输出 EXT-X-ENDLIST
+)
+
+// VideoLiveEntity 直播信息实体
+// 对应数据库表 cine_video_live
+// 详细字段说明请参考 docs/video.sql
+type VideoLiveEntity struct {
+	VideoLiveID    uint64 `gorm:"column:video_live_id;primaryKey;autoIncrement" json:"video_live_id"`
+	VideoID        string `gorm:"column:video_id;size:32;not null" json:"video_id"`
+	PlaylistType   string `gorm:"column:playlist_type;size:10;not null" json:"playlist_type"`
+	WindowSize     int    `gorm:"column:window_size;not null" json:"window_size"`
+	TargetDuration int    `gorm:"column:target_duration;not null" json:"target_duration"`
+	Status         int    `gorm:"column:status;not null" json:"status"`
+	CreateTime     int64  `gorm:"column:create_time;not null" json:"create_time"`
+	UpdateTime     int64  `gorm:"column:update_time;not null" json:"update_time"`
+}
+
+// IsEnded 直播是否已结束
+func (e *VideoLiveEntity) IsEnded() bool {
+	return e.Status == VideoLiveStatusEnded
+}
+
+// VideoLiveStartRequest 开始直播请求参数
+type VideoLiveStartRequest struct {
+	VideoID        string `json:"video_id" binding:"required"`
+	PlaylistType   string `json:"playlist_type"`   // live | event，默认 live
+	WindowSize     int    `json:"window_size"`     // 滑动窗口切片数，默认 6
+	TargetDuration int    `json:"target_duration"` // EXT-X-TARGETDURATION，0 表示按切片计算
+}
+
+// VideoLiveAppendRequest 直播追加切片请求参数
+type VideoLiveAppendRequest struct {
+	VideoID string                  `json:"video_id" binding:"required"`
+	Keys    []*VideoEncryptSaveItem `json:"keys"` // 新切片的加密区间，可选
+	TSData  []*VideoTsSaveDataItem  `json:"ts_data" binding:"required"`
+}
+
+// VideoLiveFinalizeRequest 结束直播请求参数
+type VideoLiveFinalizeRequest struct {
+	VideoID string `json:"video_id" binding:"required"`
+}
@@ -0,0 +1,58 @@
+package entity
+
+// VideoSubtitleEntity 字幕轨道实体
+// 对应数据库表 cine_video_subtitle
+// 详细字段说明请参考 docs/video.sql
+type VideoSubtitleEntity struct {
+	VideoSubtitleID uint64 `gorm:"column:video_subtitle_id;primaryKey;autoIncrement" json:"video_subtitle_id"`
+	VideoID         string `gorm:"column:video_id;size:32;not null" json:"video_id"`
+	Language        string `gorm:"column:language;size:35;not null" json:"language"`
+	Name            string `gorm:"column:name;size:64;not null" json:"name"`
+	IsDefault       bool   `gorm:"column:is_default;not null" json:"is_default"`
+	IsForced        bool   `gorm:"column:is_forced;not null" json:"is_forced"`
+	CreateTime      int64  `gorm:"column:create_time;not null" json:"create_time"`
+	UpdateTime      int64  `gorm:"column:update_time;not null" json:"update_time"`
+}
+
+// VideoSubtitleSegmentEntity 字幕切片实体
+// 对应数据库表 cine_video_subtitle_segment
+type VideoSubtitleSegmentEntity struct {
+	VideoSubtitleSegmentID uint64  `gorm:"column:video_subtitle_segment_id;primaryKey;autoIncrement" json:"video_subtitle_segment_id"`
+	VideoSubtitleID        uint64  `gorm:"column:video_subtitle_id;not null" json:"video_subtitle_id"`
+	VideoID                string  `gorm:"column:video_id;size:32;not null" json:"video_id"`
+	Sequence               int64   `gorm:"column:sequence;not null" json:"sequence"`
+	Path                   string  `gorm:"column:path;size:255;not null" json:"path"`
+	Duration               float64 `gorm:"column:duration;not null" json:"duration"`
+	Content                string  `gorm:"column:content" json:"-"` // 转换生成的 WebVTT 内容，path 为空时由服务输出
+	CreateTime             int64   `gorm:"column:create_time;not null" json:"create_time"`
+}
+
+// VideoSubtitleSaveRequest 保存字幕轨道请求参数，同一视频的 language + forced 相同时覆盖原轨道
+type VideoSubtitleSaveRequest struct {
+	VideoID  string                      `json:"video_id" binding:"required"`
+	Language string                      `json:"language" binding:"required"`
+	Name     string                      `json:"name"`
+	Default  bool                        `json:"default"`
+	Forced   bool                        `json:"forced"`
+	Segments []*VideoSubtitleSegmentItem `json:"segments" binding:"required"`
+}
+
+// VideoSubtitleSegmentItem 保存字幕轨道请求参数中的单个 WebVTT 切片
+type VideoSubtitleSegmentItem struct {
+	Sequence int64   `json:"sequence"`
+	Path     string  `json:"path" binding:"required"`
+	Duration float64 `json:"duration" binding:"required"`
+}
+
+// VideoSubtitleUploadRequest 上传 SRT/ASS 字幕请求参数（multipart/form-data，字幕文件字段为 file）
+// 字幕转换为 WebVTT 后按视频切片的时长切分，切片序号与视频切片相同
+type VideoSubtitleUploadRequest struct {
+	VideoID    string `form:"video_id" binding:"required"`
+	Language   string `form:"language" binding:"required"`
+	Name       string `form:"name"`
+	Default    bool   `form:"default"`
+	Forced     bool   `form:"forced"`
+	Format     string `form:"format"`     // srt | ass，默认按文件扩展名和内容判断
+	Definition string `form:"definition"` // 按哪个清晰度的切片切分，默认码率最高的清晰度
+	MPEGTS     *int64 `form:"mpegts"`     // X-TIMESTAMP-MAP 的 MPEGTS 值，默认使用配置
+}
@@ -0,0 +1,36 @@
+package entity
+
+// VideoThumbnailEntity 缩略图雪碧图实体，一张雪碧图按 columns x rows 的网格排列 tile_count 张缩略图
+// 对应数据库表 cine_video_thumbnail
+// 详细字段说明请参考 docs/video.sql
+type VideoThumbnailEntity struct {
+	VideoThumbnailID uint64  `gorm:"column:video_thumbnail_id;primaryKey;autoIncrement" json:"video_thumbnail_id"`
+	VideoID          string  `gorm:"column:video_id;size:32;not null" json:"video_id"`
+	Sequence         int64   `gorm:"column:sequence;not null" json:"sequence"`
+	Path             string  `gorm:"column:path;size:512;not null" json:"path"`
+	Columns          int     `gorm:"column:columns;not null" json:"columns"`
+	Rows             int     `gorm:"column:rows;not null" json:"rows"`
+	TileWidth        int     `gorm:"column:tile_width;not null" json:"tile_width"`
+	TileHeight       int     `gorm:"column:tile_height;not null" json:"tile_height"`
+	TileCount        int     `gorm:"column:tile_count;not null" json:"tile_count"`
+	Interval         float64 `gorm:"column:interval;not null" json:"interval"`
+	CreateTime       int64   `gorm:"column:create_time;not null" json:"create_time"`
+}
+
+// VideoThumbnailSaveRequest 保存缩略图雪碧图请求参数，替换视频原有的全部雪碧图
+// 缩略图按雪碧图顺序、每张图内先行后列排列，第 n 张缩略图对应 [n*interval, (n+1)*interval)
+type VideoThumbnailSaveRequest struct {
+	VideoID    string                      `json:"video_id" binding:"required"`
+	Interval   float64                     `json:"interval" binding:"required"`    // 相邻缩略图的时间间隔(秒)
+	Columns    int                         `json:"columns" binding:"required"`     // 网格列数
+	Rows       int                         `json:"rows" binding:"required"`        // 网格行数
+	TileWidth  int                         `json:"tile_width" binding:"required"`  // 单个缩略图宽度(像素)
+	TileHeight int                         `json:"tile_height" binding:"required"` // 单个缩略图高度(像素)
+	Sprites    []*VideoThumbnailSpriteItem `json:"sprites" binding:"required"`
+}
+
+// VideoThumbnailSpriteItem 保存缩略图请求参数中的单张雪碧图
+type VideoThumbnailSpriteItem struct {
+	Path  string `json:"path" binding:"required"`
+	Count int    `json:"count"` // 雪碧图中的缩略图数量，默认排满网格；只有最后一张可以不满
+}
@@ -1,30 +1,109 @@
 package entity
 
+import "encoding/json"
+
+// 切片封装格式
+const (
+	VideoTSContainerTS   = "ts"   // MPEG-TS
+	VideoTSContainerFMP4 = "fmp4" // fragmented MP4 / CMAF，需要初始化切片
+)
+
 // VideoTSEntity TS切片实体
 // 对应数据库表 cine_video_ts
 // 详细字段说明请参考 docs/video.sql
 type VideoTSEntity struct {
-	VideoTSID  int64   `gorm:"column:video_ts_id;primaryKey;autoIncrement" json:"video_ts_id"`
-	VideoID    string  `gorm:"column:video_id" json:"video_id"`
-	TSSequence int64   `gorm:"column:ts_sequence" json:"ts_sequence"`
-	TSPath     string  `gorm:"column:ts_path" json:"ts_path"`
-	Duration   float64 `gorm:"column:duration" json:"duration"`
-	Definition string  `gorm:"column:definition" json:"definition"`
-	CreateTime int64   `gorm:"column:create_time" json:"create_time"`
+	VideoTSID      int64   `gorm:"column:video_ts_id;primaryKey;autoIncrement" json:"video_ts_id"`
+	VideoID        string  `gorm:"column:video_id" json:"video_id"`
+	TSSequence     int64   `gorm:"column:ts_sequence" json:"ts_sequence"`
+	TSPath         string  `gorm:"column:ts_path" json:"ts_path"`
+	TSPathB        string  `gorm:"column:ts_path_b" json:"ts_path_b"` // A/B 水印的 B 版本切片路径，为空时没有 B 版本
+	Duration       float64 `gorm:"column:duration" json:"duration"`
+	Definition     string  `gorm:"column:definition" json:"definition"`
+	TSSize         int64   `gorm:"column:ts_size" json:"ts_size"`
+	ByteOffset     int64   `gorm:"column:byte_offset" json:"byte_offset"`
+	ByteLength     int64   `gorm:"column:byte_length" json:"byte_length"`
+	Container      string  `gorm:"column:container" json:"container"`
+	InitPath       string  `gorm:"column:init_path" json:"init_path"`
+	InitByteOffset int64   `gorm:"column:init_byte_offset" json:"init_byte_offset"`
+	InitByteLength int64   `gorm:"column:init_byte_length" json:"init_byte_length"`
+	Codecs         string  `gorm:"column:codecs" json:"codecs"`
+	Keyframes      string  `gorm:"column:keyframes" json:"keyframes"` // 关键帧列表 JSON，见 VideoTSKeyframe
+	CreateTime     int64   `gorm:"column:create_time" json:"create_time"`
+}
+
+// IsFMP4 是否为 fmp4 切片
+func (e *VideoTSEntity) IsFMP4() bool {
+	return e.Container == VideoTSContainerFMP4
+}
+
+// HasVariantB 是否有 A/B 水印的 B 版本
+func (e *VideoTSEntity) HasVariantB() bool {
+	return e.TSPathB != ""
+}
+
+// IsByteRange 是否为按字节范围寻址的切片
+func (e *VideoTSEntity) IsByteRange() bool {
+	return e.ByteLength > 0
+}
+
+// GetKeyframes 解析切片的关键帧列表，没有或格式错误时返回空
+func (e *VideoTSEntity) GetKeyframes() []VideoTSKeyframe {
+	if e.Keyframes == "" {
+		return nil
+	}
+	var keyframes []VideoTSKeyframe
+	if err := json.Unmarshal([]byte(e.Keyframes), &keyframes); err != nil {
+		return nil
+	}
+	return keyframes
+}
+
+// VideoTSKeyframe 切片中的一个关键帧，用于 I-frame m3u8
+type VideoTSKeyframe struct {
+	ByteOffset int64   `json:"byte_offset"` // 相对切片起始的偏移（字节范围切片相对 byte_offset）
+	ByteLength int64   `json:"byte_length"` // 关键帧的字节长度
+	TimeOffset float64 `json:"time_offset"` // 相对切片开始的时间(秒)
+}
+
+// VideoTSDefinitionStat 视频单个清晰度的TS切片统计
+type VideoTSDefinitionStat struct {
+	Definition    string  `gorm:"column:definition" json:"definition"`
+	TSCount       int64   `gorm:"column:ts_count" json:"ts_count"`
+	TotalDuration float64 `gorm:"column:total_duration" json:"total_duration"` // 总时长(秒)
+	TotalSize     int64   `gorm:"column:total_size" json:"total_size"`         // 总大小(字节)
+	MinSize       int64   `gorm:"column:min_size" json:"min_size"`             // 最小切片大小，为 0 表示有切片未上报大小
+	PeakBitrate   float64 `gorm:"column:peak_bitrate" json:"peak_bitrate"`     // 单个切片的最大码率 bit/s
+	Codecs        string  `gorm:"column:codecs" json:"codecs"`                 // 切片上报的编码
+	KeyframeCount int64   `gorm:"column:keyframe_count" json:"keyframe_count"` // 有关键帧信息的切片数
 }
 
 // VideoTSSaveRequest 批量保存TS切片请求参数
+// Key/IV 作用于所有切片；需要密钥轮换时使用 Keys 按TS序号区间指定
 type VideoTSSaveRequest struct {
-	VideoID string                 `json:"video_id" binding:"required"`
-	Key     string                 `json:"key" binding:"required"`
-	IV      string                 `json:"iv" binding:"required"`
-	TSData  []*VideoTsSaveDataItem `json:"ts_data" binding:"required"`
+	VideoID       string                  `json:"video_id" binding:"required"`
+	Key           string                  `json:"key"`
+	IV            string                  `json:"iv"`
+	TrialKey      string                  `json:"trial_key"` // 试看切片（开始时间在 app 试看时长内）使用的密钥，和 Key/IV 一起使用
+	TrialIV       string                  `json:"trial_iv"`
+	Keys          []*VideoEncryptSaveItem `json:"keys"`
+	TSData        []*VideoTsSaveDataItem  `json:"ts_data" binding:"required"`
+	ScanKeyframes bool                    `json:"scan_keyframes"` // 没有上报关键帧的 ts 切片，下载后扫描 random_access_indicator 计算
 }
 
 // VideoTsSaveDataItem 批量保存TS切片请求参数中的单个TS切片数据
 type VideoTsSaveDataItem struct {
-	TSSequence int64   `json:"ts_sequence" binding:"required"`
-	TSPath     string  `json:"ts_path" binding:"required"`
-	Duration   float64 `json:"duration" binding:"required"`
-	Definition string  `json:"definition"`
+	TSSequence     int64              `json:"ts_sequence" binding:"required"`
+	TSPath         string             `json:"ts_path" binding:"required"`
+	TSPathB        string             `json:"ts_path_b"` // A/B 水印的 B 版本切片路径，字节范围和初始化切片与 A 版本相同
+	Duration       float64            `json:"duration" binding:"required"`
+	Definition     string             `json:"definition"`
+	TSSize         int64              `json:"ts_size"`          // 切片大小(字节)，用于计算真实码率
+	ByteOffset     int64              `json:"byte_offset"`      // 切片在 ts_path 文件中的起始字节
+	ByteLength     int64              `json:"byte_length"`      // 切片字节长度，0 表示整个文件
+	Container      string             `json:"container"`        // 封装格式：ts | fmp4，默认 ts
+	InitPath       string             `json:"init_path"`        // fmp4 初始化切片路径，fmp4 必填
+	InitByteOffset int64              `json:"init_byte_offset"` // 初始化切片在 init_path 文件中的起始字节
+	InitByteLength int64              `json:"init_byte_length"` // 初始化切片字节长度，0 表示整个文件
+	Codecs         string             `json:"codecs"`           // 编码，如 avc1.640028,mp4a.40.2
+	Keyframes      []*VideoTSKeyframe `json:"keyframes"`        // 关键帧列表，用于 I-frame m3u8
 }
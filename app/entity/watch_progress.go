@@ -0,0 +1,26 @@
+package entity
+
+// WatchProgressEntity 观看进度实体，记录用户每个视频最后的播放位置
+// 对应数据库表 cine_watch_progress
+// 详细字段说明请参考 docs/video.sql
+type WatchProgressEntity struct {
+	WatchProgressID uint64  `gorm:"column:watch_progress_id;primaryKey;autoIncrement" json:"watch_progress_id"`
+	UserID          string  `gorm:"column:user_id;size:64;not null" json:"user_id"`
+	VideoID         string  `gorm:"column:video_id;size:32;not null" json:"video_id"`
+	VodID           int64   `gorm:"column:vod_id;not null" json:"vod_id"`
+	Position        float64 `gorm:"column:position;not null" json:"position"`
+	Duration        float64 `gorm:"column:duration;not null" json:"duration"`
+	CreateTime      int64   `gorm:"column:create_time;not null" json:"create_time"`
+	UpdateTime      int64   `gorm:"column:update_time;not null" json:"update_time"`
+}
+
+// WatchProgressItem 观看进度，用于续播和继续观看列表
+type WatchProgressItem struct {
+	VideoID    string  `json:"video_id"`
+	VodID      int64   `json:"vod_id"`
+	Position   float64 `json:"position"`    // 播放位置(秒)，没有观看记录时为 0
+	Duration   float64 `json:"duration"`    // 视频总时长(秒)
+	Percent    float64 `json:"percent"`     // 完成百分比（0-100，保留一位小数）
+	Finished   bool    `json:"finished"`    // 是否已看完，已看完的视频续播时从头开始
+	UpdateTime int64   `json:"update_time"` // 最后观看时间
+}
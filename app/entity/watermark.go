@@ -0,0 +1,27 @@
+package entity
+
+// WatermarkUserEntity A/B 水印用户实体，记录用户的水印码
+// 对应数据库表 cine_watermark_user
+// 详细字段说明请参考 docs/video.sql
+type WatermarkUserEntity struct {
+	WatermarkUserID uint64 `gorm:"column:watermark_user_id;primaryKey;autoIncrement" json:"watermark_user_id"`
+	UserID          string `gorm:"column:user_id;size:64;not null" json:"user_id"`
+	Code            uint64 `gorm:"column:code;not null" json:"code"`
+	CreateTime      int64  `gorm:"column:create_time;not null" json:"create_time"`
+}
+
+// WatermarkDecodeRequest A/B 水印解码请求参数
+// variants 为从泄露视频中识别出的连续切片版本，第 i 个字符对应序号 start_sequence+i 的切片：
+// A 或 a 为 A 版本，B 或 b 为 B 版本，其它字符（如 ? 或 -）表示无法识别
+type WatermarkDecodeRequest struct {
+	StartSequence int64  `json:"start_sequence"`
+	Variants      string `json:"variants" binding:"required"`
+}
+
+// WatermarkDecodeResult A/B 水印解码结果
+type WatermarkDecodeResult struct {
+	UserID    string `json:"user_id"`
+	Code      string `json:"code"`      // 解码出的水印码（16 位 hex）
+	Observed  int    `json:"observed"`  // 识别出版本的切片数
+	Conflicts int    `json:"conflicts"` // 与解码结果不一致的切片数（识别错误或多个账号合谋）
+}
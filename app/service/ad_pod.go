@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aldge/cine_stream/app/dao"
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/logger"
+)
+
+// ErrAdPodNotFound 广告组不存在
+var ErrAdPodNotFound = errors.New("广告组不存在")
+
+// AdPod 广告组业务逻辑
+type AdPod struct {
+	ctx      context.Context
+	daoAdPod *dao.AdPod
+}
+
+// NewAdPod 创建广告组业务逻辑对象
+func NewAdPod(ctx context.Context) *AdPod {
+	return &AdPod{
+		ctx:      ctx,
+		daoAdPod: dao.NewAdPod(ctx),
+	}
+}
+
+// Save 保存广告组并替换它的全部切片
+func (a *AdPod) Save(req *entity.AdPodSaveRequest) (*entity.AdPodEntity, error) {
+	if req.Name == "" {
+		return nil, errors.New("广告组名称不能为空")
+	}
+	if len(req.Segments) == 0 {
+		return nil, errors.New("广告切片列表不能为空")
+	}
+	status := req.Status
+	if status == 0 {
+		status = entity.AdPodStatusEnabled
+	}
+	if status != entity.AdPodStatusEnabled && status != entity.AdPodStatusDisabled {
+		return nil, fmt.Errorf("广告组状态不合法: %d", req.Status)
+	}
+
+	timeNow := time.Now().Unix()
+	segments := make([]*entity.AdSegmentEntity, 0, len(req.Segments))
+	for i, item := range req.Segments {
+		if item.Path == "" || item.Duration <= 0 {
+			return nil, fmt.Errorf("第 %d 个广告切片的路径不能为空且时长必须大于 0", i)
+		}
+		segments = append(segments, &entity.AdSegmentEntity{
+			Sequence:   int64(i),
+			Path:       item.Path,
+			Duration:   item.Duration,
+			CreateTime: timeNow,
+		})
+	}
+	pod := &entity.AdPodEntity{
+		AdPodID:    req.AdPodID,
+		Name:       req.Name,
+		Status:     status,
+		CreateTime: timeNow,
+		UpdateTime: timeNow,
+	}
+	err := a.daoAdPod.SaveWithSegments(pod, segments)
+	if errors.Is(err, dao.ErrRecordNotFound) {
+		return nil, ErrAdPodNotFound
+	}
+	if err != nil {
+		logger.WithContext(a.ctx).Errorf("[AdPod.Save] 保存广告组失败: %v", err)
+		return nil, errors.New("保存广告组失败")
+	}
+	logger.WithContext(a.ctx).Infof("[AdPod.Save] 保存广告组成功, ad_pod_id: %d, count: %d", pod.AdPodID, len(segments))
+	return pod, nil
+}
+
+// GetList 获取所有广告组
+func (a *AdPod) GetList() ([]entity.AdPodEntity, error) {
+	podList, err := a.daoAdPod.GetList()
+	if err != nil {
+		logger.WithContext(a.ctx).Errorf("[AdPod.GetList] 查询广告组列表失败: %v", err)
+		return nil, errors.New("查询广告组列表失败")
+	}
+	return podList, nil
+}
@@ -0,0 +1,368 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"math"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aldge/cine_stream/app/dao"
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/config"
+	"github.com/aldge/cine_stream/consts"
+	"github.com/aldge/cine_stream/logger"
+	"github.com/aldge/cine_stream/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// cdnCandidate 参与调度的一个 CDN
+type cdnCandidate struct {
+	name   string
+	conf   config.CDNConf
+	weight int
+	status string
+}
+
+// cdnOverride 运行时调整的 CDN 状态和权重
+type cdnOverride struct {
+	status string
+	weight int
+}
+
+const (
+	// cdnOverrideRedisKey 运行时调整的 CDN 状态的 Redis hash，field 为 name:status 和 name:weight
+	cdnOverrideRedisKey = "cine_stream:cdn_override"
+	// cdnOverrideLocalTTL 从 Redis 读取的 CDN 状态在本机缓存的时间，其它实例的调整最多延迟这么久生效
+	cdnOverrideLocalTTL = 5 * time.Second
+)
+
+var (
+	// cdnOverrides 运行时调整的 CDN 状态，name => cdnOverride；配置了 Redis 时为 Redis 中的数据在本机的缓存
+	cdnOverrides     map[string]cdnOverride
+	cdnOverridesTime time.Time
+	cdnOverridesMu   sync.Mutex
+	// cdnIPRegions 解析后的 IP 段地域表
+	cdnIPRegions     []cdnIPRegion
+	cdnIPRegionsOnce sync.Once
+)
+
+// cdnIPRegion 解析后的 IP 段地域
+type cdnIPRegion struct {
+	ipNet  *net.IPNet
+	region string
+}
+
+// SetCDNStatus 运行时设置 CDN 的健康状态和权重，不需要重新部署即可切换流量
+// status 为空时保持原状态，weight <= 0 时保持原权重
+// 配置了 Redis 时保存到 Redis，所有实例在 cdnOverrideLocalTTL 内生效；否则只作用于当前进程
+func SetCDNStatus(ctx context.Context, name string, status string, weight int) error {
+	if _, ok := config.GetAppConf().GetCDNConf()[name]; !ok {
+		return fmt.Errorf("CDN 不存在: %s", name)
+	}
+	if status != "" && status != config.CDNStatusUp && status != config.CDNStatusDown {
+		return fmt.Errorf("CDN 状态不合法: %s", status)
+	}
+	if client := dao.GetRedis(); client != nil {
+		// 状态和权重分别保存，同时调整不同字段时不会互相覆盖
+		values := make([]interface{}, 0, 4)
+		if status != "" {
+			values = append(values, name+":status", status)
+		}
+		if weight > 0 {
+			values = append(values, name+":weight", weight)
+		}
+		if len(values) > 0 {
+			if err := client.HSet(ctx, cdnOverrideRedisKey, values...).Err(); err != nil {
+				logger.WithContext(ctx).Errorf("[SetCDNStatus] 保存 CDN 状态失败: %v, name: %s", err, name)
+				return errors.New("保存 CDN 状态失败")
+			}
+		}
+	}
+
+	cdnOverridesMu.Lock()
+	if cdnOverrides == nil {
+		cdnOverrides = make(map[string]cdnOverride)
+	}
+	override := cdnOverrides[name]
+	if status != "" {
+		override.status = status
+	}
+	if weight > 0 {
+		override.weight = weight
+	}
+	cdnOverrides[name] = override
+	cdnOverridesMu.Unlock()
+	logger.WithContext(ctx).Infof("[SetCDNStatus] CDN 状态已调整, name: %s, status: %s, weight: %d", name, override.status, override.weight)
+	return nil
+}
+
+// loadCDNOverrides 获取运行时调整的 CDN 状态
+// 配置了 Redis 时每 cdnOverrideLocalTTL 从 Redis 重新读取一次，读取失败时继续使用上次的结果
+func loadCDNOverrides(ctx context.Context) map[string]cdnOverride {
+	cdnOverridesMu.Lock()
+	defer cdnOverridesMu.Unlock()
+	client := dao.GetRedis()
+	if client == nil || time.Since(cdnOverridesTime) < cdnOverrideLocalTTL {
+		return cdnOverrides
+	}
+	// 读取失败时也更新时间，Redis 不可用时不会每个请求都重试
+	cdnOverridesTime = time.Now()
+	fields, err := client.HGetAll(ctx, cdnOverrideRedisKey).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		logger.WithContext(ctx).Warnf("[loadCDNOverrides] 读取 CDN 状态失败: %v", err)
+		return cdnOverrides
+	}
+	overrides := make(map[string]cdnOverride, len(fields))
+	for field, value := range fields {
+		sep := strings.LastIndex(field, ":")
+		if sep < 0 {
+			continue
+		}
+		name := field[:sep]
+		override := overrides[name]
+		switch field[sep+1:] {
+		case "status":
+			override.status = value
+		case "weight":
+			override.weight, _ = strconv.Atoi(value)
+		}
+		overrides[name] = override
+	}
+	cdnOverrides = overrides
+	return cdnOverrides
+}
+
+// GetCDNStatusList 获取所有 CDN 当前生效的状态
+func GetCDNStatusList(ctx context.Context) []entity.CDNStatusItem {
+	candidates := loadCDNCandidates(ctx)
+	statusList := make([]entity.CDNStatusItem, 0, len(candidates))
+	for _, candidate := range candidates {
+		statusList = append(statusList, entity.CDNStatusItem{
+			Name:    candidate.name,
+			URL:     candidate.conf.URL,
+			Regions: candidate.conf.Regions,
+			Weight:  candidate.weight,
+			Status:  candidate.status,
+		})
+	}
+	return statusList
+}
+
+// loadCDNCandidates 读取 CDN 配置并合并运行时调整的状态
+func loadCDNCandidates(ctx context.Context) []cdnCandidate {
+	cdnConf := config.GetAppConf().GetCDNConf()
+	overrides := loadCDNOverrides(ctx)
+	candidates := make([]cdnCandidate, 0, len(cdnConf))
+	for name, conf := range cdnConf {
+		candidate := cdnCandidate{name: name, conf: conf, weight: conf.Weight, status: conf.Status}
+		if override, ok := overrides[name]; ok {
+			if override.status != "" {
+				candidate.status = override.status
+			}
+			if override.weight > 0 {
+				candidate.weight = override.weight
+			}
+		}
+		if candidate.weight <= 0 {
+			candidate.weight = 1
+		}
+		if candidate.status == "" {
+			candidate.status = config.CDNStatusUp
+		}
+		candidates = append(candidates, candidate)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].name < candidates[j].name
+	})
+	return candidates
+}
+
+// clientRegion 获取客户端地域，优先使用请求头，其次按 IP 段匹配
+func clientRegion(ctx *gin.Context) string {
+	routeConf := config.GetAppConf().GetCDNRouteConf()
+	if region := ctx.GetHeader(routeConf.RegionHeader); region != "" {
+		return strings.ToLower(region)
+	}
+	cdnIPRegionsOnce.Do(func() {
+		for _, ipRegion := range routeConf.IPRegions {
+			_, ipNet, err := net.ParseCIDR(ipRegion.CIDR)
+			if err != nil {
+				logger.Errorf("[clientRegion] IP 段配置错误: %s, err: %v", ipRegion.CIDR, err)
+				continue
+			}
+			cdnIPRegions = append(cdnIPRegions, cdnIPRegion{ipNet: ipNet, region: strings.ToLower(ipRegion.Region)})
+		}
+	})
+	ip := net.ParseIP(ctx.ClientIP())
+	if ip == nil {
+		return ""
+	}
+	for _, ipRegion := range cdnIPRegions {
+		if ipRegion.ipNet.Contains(ip) {
+			return ipRegion.region
+		}
+	}
+	return ""
+}
+
+// rankCDN 给 CDN 排序：优先正常状态，其次地域匹配，同一档内按权重做会话粘性的加权随机
+// 使用加权 rendezvous hash，同一个会话得到的顺序稳定，不同会话按权重分布
+func rankCDN(candidates []cdnCandidate, region string, sessionID string) []cdnCandidate {
+	tier := func(candidate cdnCandidate) int {
+		t := 0
+		if candidate.status == config.CDNStatusDown {
+			t += 10
+		}
+		switch {
+		case len(candidate.conf.Regions) == 0:
+			t += 1
+		case region == "" || !containsRegion(candidate.conf.Regions, region):
+			t += 2
+		}
+		return t
+	}
+	score := func(candidate cdnCandidate) float64 {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(candidate.name + "|" + sessionID))
+		// fnv 的高位对末尾字节不敏感，再做一次 splitmix64 混淆后映射到 (0, 1) 开区间
+		x := h.Sum64()
+		x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+		x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+		x ^= x >> 31
+		u := (float64(x>>11) + 0.5) / float64(uint64(1)<<53)
+		return float64(candidate.weight) / -math.Log(u)
+	}
+	ranked := make([]cdnCandidate, len(candidates))
+	copy(ranked, candidates)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		ti, tj := tier(ranked[i]), tier(ranked[j])
+		if ti != tj {
+			return ti < tj
+		}
+		return score(ranked[i]) > score(ranked[j])
+	})
+	return ranked
+}
+
+// containsRegion 地域列表是否包含指定地域
+func containsRegion(regions []string, region string) bool {
+	for _, r := range regions {
+		if strings.EqualFold(r, region) {
+			return true
+		}
+	}
+	return false
+}
+
+// playCDNList 获取当前请求的 CDN 排序，第一个为主 CDN，其余为备用
+// query 参数 cdn 指定了正常状态的 CDN 时（主 m3u8 的备用地址），将其放在第一个
+func playCDNList(ctx *gin.Context) []cdnCandidate {
+	if value, ok := ctx.Get(consts.BizContextKeyPlayCDN); ok {
+		return value.([]cdnCandidate)
+	}
+	ranked := rankCDN(loadCDNCandidates(ctx), clientRegion(ctx), playSessionID(ctx))
+	if cdnName := ctx.Query("cdn"); cdnName != "" {
+		for i, candidate := range ranked {
+			if candidate.name == cdnName && candidate.status != config.CDNStatusDown {
+				ranked = append([]cdnCandidate{candidate}, append(ranked[:i:i], ranked[i+1:]...)...)
+				break
+			}
+		}
+	}
+	ctx.Set(consts.BizContextKeyPlayCDN, ranked)
+	return ranked
+}
+
+// playBackupCDNNames 主 m3u8 中每个清晰度输出的 CDN，第一个为主，第二个为备用；只有一个可用 CDN 时返回空
+func playBackupCDNNames(ctx *gin.Context) []string {
+	var names []string
+	for _, candidate := range playCDNList(ctx) {
+		if candidate.status == config.CDNStatusDown {
+			continue
+		}
+		names = append(names, candidate.name)
+		if len(names) == 2 {
+			break
+		}
+	}
+	if len(names) < 2 {
+		return nil
+	}
+	return names
+}
+
+// playSessionID 当前播放会话标识，登录用户使用用户ID，否则使用客户端IP
+func playSessionID(ctx *gin.Context) string {
+	if userID := entity.ContextValueLoginUserID(ctx); userID != "" {
+		return userID
+	}
+	return ctx.ClientIP()
+}
+
+// signCDNURL 按 CDN 配置的签名方式给切片地址签名
+// cdnURL 为 CDN 域名（可带路径前缀），tsPath 为不带 / 开头的切片路径
+func signCDNURL(cdnURL string, tsPath string, signConf config.CDNSignConf, sessionID string) string {
+	cdnURL = strings.TrimSuffix(cdnURL, "/")
+	if signConf.Type == config.CDNSignTypeNone || signConf.Secret == "" {
+		return fmt.Sprintf("%s/%s", cdnURL, tsPath)
+	}
+
+	// 签名使用完整的 URI 路径（包含 CDN 地址中的路径前缀）
+	origin, pathPrefix := cdnURL, ""
+	if u, err := url.Parse(cdnURL); err == nil && u.Host != "" {
+		origin = u.Scheme + "://" + u.Host
+		pathPrefix = u.Path
+	}
+	uri := pathPrefix + "/" + tsPath
+	expire := time.Now().Add(time.Duration(signConf.GetExpireSeconds()) * time.Second).Unix()
+	// 会话标识不直接出现在 URL 中
+	session := utils.Encrypt.Md5Encode(sessionID)[:16]
+
+	switch signConf.Type {
+	case config.CDNSignTypeQueryToken:
+		// 鉴权方式 A：auth_key={expire}-{rand}-{uid}-md5({uri}-{expire}-{rand}-{uid}-{secret})
+		rand, uid := session, "0"
+		hashValue := utils.Encrypt.Md5Encode(fmt.Sprintf("%s-%d-%s-%s-%s", uri, expire, rand, uid, signConf.Secret))
+		return fmt.Sprintf("%s%s?auth_key=%d-%s-%s-%s", origin, uri, expire, rand, uid, hashValue)
+	case config.CDNSignTypePathTimestamp:
+		// 鉴权方式 C：/{md5(secret + uri + expire_hex)}/{expire_hex}{uri}
+		expireHex := strconv.FormatInt(expire, 16)
+		hashValue := utils.Encrypt.Md5Encode(signConf.Secret + uri + expireHex)
+		return fmt.Sprintf("%s/%s/%s%s", origin, hashValue, expireHex, uri)
+	case config.CDNSignTypeHMAC:
+		// 通用 HMAC：signature=hex(hmac(secret, {uri}:{expires}:{session}))
+		mac := hmac.New(cdnSignHashFunc(signConf.Algorithm), []byte(signConf.Secret))
+		mac.Write([]byte(fmt.Sprintf("%s:%d:%s", uri, expire, session)))
+		signature := hex.EncodeToString(mac.Sum(nil))
+		return fmt.Sprintf("%s%s?expires=%d&session=%s&signature=%s", origin, uri, expire, session, signature)
+	default:
+		return fmt.Sprintf("%s/%s", cdnURL, tsPath)
+	}
+}
+
+// cdnSignHashFunc hmac 签名算法，默认 sha256
+func cdnSignHashFunc(algorithm string) func() hash.Hash {
+	switch strings.ToLower(algorithm) {
+	case "md5":
+		return md5.New
+	case "sha1":
+		return sha1.New
+	default:
+		return sha256.New
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -16,22 +18,220 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// ErrDefinitionNotFound 请求的清晰度不存在
+var ErrDefinitionNotFound = errors.New("清晰度不存在")
+
 // Play 播放业务逻辑
 type Play struct {
-	ctx             context.Context
-	daoVideoEncrypt *dao.VideoEncrypt
+	ctx               context.Context
+	daoVideoTS        *dao.VideoTS
+	daoVideoEncrypt   *dao.VideoEncrypt
+	daoVideoLive      *dao.VideoLive
+	daoVideoSubtitle  *dao.VideoSubtitle
+	daoVideoAudio     *dao.VideoAudio
+	daoVideoThumbnail *dao.VideoThumbnail
+	daoAdPod          *dao.AdPod
+}
+
+// playlistOptions 媒体 m3u8 的生成选项
+type playlistOptions struct {
+	playlistType   string        // EXT-X-PLAYLIST-TYPE，live 滑动窗口时为空
+	targetDuration int           // 固定的 EXT-X-TARGETDURATION，0 表示按切片计算
+	endList        bool          // 是否输出 EXT-X-ENDLIST
+	allowNoKey     bool          // 没有加密信息时是否允许输出不加密的切片
+	keyToken       string        // 密钥地址使用的 token，为空时签发播放密钥 token
+	adBreaks       []playAdBreak // 插入的广告位，只用于点播
+}
+
+// vodPlaylistOptions 点播 m3u8 的生成选项
+var vodPlaylistOptions = playlistOptions{
+	playlistType: "VOD",
+	endList:      true,
+}
+
+// playVariant 主 m3u8 中的一路清晰度
+type playVariant struct {
+	definition       string
+	bandwidth        int64
+	averageBandwidth int64
+	resolution       string
+	codecs           string
+	subtitles        string // 字幕 GROUP-ID，没有字幕时为空
+	audio            string // 音轨 GROUP-ID，没有音轨时为空
 }
 
 // NewPlay 创建TS切片业务逻辑对象
 func NewPlay(ctx context.Context) *Play {
 	return &Play{
-		ctx:             ctx,
-		daoVideoEncrypt: dao.NewVideoEncrypt(ctx),
+		ctx:               ctx,
+		daoVideoTS:        dao.NewVideoTS(ctx),
+		daoVideoEncrypt:   dao.NewVideoEncrypt(ctx),
+		daoVideoLive:      dao.NewVideoLive(ctx),
+		daoVideoSubtitle:  dao.NewVideoSubtitle(ctx),
+		daoVideoAudio:     dao.NewVideoAudio(ctx),
+		daoVideoThumbnail: dao.NewVideoThumbnail(ctx),
+		daoAdPod:          dao.NewAdPod(ctx),
 	}
 }
 
-// GenerateM3U8Content 生成M3U8文件内容（支持每个切片独立的加密信息）
+// GenerateMasterM3U8Content 生成主 m3u8 文件内容（每个清晰度一路 EXT-X-STREAM-INF）
+func (p *Play) GenerateMasterM3U8Content(ctx *gin.Context, videoID string) (string, error) {
+	return p.generateMasterM3U8Content(ctx, videoID, nil)
+}
+
+// generateMasterM3U8Content 生成主 m3u8 文件内容，trial 不为空时生成试看的主 m3u8
+func (p *Play) generateMasterM3U8Content(ctx *gin.Context, videoID string, trial *PlayTrial) (string, error) {
+	if videoID == "" {
+		return "", errors.New("视频ID不能为空")
+	}
+
+	renditions, err := p.loadRenditions(videoID)
+	if err != nil {
+		return "", err
+	}
+
+	variants := make([]playVariant, 0, len(renditions.videoStats))
+	var iframeVariants []playVariant
+	for _, stat := range renditions.videoStats {
+		variants = append(variants, buildPlayVariant(stat))
+		// 有关键帧信息的清晰度输出 I-frame 列表
+		if stat.KeyframeCount > 0 && trial == nil {
+			iframeVariants = append(iframeVariants, buildPlayVariant(stat))
+		}
+	}
+	// 按码率从低到高排列
+	sort.SliceStable(variants, func(i, j int) bool {
+		return variants[i].bandwidth < variants[j].bandwidth
+	})
+
+	appName := app.GetAppName(ctx)
+	// 有字幕时每一路清晰度都关联字幕组（试看不提供字幕）
+	var subtitleList []entity.VideoSubtitleEntity
+	if trial == nil {
+		subtitleList, err = p.daoVideoSubtitle.GetListByVideoID(videoID)
+		if err != nil {
+			return "", errors.New("查询视频字幕失败")
+		}
+	}
+	if len(subtitleList) > 0 {
+		for i := range variants {
+			variants[i].subtitles = playSubtitleGroupID
+		}
+	}
+	// 有音轨时每个音轨组输出一遍所有清晰度，清晰度引用该音轨组
+	audioGroups := renditions.audioGroups()
+
+	// 有多个可用 CDN 时，每个清晰度再输出一路备用 CDN 的地址，播放器主地址失败时切换
+	cdnNames := playBackupCDNNames(ctx)
+	if len(cdnNames) == 0 {
+		cdnNames = []string{""}
+	}
+	// 试看范围和设备 ID 追加到媒体 m3u8 地址
+	playlistQuery := trial.playlistQuery() + playDeviceQuery(ctx)
+	var builder strings.Builder
+	builder.WriteString("#EXTM3U\n")
+	builder.WriteString(trial.sessionDataTags())
+	builder.WriteString(buildSubtitleMediaTags(videoID, string(appName), subtitleList))
+	for _, group := range audioGroups {
+		builder.WriteString(buildAudioMediaTags(videoID, string(appName), playlistQuery, group))
+	}
+	for _, cdnName := range cdnNames {
+		if len(audioGroups) == 0 {
+			for _, variant := range variants {
+				builder.WriteString("#EXT-X-STREAM-INF:" + variant.attributes() + "\n")
+				builder.WriteString(buildMediaPlaylistURL(videoID, variant.definition, string(appName), cdnName) + playlistQuery + "\n")
+			}
+			continue
+		}
+		for _, group := range audioGroups {
+			for _, variant := range variants {
+				builder.WriteString("#EXT-X-STREAM-INF:" + variant.withAudioGroup(group).attributes() + "\n")
+				builder.WriteString(buildMediaPlaylistURL(videoID, variant.definition, string(appName), cdnName) + playlistQuery + "\n")
+			}
+		}
+	}
+	for _, variant := range iframeVariants {
+		builder.WriteString(buildIFrameStreamTag(videoID, string(appName), playlistQuery, variant))
+	}
+	return builder.String(), nil
+}
+
+// ResolveDefinition 确认视频有该清晰度（或音轨）；未指定清晰度时使用码率最高的清晰度
+func (p *Play) ResolveDefinition(videoID, definition string) (string, error) {
+	renditions, err := p.loadRenditions(videoID)
+	if err != nil {
+		return "", err
+	}
+	return renditions.resolveDefinition(definition)
+}
+
+// GenerateMediaM3U8Content 生成单个清晰度的媒体 m3u8 文件内容
+// 清晰度统计、音轨、直播信息和点播的切片都从播放列表缓存读取，直播的切片每次查询
+func (p *Play) GenerateMediaM3U8Content(ctx *gin.Context, videoID, definition string) (string, error) {
+	video, err := p.loadVideoCatalog(videoID)
+	if err != nil {
+		return "", err
+	}
+	renditions, err := newPlayRenditions(video)
+	if err != nil {
+		return "", err
+	}
+	definition, err = renditions.resolveDefinition(definition)
+	if err != nil {
+		return "", err
+	}
+	if video.Live != nil {
+		return p.generateLiveM3U8Content(ctx, video.Live, definition)
+	}
+
+	catalog, err := p.loadPlaylistCatalog(ctx, videoID, definition)
+	if err != nil {
+		return "", err
+	}
+	opts := vodPlaylistOptions
+	opts.adBreaks = p.loadAdBreaks(ctx, videoID, video.AudioList, catalog.TSList)
+	return p.generateM3U8Content(ctx, videoID, catalog.TSList, catalog.EncryptList, opts)
+}
+
+// generateLiveM3U8Content 生成直播的媒体 m3u8 内容
+// live 类型只输出最新的 window_size 个切片（滑动窗口），event 类型输出全部切片；结束前不输出 EXT-X-ENDLIST
+func (p *Play) generateLiveM3U8Content(ctx *gin.Context, live *entity.VideoLiveEntity, definition string) (string, error) {
+	opts := playlistOptions{
+		targetDuration: live.TargetDuration,
+		endList:        live.IsEnded(),
+		allowNoKey:     true,
+	}
+	var tsList []entity.VideoTSEntity
+	var err error
+	if live.PlaylistType == entity.VideoLivePlaylistTypeEvent {
+		opts.playlistType = "EVENT"
+		tsList, err = p.daoVideoTS.GetByVideoDefinition(live.VideoID, definition)
+	} else {
+		tsList, err = p.daoVideoTS.GetLastByVideoDefinition(live.VideoID, definition, live.WindowSize)
+	}
+	if err != nil {
+		return "", errors.New("查询TS切片列表失败")
+	}
+	// 直播切片持续追加，不使用播放列表缓存
+	encryptList, err := p.daoVideoEncrypt.GetListByVideoID(live.VideoID)
+	if err != nil {
+		return "", errors.New("获取视频加密信息失败")
+	}
+	return p.generateM3U8Content(ctx, live.VideoID, tsList, encryptList, opts)
+}
+
+// GenerateM3U8Content 生成点播M3U8文件内容（支持每个切片独立的加密信息）
 func (p *Play) GenerateM3U8Content(ctx *gin.Context, videoID string, tsList []entity.VideoTSEntity) (string, error) {
+	encryptList, err := p.daoVideoEncrypt.GetListByVideoID(videoID)
+	if err != nil {
+		return "", errors.New("获取视频加密信息失败")
+	}
+	return p.generateM3U8Content(ctx, videoID, tsList, encryptList, vodPlaylistOptions)
+}
+
+// generateM3U8Content 按生成选项生成媒体M3U8文件内容，encryptList 为视频所有切片的加密信息
+func (p *Play) generateM3U8Content(ctx *gin.Context, videoID string, tsList []entity.VideoTSEntity,
+	encryptList []entity.VideoEncryptEntity, opts playlistOptions) (string, error) {
 	if videoID == "" {
 		return "", errors.New("视频ID不能为空")
 	}
@@ -39,58 +239,243 @@ func (p *Play) GenerateM3U8Content(ctx *gin.Context, videoID string, tsList []en
 		return "", errors.New("该视频没有TS切片")
 	}
 
-	// 获取所有切片的加密信息
-	encryptInfo, err := p.daoVideoEncrypt.GetByVideoID(videoID)
-	if err != nil {
+	if len(encryptList) == 0 && !opts.allowNoKey {
 		return "", errors.New("获取视频加密信息失败")
 	}
 
 	baseURL := utils.GetRequestBaseURL(ctx)
 	appName := app.GetAppName(ctx)
+	// 密钥地址带上签名 token，密钥接口可以本地校验权限
+	keyToken := opts.keyToken
+	if keyToken == "" {
+		keyToken = SignPlayKeyToken(ctx, videoID)
+	}
+	keyQuery := playDeviceQuery(ctx)
+	segmentURLs := newSegmentURLBuilder(ctx, videoID, keyToken)
+	// 有 B 版本的切片时按用户的水印码选择 A/B 版本
+	segmentURLs.applyWatermark(tsList)
+
+	// 一个媒体 m3u8 只能包含一个清晰度，且封装格式一致
+	for _, ts := range tsList[1:] {
+		if ts.Definition != tsList[0].Definition {
+			return "", errors.New("TS切片列表包含多个清晰度")
+		}
+		if ts.IsFMP4() != tsList[0].IsFMP4() {
+			return "", errors.New("TS切片列表的封装格式不一致")
+		}
+	}
+
+	// 插入广告后的切片列表
+	segments := stitchAdBreaks(tsList, opts.adBreaks)
 
 	// 计算最大时长（TARGETDURATION 应该是所有片段的最大时长，向上取整）
 	maxDuration := 0.0
-	for _, ts := range tsList {
-		if ts.Duration > maxDuration {
-			maxDuration = ts.Duration
+	for _, segment := range segments {
+		if segment.ts.Duration > maxDuration {
+			maxDuration = segment.ts.Duration
 		}
 	}
 	targetDuration := int(math.Ceil(maxDuration))
+	// 直播过程中 TARGETDURATION 不能变化，配置了固定值时以固定值为准
+	if opts.targetDuration > targetDuration {
+		targetDuration = opts.targetDuration
+	}
 	if targetDuration < 1 {
 		targetDuration = 1 // 最小值设为 1
 	}
 
+	// fmp4 切片需要 EXT-X-MAP，版本号至少为 7（CMAF）；字节范围切片至少为 4
+	version := 3
+	for _, segment := range segments {
+		if segment.ts.IsByteRange() && version < 4 {
+			version = 4
+		}
+	}
+	if tsList[0].IsFMP4() {
+		version = 7
+	}
+
 	// 生成M3U8文件内容（按照标准顺序）
-	m3u8Content := "#EXTM3U\n"
-	m3u8Content += "#EXT-X-VERSION:3\n"
-	m3u8Content += "#EXT-X-MEDIA-SEQUENCE:0\n"
-	m3u8Content += "#EXT-X-ALLOW-CACHE:YES\n"
-	m3u8Content += fmt.Sprintf("#EXT-X-TARGETDURATION:%d\n", targetDuration)
-	m3u8Content += fmt.Sprintf(`#EXT-X-KEY:METHOD=AES-128,URI="%s/play/key/%s?app=%s",IV=0x%s`+"\n", baseURL, videoID, appName, encryptInfo.IV)
-	// 为每个切片添加信息（#EXTINF ）
-	for _, ts := range tsList {
-		m3u8Content += "#EXTINF:" + formatDuration(ts.Duration) + ",\n"
-		m3u8Content += buildTsUrl(ts.TSPath) + "\n"
-	}
-	m3u8Content += "#EXT-X-ENDLIST\n"
-	return m3u8Content, nil
-}
-
-func buildTsUrl(tsPath string) string {
+	var m3u8Content strings.Builder
+	m3u8Content.WriteString("#EXTM3U\n")
+	m3u8Content.WriteString(fmt.Sprintf("#EXT-X-VERSION:%d\n", version))
+	if opts.playlistType != "" {
+		m3u8Content.WriteString("#EXT-X-PLAYLIST-TYPE:" + opts.playlistType + "\n")
+	}
+	// 滑动窗口时 MEDIA-SEQUENCE 为窗口内第一个切片的序号
+	m3u8Content.WriteString(fmt.Sprintf("#EXT-X-MEDIA-SEQUENCE:%d\n", tsList[0].TSSequence))
+	if opts.endList {
+		m3u8Content.WriteString("#EXT-X-ALLOW-CACHE:YES\n")
+	}
+	m3u8Content.WriteString(fmt.Sprintf("#EXT-X-TARGETDURATION:%d\n", targetDuration))
+	// 为每个切片添加信息（#EXTINF ），密钥变化时插入新的 #EXT-X-KEY（广告切片不加密）
+	// fmp4 初始化切片变化时插入新的 #EXT-X-MAP，广告前后插入 #EXT-X-DISCONTINUITY
+	// 插入广告后切片在 m3u8 中的序号不再是切片序号，没有指定 IV 的密钥按切片序号输出 IV，
+	// 与转码时默认使用的 IV（切片序号）一致，每个切片都要输出 #EXT-X-KEY
+	stitched := len(segments) > len(tsList)
+	var currentEncrypt *entity.VideoEncryptEntity
+	currentIV := ""
+	currentInitMap := ""
+	for i, segment := range segments {
+		ts := segment.ts
+		if segment.discontinuity {
+			m3u8Content.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		var encryptInfo *entity.VideoEncryptEntity
+		iv := ""
+		if !segment.ad {
+			encryptInfo = findSegmentEncrypt(encryptList, ts.Definition, ts.TSSequence)
+		}
+		if encryptInfo != nil {
+			iv = encryptInfo.IV
+			if iv == "" && stitched {
+				iv = fmt.Sprintf("%032x", ts.TSSequence)
+			}
+		}
+		if i == 0 || encryptInfo != currentEncrypt || iv != currentIV {
+			m3u8Content.WriteString(buildKeyTag(baseURL, videoID, string(appName), keyToken, keyQuery, encryptInfo, iv))
+			currentEncrypt = encryptInfo
+			currentIV = iv
+		}
+		initMap := ts.InitPath
+		if ts.InitByteLength > 0 {
+			initMap = fmt.Sprintf("%s@%d-%d", ts.InitPath, ts.InitByteOffset, ts.InitByteLength)
+		}
+		if ts.IsFMP4() && initMap != currentInitMap {
+			m3u8Content.WriteString(buildMapTag(segmentURLs.init(ts), ts))
+			currentInitMap = initMap
+		}
+		m3u8Content.WriteString("#EXTINF:" + formatDuration(ts.Duration) + ",\n")
+		if ts.IsByteRange() {
+			m3u8Content.WriteString(fmt.Sprintf("#EXT-X-BYTERANGE:%d@%d\n", ts.ByteLength, ts.ByteOffset))
+		}
+		// 广告切片不属于当前视频，始终使用 CDN 地址
+		if segment.ad {
+			m3u8Content.WriteString(buildTsUrl(ctx, ts.TSPath) + "\n")
+		} else {
+			m3u8Content.WriteString(segmentURLs.segment(ts) + "\n")
+		}
+	}
+	if opts.endList {
+		m3u8Content.WriteString("#EXT-X-ENDLIST\n")
+	}
+	return m3u8Content.String(), nil
+}
+
+// findSegmentEncrypt 查找作用于切片的加密信息，指定清晰度的优先于所有清晰度的，
+// 同级别时起始序号大的优先（直播追加的新密钥覆盖之前未结束的区间）；没有则返回 nil
+func findSegmentEncrypt(encryptList []entity.VideoEncryptEntity, definition string, sequence int64) *entity.VideoEncryptEntity {
+	var matched *entity.VideoEncryptEntity
+	for i := range encryptList {
+		encrypt := &encryptList[i]
+		if !encrypt.Covers(definition, sequence) {
+			continue
+		}
+		if matched == nil || (encrypt.Definition != "") != (matched.Definition != "") {
+			if matched == nil || encrypt.Definition != "" {
+				matched = encrypt
+			}
+			continue
+		}
+		if encrypt.StartSequence >= matched.StartSequence {
+			matched = encrypt
+		}
+	}
+	return matched
+}
+
+// buildKeyTag 生成 #EXT-X-KEY，加密信息为空时表示后续切片不加密，query 追加到密钥地址，
+// iv 为空时不输出 IV（播放器使用切片在 m3u8 中的序号）
+func buildKeyTag(baseURL, videoID, appName, keyToken, query string, encryptInfo *entity.VideoEncryptEntity, iv string) string {
+	if encryptInfo == nil {
+		return "#EXT-X-KEY:METHOD=NONE\n"
+	}
+	keyTag := fmt.Sprintf(`#EXT-X-KEY:METHOD=AES-128,URI="%s/play/key/%s?app=%s&key_id=%d&token=%s%s"`,
+		baseURL, videoID, url.QueryEscape(appName), encryptInfo.VideoEncryptID, url.QueryEscape(keyToken), query)
+	if iv != "" {
+		keyTag += ",IV=0x" + strings.TrimPrefix(iv, "0x")
+	}
+	return keyTag + "\n"
+}
+
+// buildMapTag 生成 fmp4 初始化切片的 #EXT-X-MAP，initURL 为初始化切片地址
+func buildMapTag(initURL string, ts entity.VideoTSEntity) string {
+	mapTag := fmt.Sprintf(`#EXT-X-MAP:URI="%s"`, initURL)
+	if ts.InitByteLength > 0 {
+		mapTag += fmt.Sprintf(`,BYTERANGE="%d@%d"`, ts.InitByteLength, ts.InitByteOffset)
+	}
+	return mapTag + "\n"
+}
+
+// buildPlayVariant 根据切片统计和清晰度配置生成一路清晰度
+// 所有切片都上报了大小时使用实际码率，否则使用配置的码率
+func buildPlayVariant(stat entity.VideoTSDefinitionStat) playVariant {
+	definitionConf := config.GetAppConf().GetDefinitionConf(stat.Definition)
+	variant := playVariant{
+		definition: stat.Definition,
+		bandwidth:  definitionConf.Bandwidth,
+		resolution: definitionConf.Resolution,
+		codecs:     definitionConf.Codecs,
+	}
+	// 切片上报的编码优先于配置
+	if stat.Codecs != "" {
+		variant.codecs = stat.Codecs
+	}
+	if stat.MinSize > 0 && stat.TotalDuration > 0 && stat.PeakBitrate > 0 {
+		variant.bandwidth = int64(math.Ceil(stat.PeakBitrate))
+		variant.averageBandwidth = int64(math.Ceil(float64(stat.TotalSize) * 8 / stat.TotalDuration))
+	}
+	return variant
+}
+
+// attributes 生成 EXT-X-STREAM-INF 的属性列表
+func (v playVariant) attributes() string {
+	attrs := []string{"PROGRAM-ID=1", fmt.Sprintf("BANDWIDTH=%d", v.bandwidth)}
+	if v.averageBandwidth > 0 {
+		attrs = append(attrs, fmt.Sprintf("AVERAGE-BANDWIDTH=%d", v.averageBandwidth))
+	}
+	if v.resolution != "" {
+		attrs = append(attrs, "RESOLUTION="+v.resolution)
+	}
+	if v.codecs != "" {
+		attrs = append(attrs, fmt.Sprintf(`CODECS="%s"`, v.codecs))
+	}
+	if v.audio != "" {
+		attrs = append(attrs, fmt.Sprintf(`AUDIO="%s"`, v.audio))
+	}
+	if v.subtitles != "" {
+		attrs = append(attrs, fmt.Sprintf(`SUBTITLES="%s"`, v.subtitles))
+	}
+	return strings.Join(attrs, ",")
+}
+
+// buildMediaPlaylistURL 生成清晰度对应的媒体 m3u8 地址，cdnName 不为空时指定切片使用的 CDN
+func buildMediaPlaylistURL(videoID, definition, appName, cdnName string) string {
+	playlistURL := fmt.Sprintf("/play/%s/index.m3u8?app=%s", videoID, url.QueryEscape(appName))
+	if definition != "" {
+		playlistURL = fmt.Sprintf("/play/%s/%s/index.m3u8?app=%s", videoID, url.PathEscape(definition), url.QueryEscape(appName))
+	}
+	if cdnName != "" {
+		playlistURL += "&cdn=" + url.QueryEscape(cdnName)
+	}
+	return playlistURL
+}
+
+// buildTsUrl 生成切片地址，相对路径拼接当前请求调度到的 CDN 域名并按 CDN 配置签名
+func buildTsUrl(ctx *gin.Context, tsPath string) string {
 	// 判断 tsPath 是否包含域名
 	if strings.HasPrefix(tsPath, "http://") || strings.HasPrefix(tsPath, "https://") {
 		return tsPath
 	}
-	// 获取 cdn 域名
-	cdnConf := config.GetAppConf().GetCDNConf()
-	if len(cdnConf) == 0 {
+	// 按地域、权重、健康状态选择 cdn
+	cdnList := playCDNList(ctx)
+	if len(cdnList) == 0 {
 		return tsPath
 	}
 	// 如果 tsPath 带 / ，去掉
 	tsPath = strings.TrimPrefix(tsPath, "/")
-	// todo 这里可以根据不同的地域返回不同的 cdn 域名，暂时先使用默认
-	defaultCdnConf := cdnConf["default"]
-	return fmt.Sprintf("%s/%s", defaultCdnConf.URL, tsPath)
+	cdn := cdnList[0]
+	return signCDNURL(cdn.conf.URL, tsPath, cdn.conf.Sign, playSessionID(ctx))
 }
 
 // formatDuration 格式化时长
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"sort"
+
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/config"
+	"github.com/aldge/cine_stream/logger"
+	"github.com/aldge/gopkg/app"
+	"github.com/gin-gonic/gin"
+)
+
+// AdDecisionRequest 广告决策请求，每个广告位请求一次
+type AdDecisionRequest struct {
+	AppName  string
+	VideoID  string
+	UserID   string
+	Position string  // 广告位：pre | mid | post
+	Offset   float64 // 广告位在正片中的时间(秒)
+}
+
+// AdDecider 广告决策接口，返回广告位依次播放的广告组 ID（cine_ad_pod），为空表示该广告位不插广告
+type AdDecider interface {
+	Decide(ctx context.Context, req *AdDecisionRequest) ([]uint64, error)
+}
+
+// StaticAdDecider 静态广告决策，按配置 Ad.static 返回广告位对应的广告组，用于测试和没有接入广告平台时
+type StaticAdDecider struct{}
+
+// Decide 返回配置中广告位对应的广告组
+func (StaticAdDecider) Decide(ctx context.Context, req *AdDecisionRequest) ([]uint64, error) {
+	return config.GetAppConf().GetAdConf(req.AppName).Static[req.Position], nil
+}
+
+// adDecider 当前使用的广告决策实现
+var adDecider AdDecider = StaticAdDecider{}
+
+// SetAdDecider 替换广告决策实现，需在服务启动时调用
+func SetAdDecider(decider AdDecider) {
+	adDecider = decider
+}
+
+// playAdBreak 媒体 m3u8 中的一个广告位
+type playAdBreak struct {
+	position    string
+	offset      float64
+	insertIndex int                        // 插入在第几个正片切片之前，等于切片数时为片尾
+	pods        [][]entity.AdSegmentEntity // 依次播放的广告组切片
+}
+
+// playlistSegment 媒体 m3u8 中的一个切片，广告切片不加密
+type playlistSegment struct {
+	ts            entity.VideoTSEntity
+	ad            bool
+	discontinuity bool // 切片前输出 EXT-X-DISCONTINUITY（广告组开始和广告后恢复正片）
+}
+
+// loadAdBreaks 按广告配置和广告决策生成点播媒体 m3u8 的广告位
+// 广告切片是 MPEG-TS，fmp4 视频和有音轨的视频（音轨 m3u8 的时间线会对不上）不插广告；广告查询失败时不插广告
+func (p *Play) loadAdBreaks(ctx *gin.Context, videoID string, audioList []entity.VideoAudioEntity, tsList []entity.VideoTSEntity) []playAdBreak {
+	appName := string(app.GetAppName(ctx))
+	adConf := config.GetAppConf().GetAdConf(appName)
+	if !adConf.Enabled || len(tsList) == 0 || tsList[0].IsFMP4() || len(audioList) > 0 {
+		return nil
+	}
+
+	var breaks []playAdBreak
+	if adConf.PreRoll {
+		breaks = append(breaks, playAdBreak{position: entity.AdBreakPositionPre})
+	}
+	// 中插广告位对齐到切片边界：在该时间之后开始的第一个切片前插入
+	midRolls := append([]int64(nil), adConf.MidRolls...)
+	sort.Slice(midRolls, func(i, j int) bool { return midRolls[i] < midRolls[j] })
+	start, index := 0.0, 0
+	for _, midRoll := range midRolls {
+		for index < len(tsList) && start < float64(midRoll) {
+			start += tsList[index].Duration
+			index++
+		}
+		if midRoll <= 0 || index >= len(tsList) {
+			continue
+		}
+		if len(breaks) > 0 && breaks[len(breaks)-1].insertIndex == index {
+			continue
+		}
+		breaks = append(breaks, playAdBreak{position: entity.AdBreakPositionMid, offset: start, insertIndex: index})
+	}
+	if adConf.PostRoll {
+		for ; index < len(tsList); index++ {
+			start += tsList[index].Duration
+		}
+		breaks = append(breaks, playAdBreak{position: entity.AdBreakPositionPost, offset: start, insertIndex: len(tsList)})
+	}
+
+	// 每个广告位请求广告决策
+	decisions := make([][]uint64, len(breaks))
+	var podIDs []uint64
+	for i, adBreak := range breaks {
+		ids, err := adDecider.Decide(ctx, &AdDecisionRequest{
+			AppName:  appName,
+			VideoID:  videoID,
+			UserID:   entity.ContextValueLoginUserID(ctx),
+			Position: adBreak.position,
+			Offset:   adBreak.offset,
+		})
+		if err != nil {
+			logger.WithContext(ctx).Warnf("[Play.loadAdBreaks] 广告决策失败: %v, video_id: %s, position: %s", err, videoID, adBreak.position)
+			continue
+		}
+		decisions[i] = ids
+		podIDs = append(podIDs, ids...)
+	}
+	if len(podIDs) == 0 {
+		return nil
+	}
+
+	podList, err := p.daoAdPod.GetEnabledByIDs(podIDs)
+	if err != nil {
+		logger.WithContext(ctx).Errorf("[Play.loadAdBreaks] 查询广告组失败: %v", err)
+		return nil
+	}
+	segmentList, err := p.daoAdPod.GetSegmentsByPodIDs(podIDs)
+	if err != nil {
+		logger.WithContext(ctx).Errorf("[Play.loadAdBreaks] 查询广告切片失败: %v", err)
+		return nil
+	}
+	podSegments := make(map[uint64][]entity.AdSegmentEntity, len(podList))
+	for _, pod := range podList {
+		podSegments[pod.AdPodID] = nil
+	}
+	for _, segment := range segmentList {
+		if _, ok := podSegments[segment.AdPodID]; ok {
+			podSegments[segment.AdPodID] = append(podSegments[segment.AdPodID], segment)
+		}
+	}
+
+	result := make([]playAdBreak, 0, len(breaks))
+	for i, adBreak := range breaks {
+		for _, podID := range decisions[i] {
+			if segments := podSegments[podID]; len(segments) > 0 {
+				adBreak.pods = append(adBreak.pods, segments)
+			}
+		}
+		if len(adBreak.pods) > 0 {
+			result = append(result, adBreak)
+		}
+	}
+	return result
+}
+
+// stitchAdBreaks 把广告切片插入正片切片列表，每个广告组开始和广告后恢复正片时标记不连续
+func stitchAdBreaks(tsList []entity.VideoTSEntity, breaks []playAdBreak) []playlistSegment {
+	segments := make([]playlistSegment, 0, len(tsList))
+	breakIndex := 0
+	insertAds := func(index int) {
+		for ; breakIndex < len(breaks) && breaks[breakIndex].insertIndex == index; breakIndex++ {
+			for _, pod := range breaks[breakIndex].pods {
+				for i, adSegment := range pod {
+					// 列表的第一个切片前不需要标记
+					discontinuity := i == 0 && len(segments) > 0
+					segments = append(segments, playlistSegment{
+						ts: entity.VideoTSEntity{
+							TSPath:     adSegment.Path,
+							Duration:   adSegment.Duration,
+							Definition: tsList[0].Definition,
+							Container:  entity.VideoTSContainerTS,
+						},
+						ad:            true,
+						discontinuity: discontinuity,
+					})
+				}
+			}
+		}
+	}
+	for i, ts := range tsList {
+		insertAds(i)
+		afterAd := len(segments) > 0 && segments[len(segments)-1].ad
+		segments = append(segments, playlistSegment{ts: ts, discontinuity: afterAd})
+	}
+	insertAds(len(tsList))
+	return segments
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/aldge/cine_stream/app/entity"
+)
+
+// playRenditions 视频的清晰度（视频）和音轨，音轨的切片和视频一样保存在 cine_video_ts
+type playRenditions struct {
+	videoStats []entity.VideoTSDefinitionStat
+	audioList  []playAudio
+}
+
+// playAudio 有切片的一个音轨
+type playAudio struct {
+	audio     entity.VideoAudioEntity
+	bandwidth int64
+}
+
+// playAudioGroup 主 m3u8 中的一个音轨组，编码相同的音轨放在同一组
+type playAudioGroup struct {
+	groupID   string
+	codecs    string
+	bandwidth int64 // 组内最大码率，计入引用该组的清晰度码率
+	audioList []playAudio
+}
+
+// loadRenditions 查询视频的清晰度统计，并按音轨表把音轨的 definition 分出来
+func (p *Play) loadRenditions(videoID string) (*playRenditions, error) {
+	video, err := p.loadVideoCatalog(videoID)
+	if err != nil {
+		return nil, err
+	}
+	return newPlayRenditions(video)
+}
+
+// newPlayRenditions 按音轨表把视频的清晰度统计分为清晰度和音轨
+func newPlayRenditions(video *playlistCatalog) (*playRenditions, error) {
+	statList, audioEntityList := video.DefinitionStats, video.AudioList
+	audioStats := make(map[string]entity.VideoTSDefinitionStat, len(audioEntityList))
+	for _, audio := range audioEntityList {
+		audioStats[audio.Definition] = entity.VideoTSDefinitionStat{}
+	}
+
+	renditions := &playRenditions{}
+	for _, stat := range statList {
+		if _, ok := audioStats[stat.Definition]; ok {
+			audioStats[stat.Definition] = stat
+			continue
+		}
+		renditions.videoStats = append(renditions.videoStats, stat)
+	}
+	if len(renditions.videoStats) == 0 {
+		return nil, errors.New("该视频没有TS切片")
+	}
+	for _, audio := range audioEntityList {
+		stat := audioStats[audio.Definition]
+		if stat.TSCount == 0 {
+			continue // 没有切片的音轨不输出
+		}
+		renditions.audioList = append(renditions.audioList, playAudio{audio: audio, bandwidth: audioBandwidth(stat)})
+	}
+	return renditions, nil
+}
+
+// resolveDefinition 确认视频有该清晰度（或音轨）；未指定清晰度时使用码率最高的清晰度
+func (r *playRenditions) resolveDefinition(definition string) (string, error) {
+	if definition == "" {
+		best := buildPlayVariant(r.videoStats[0])
+		for _, stat := range r.videoStats[1:] {
+			if variant := buildPlayVariant(stat); variant.bandwidth > best.bandwidth {
+				best = variant
+			}
+		}
+		return best.definition, nil
+	}
+	if r.hasDefinition(definition) {
+		return definition, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrDefinitionNotFound, definition)
+}
+
+// hasDefinition 视频或音轨是否有该 definition
+func (r *playRenditions) hasDefinition(definition string) bool {
+	for _, stat := range r.videoStats {
+		if stat.Definition == definition {
+			return true
+		}
+	}
+	for _, audio := range r.audioList {
+		if audio.audio.Definition == definition {
+			return true
+		}
+	}
+	return false
+}
+
+// audioGroups 按编码把音轨分组，组内没有默认音轨时第一个音轨作为默认
+func (r *playRenditions) audioGroups() []playAudioGroup {
+	var groups []playAudioGroup
+	for _, audio := range r.audioList {
+		index := -1
+		for i := range groups {
+			if groups[i].codecs == audio.audio.Codecs {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			groups = append(groups, playAudioGroup{
+				groupID: "aud-" + audio.audio.Codecs,
+				codecs:  audio.audio.Codecs,
+			})
+			index = len(groups) - 1
+		}
+		group := &groups[index]
+		group.audioList = append(group.audioList, audio)
+		if audio.bandwidth > group.bandwidth {
+			group.bandwidth = audio.bandwidth
+		}
+	}
+	for i := range groups {
+		hasDefault := false
+		for _, audio := range groups[i].audioList {
+			hasDefault = hasDefault || audio.audio.IsDefault
+		}
+		if !hasDefault {
+			groups[i].audioList[0].audio.IsDefault = true
+		}
+	}
+	return groups
+}
+
+// audioBandwidth 音轨码率，所有切片都上报了大小时使用实际码率
+func audioBandwidth(stat entity.VideoTSDefinitionStat) int64 {
+	if stat.MinSize > 0 && stat.PeakBitrate > 0 {
+		return int64(math.Ceil(stat.PeakBitrate))
+	}
+	return defaultAudioBandwidth
+}
+
+// buildAudioMediaTags 生成音轨组的 EXT-X-MEDIA，query 追加到音轨媒体 m3u8 地址
+func buildAudioMediaTags(videoID, appName, query string, group playAudioGroup) string {
+	var builder strings.Builder
+	for _, audio := range group.audioList {
+		attrs := []string{
+			"TYPE=AUDIO",
+			fmt.Sprintf(`GROUP-ID="%s"`, group.groupID),
+			fmt.Sprintf(`NAME="%s"`, quotedStringEscape(audio.audio.Name)),
+			fmt.Sprintf(`LANGUAGE="%s"`, quotedStringEscape(audio.audio.Language)),
+			"DEFAULT=" + yesNo(audio.audio.IsDefault),
+			"AUTOSELECT=YES",
+			fmt.Sprintf(`CHANNELS="%d"`, audio.audio.Channels),
+			fmt.Sprintf(`URI="%s"`, buildMediaPlaylistURL(videoID, audio.audio.Definition, appName, "")+query),
+		}
+		builder.WriteString("#EXT-X-MEDIA:" + strings.Join(attrs, ",") + "\n")
+	}
+	return builder.String()
+}
+
+// withAudioGroup 清晰度引用音轨组：码率加上音轨码率，编码加上音轨编码
+func (v playVariant) withAudioGroup(group playAudioGroup) playVariant {
+	v.audio = group.groupID
+	v.bandwidth += group.bandwidth
+	if v.averageBandwidth > 0 {
+		v.averageBandwidth += group.bandwidth
+	}
+	// 没有配置视频编码时不输出 CODECS，只写音频编码会让播放器认为没有视频
+	if v.codecs != "" && group.codecs != "" && !strings.Contains(","+v.codecs+",", ","+group.codecs+",") {
+		v.codecs += "," + group.codecs
+	}
+	return v
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+const (
+	// C3u8Version c3u8 v2 协议版本
+	C3u8Version = 2
+	// c3u8HKDFInfo 派生内容密钥使用的 HKDF info
+	c3u8HKDFInfo = "cine-c3u8-v2"
+	// c3u8NonceSize AES-GCM 的 nonce 长度
+	c3u8NonceSize = 12
+)
+
+// c3u8 v2 支持的密钥协商曲线
+const (
+	C3u8CurveX25519 = "x25519"
+	C3u8CurveP256   = "p256"
+)
+
+// ErrC3u8ClientKeyInvalid 播放器上报的临时公钥不合法
+var ErrC3u8ClientKeyInvalid = errors.New("播放器公钥不合法")
+
+// C3u8Envelope c3u8 v2 协议的加密内容
+// 播放器每次播放生成临时密钥对，服务端每次响应生成临时密钥对，ECDH 协商后用 HKDF-SHA256 派生 AES-256-GCM 密钥，
+// 每次响应使用新的随机 nonce；附加数据为 "cine-c3u8:v{version}:{kid}"
+type C3u8Envelope struct {
+	Version            int    `json:"v"`     // 协议版本，固定为 2
+	KeyID              string `json:"kid"`   // 密钥 ID：播放器公钥 SHA-256 的前 8 字节（hex），播放器据此找到自己的私钥
+	Algorithm          string `json:"alg"`   // 算法，如 ECDH-X25519+HKDF-SHA256+A256GCM
+	EphemeralPublicKey string `json:"epk"`   // 服务端临时公钥（base64url，无填充）
+	Nonce              string `json:"nonce"` // AES-GCM nonce（base64url，无填充）
+	Info               string `json:"info"`  // 密文和认证标签（标准 base64，与 v1 相同）
+}
+
+// c3u8Curve 按名称获取曲线，为空时使用 X25519
+func c3u8Curve(curveName string) (ecdh.Curve, string, error) {
+	switch curveName {
+	case C3u8CurveX25519, "":
+		return ecdh.X25519(), "ECDH-X25519+HKDF-SHA256+A256GCM", nil
+	case C3u8CurveP256:
+		return ecdh.P256(), "ECDH-P256+HKDF-SHA256+A256GCM", nil
+	}
+	return nil, "", fmt.Errorf("%w: 不支持的曲线 %s", ErrC3u8ClientKeyInvalid, curveName)
+}
+
+// SealC3u8Envelope 使用播放器的临时公钥加密 m3u8 内容
+// clientPublicKey 为 base64url 编码的原始公钥（X25519 为 32 字节，P-256 为 65 字节非压缩格式）
+func SealC3u8Envelope(content, curveName, clientPublicKey string) (*C3u8Envelope, error) {
+	curve, algorithm, err := c3u8Curve(curveName)
+	if err != nil {
+		return nil, err
+	}
+	clientKeyBytes, err := base64.RawURLEncoding.DecodeString(clientPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrC3u8ClientKeyInvalid, err)
+	}
+	clientKey, err := curve.NewPublicKey(clientKeyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrC3u8ClientKeyInvalid, err)
+	}
+
+	serverKey, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := serverKey.ECDH(clientKey)
+	if err != nil {
+		// X25519 的低阶点会得到全 0 的共享密钥
+		return nil, fmt.Errorf("%w: %v", ErrC3u8ClientKeyInvalid, err)
+	}
+	contentKey, err := hkdf.Key(sha256.New, sharedSecret, nil, c3u8HKDFInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	keyHash := sha256.Sum256(clientKeyBytes)
+	keyID := hex.EncodeToString(keyHash[:8])
+	nonce := make([]byte, c3u8NonceSize)
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	cipherData := gcm.Seal(nil, nonce, []byte(content), []byte(c3u8AAD(keyID)))
+	return &C3u8Envelope{
+		Version:            C3u8Version,
+		KeyID:              keyID,
+		Algorithm:          algorithm,
+		EphemeralPublicKey: base64.RawURLEncoding.EncodeToString(serverKey.PublicKey().Bytes()),
+		Nonce:              base64.RawURLEncoding.EncodeToString(nonce),
+		Info:               base64.StdEncoding.EncodeToString(cipherData),
+	}, nil
+}
+
+// c3u8AAD AES-GCM 的附加数据，绑定协议版本和密钥 ID
+func c3u8AAD(keyID string) string {
+	return fmt.Sprintf("cine-c3u8:v%d:%s", C3u8Version, keyID)
+}
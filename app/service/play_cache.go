@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aldge/cine_stream/app/dao"
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/config"
+	"github.com/aldge/cine_stream/logger"
+	"github.com/aldge/cine_stream/utils"
+	"github.com/aldge/gopkg/app"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// playlistCacheKeyPrefix 播放列表缓存 key 前缀
+const playlistCacheKeyPrefix = "cine_stream:playlist:"
+
+// playlistCatalog 生成 m3u8 需要的查询结果，按 app、视频、清晰度缓存
+// 清晰度的条目保存切片和加密信息；视频的条目（key 中的清晰度为空）保存各清晰度的切片统计、音轨和直播信息
+// 缓存的是查询结果而不是 m3u8 内容：m3u8 中的密钥 token 和 CDN 签名按用户、会话生成，不能共用
+// 从缓存取出的数据是共享的，只读不能修改
+type playlistCatalog struct {
+	TSList          []entity.VideoTSEntity         `json:"ts_list,omitempty"`
+	EncryptList     []entity.VideoEncryptEntity    `json:"encrypt_list,omitempty"`
+	DefinitionStats []entity.VideoTSDefinitionStat `json:"definition_stats,omitempty"`
+	AudioList       []entity.VideoAudioEntity      `json:"audio_list,omitempty"`
+	Live            *entity.VideoLiveEntity        `json:"live,omitempty"` // 不是直播时为 nil
+}
+
+var (
+	playlistLRUOnce sync.Once
+	playlistLRU     *utils.LRUCache[string, *playlistCatalog]
+	// playlistLocalVersions 没有使用 Redis 时，视频的缓存版本（app:video_id -> 版本号），失效时加一
+	playlistLocalVersions sync.Map
+)
+
+// getPlaylistLRU 获取进程内的播放列表 LRU 缓存
+func getPlaylistLRU() *utils.LRUCache[string, *playlistCatalog] {
+	playlistLRUOnce.Do(func() {
+		cacheConf := config.GetAppConf().GetPlaylistCacheConf()
+		playlistLRU = utils.NewLRUCache[string, *playlistCatalog](cacheConf.LRUSize, time.Duration(cacheConf.TTLSeconds)*time.Second)
+	})
+	return playlistLRU
+}
+
+// playlistRedis 播放列表缓存使用的 Redis，没有开启时返回 nil
+func playlistRedis() *redis.Client {
+	if !config.GetAppConf().GetPlaylistCacheConf().UseRedis {
+		return nil
+	}
+	return dao.GetRedis()
+}
+
+// contextAppName 获取请求的 app 名称，不是 gin 请求时为空
+func contextAppName(ctx context.Context) string {
+	ginCtx, ok := ctx.(*gin.Context)
+	if !ok {
+		return ""
+	}
+	return string(app.GetAppName(ginCtx))
+}
+
+// playlistVersionKey 视频缓存版本的 key
+func playlistVersionKey(appName, videoID string) string {
+	return playlistCacheKeyPrefix + "ver:" + appName + ":" + videoID
+}
+
+// playlistCacheKey 生成清晰度的缓存 key，key 中带上视频的缓存版本，失效时版本变化
+// 读取 Redis 中的版本失败时返回 false，本次不使用缓存
+func playlistCacheKey(ctx context.Context, appName, videoID, definition string) (string, bool) {
+	var version int64
+	if client := playlistRedis(); client != nil {
+		var err error
+		version, err = client.Get(ctx, playlistVersionKey(appName, videoID)).Int64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			logger.WithContext(ctx).Warnf("[playlistCacheKey] 读取缓存版本失败: %v", err)
+			return "", false
+		}
+	} else if value, ok := playlistLocalVersions.Load(appName + ":" + videoID); ok {
+		version = value.(int64)
+	}
+	return fmt.Sprintf("%s%s:%s:%s:%d", playlistCacheKeyPrefix, appName, videoID, definition, version), true
+}
+
+// loadPlaylistCatalog 查询清晰度的切片和视频的加密信息
+func (p *Play) loadPlaylistCatalog(ctx *gin.Context, videoID, definition string) (*playlistCatalog, error) {
+	return loadCachedPlaylistCatalog(ctx, videoID, definition, func() (*playlistCatalog, bool, error) {
+		tsList, err := p.daoVideoTS.GetByVideoDefinition(videoID, definition)
+		if err != nil {
+			return nil, false, errors.New("查询TS切片列表失败")
+		}
+		encryptList, err := p.daoVideoEncrypt.GetListByVideoID(videoID)
+		if err != nil {
+			return nil, false, errors.New("获取视频加密信息失败")
+		}
+		// 没有切片时不缓存，避免切片入库前的请求缓存空结果
+		return &playlistCatalog{TSList: tsList, EncryptList: encryptList}, len(tsList) > 0, nil
+	})
+}
+
+// loadVideoCatalog 查询视频各清晰度（含音轨）的切片统计、音轨和直播信息
+func (p *Play) loadVideoCatalog(videoID string) (*playlistCatalog, error) {
+	return loadCachedPlaylistCatalog(p.ctx, videoID, "", func() (*playlistCatalog, bool, error) {
+		statList, err := p.daoVideoTS.GetDefinitionStats(videoID)
+		if err != nil {
+			return nil, false, errors.New("查询视频清晰度失败")
+		}
+		audioList, err := p.daoVideoAudio.GetListByVideoID(videoID)
+		if err != nil {
+			return nil, false, errors.New("查询视频音轨失败")
+		}
+		// 没有直播信息的视频按点播处理
+		live, err := p.daoVideoLive.GetByVideoID(videoID)
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			live, err = nil, nil
+		}
+		if err != nil {
+			return nil, false, errors.New("查询直播信息失败")
+		}
+		return &playlistCatalog{DefinitionStats: statList, AudioList: audioList, Live: live}, len(statList) > 0, nil
+	})
+}
+
+// loadCachedPlaylistCatalog 开启缓存时优先读进程内缓存，再读 Redis，都没有时调用 load 查询，load 返回是否可以缓存
+func loadCachedPlaylistCatalog(ctx context.Context, videoID, definition string,
+	load func() (*playlistCatalog, bool, error)) (*playlistCatalog, error) {
+	cacheConf := config.GetAppConf().GetPlaylistCacheConf()
+	cacheKey, cacheable := "", false
+	if cacheConf.Enabled {
+		cacheKey, cacheable = playlistCacheKey(ctx, contextAppName(ctx), videoID, definition)
+	}
+	if cacheable {
+		if catalog, ok := getPlaylistLRU().Get(cacheKey); ok {
+			return catalog, nil
+		}
+		if catalog, ok := getRedisPlaylistCatalog(ctx, cacheKey); ok {
+			getPlaylistLRU().Set(cacheKey, catalog)
+			return catalog, nil
+		}
+	}
+
+	catalog, cache, err := load()
+	if err != nil {
+		return nil, err
+	}
+	if cacheable && cache {
+		getPlaylistLRU().Set(cacheKey, catalog)
+		setRedisPlaylistCatalog(ctx, cacheKey, catalog, time.Duration(cacheConf.TTLSeconds)*time.Second)
+	}
+	return catalog, nil
+}
+
+// getRedisPlaylistCatalog 从 Redis 读取缓存
+func getRedisPlaylistCatalog(ctx context.Context, cacheKey string) (*playlistCatalog, bool) {
+	client := playlistRedis()
+	if client == nil {
+		return nil, false
+	}
+	data, err := client.Get(ctx, cacheKey).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			logger.WithContext(ctx).Warnf("[getRedisPlaylistCatalog] 读取缓存失败: %v", err)
+		}
+		return nil, false
+	}
+	var catalog playlistCatalog
+	if err = json.Unmarshal(data, &catalog); err != nil {
+		logger.WithContext(ctx).Warnf("[getRedisPlaylistCatalog] 解析缓存失败: %v", err)
+		return nil, false
+	}
+	return &catalog, true
+}
+
+// setRedisPlaylistCatalog 写入 Redis 缓存
+func setRedisPlaylistCatalog(ctx context.Context, cacheKey string, catalog *playlistCatalog, ttl time.Duration) {
+	client := playlistRedis()
+	if client == nil {
+		return
+	}
+	data, err := json.Marshal(catalog)
+	if err != nil {
+		return
+	}
+	if err = client.Set(ctx, cacheKey, data, ttl).Err(); err != nil {
+		logger.WithContext(ctx).Warnf("[setRedisPlaylistCatalog] 写入缓存失败: %v", err)
+	}
+}
+
+// invalidatePlaylistCache 视频的切片、加密信息或音轨变化时，使视频的播放列表缓存失效，同时增加播放内容版本
+func invalidatePlaylistCache(ctx context.Context, videoID string) {
+	bumpPlayRevision(ctx, videoID, PlayRevisionSegments|PlayRevisionKeys|PlayRevisionAudios)
+	bumpPlaylistCacheVersion(ctx, videoID)
+}
+
+// bumpPlaylistCacheVersion 增加视频的缓存版本，使视频和所有清晰度的缓存失效
+// 使用 Redis 时增加 Redis 中的版本，所有实例同时失效；否则只失效当前实例，其它实例等缓存过期
+func bumpPlaylistCacheVersion(ctx context.Context, videoID string) {
+	appName := contextAppName(ctx)
+	if client := playlistRedis(); client != nil {
+		if err := client.Incr(ctx, playlistVersionKey(appName, videoID)).Err(); err != nil {
+			logger.WithContext(ctx).Errorf("[bumpPlaylistCacheVersion] 更新缓存版本失败: %v, video_id: %s", err, videoID)
+		}
+	}
+	versionKey := appName + ":" + videoID
+	for {
+		value, loaded := playlistLocalVersions.LoadOrStore(versionKey, int64(1))
+		if !loaded || playlistLocalVersions.CompareAndSwap(versionKey, value, value.(int64)+1) {
+			break
+		}
+	}
+	// 当前实例的旧版本缓存直接删除，不用等淘汰
+	prefix := playlistCacheKeyPrefix + appName + ":" + videoID + ":"
+	getPlaylistLRU().DeleteFunc(func(key string) bool {
+		return strings.HasPrefix(key, prefix)
+	})
+}
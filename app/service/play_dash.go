@@ -0,0 +1,392 @@
+package service
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	dashTimescale          = 1000 // SegmentTimeline 的时间单位：毫秒
+	dashProfileISOFF       = "urn:mpeg:dash:profile:isoff-main:2011"
+	dashProfileMP2T        = "urn:mpeg:dash:profile:mp2t-main:2011"
+	dashMimeTypeFMP4       = "video/mp4"
+	dashMimeTypeMP2T       = "video/mp2t"
+	dashMimeTypeAudioFMP4  = "audio/mp4"
+	dashMimeTypeAudioMP2T  = "audio/mp2t"
+	dashSchemeAudioChannel = "urn:mpeg:dash:23003:3:audio_channel_configuration:2011"
+	dashSchemeRole         = "urn:mpeg:dash:role:2011"
+	dashNamespace          = "urn:mpeg:dash:schema:mpd:2011"
+	dashPeriodID           = "0"
+	dashAdaptationFMP4     = "fmp4"
+	dashAdaptationMP2T     = "ts"
+)
+
+var (
+	// ErrDashLiveUnsupported 直播中的视频不输出 DASH
+	ErrDashLiveUnsupported = errors.New("直播中的视频暂不支持 DASH")
+	// ErrDashEncryptedUnsupported 切片使用 HLS 整段 AES-128 加密，DASH 播放器无法解密
+	ErrDashEncryptedUnsupported = errors.New("加密的视频暂不支持 DASH")
+)
+
+// dashMPD DASH MPD 根节点
+type dashMPD struct {
+	XMLName                   xml.Name     `xml:"MPD"`
+	XMLNS                     string       `xml:"xmlns,attr"`
+	Type                      string       `xml:"type,attr"`
+	Profiles                  string       `xml:"profiles,attr"`
+	MinBufferTime             string       `xml:"minBufferTime,attr"`
+	MediaPresentationDuration string       `xml:"mediaPresentationDuration,attr"`
+	Periods                   []dashPeriod `xml:"Period"`
+}
+
+// dashPeriod DASH Period
+type dashPeriod struct {
+	ID             string              `xml:"id,attr"`
+	Start          string              `xml:"start,attr"`
+	AdaptationSets []dashAdaptationSet `xml:"AdaptationSet"`
+}
+
+// dashAdaptationSet DASH AdaptationSet，同一封装格式的清晰度放在一组，每个音轨单独一组
+type dashAdaptationSet struct {
+	ID                 string               `xml:"id,attr"`
+	ContentType        string               `xml:"contentType,attr"`
+	MimeType           string               `xml:"mimeType,attr"`
+	Lang               string               `xml:"lang,attr,omitempty"`
+	SegmentAlignment   bool                 `xml:"segmentAlignment,attr"`
+	BitstreamSwitching bool                 `xml:"bitstreamSwitching,attr,omitempty"`
+	Role               *dashDescriptor      `xml:"Role,omitempty"`
+	Representations    []dashRepresentation `xml:"Representation"`
+}
+
+// dashDescriptor DASH 的 Role、AudioChannelConfiguration 等描述符
+type dashDescriptor struct {
+	SchemeIDURI string `xml:"schemeIdUri,attr"`
+	Value       string `xml:"value,attr"`
+}
+
+// dashRepresentation DASH Representation，对应一个清晰度
+type dashRepresentation struct {
+	ID                        string          `xml:"id,attr"`
+	Bandwidth                 int64           `xml:"bandwidth,attr"`
+	Width                     int             `xml:"width,attr,omitempty"`
+	Height                    int             `xml:"height,attr,omitempty"`
+	Codecs                    string          `xml:"codecs,attr,omitempty"`
+	AudioChannelConfiguration *dashDescriptor `xml:"AudioChannelConfiguration,omitempty"`
+	SegmentList               dashSegmentList `xml:"SegmentList"`
+}
+
+// dashSegmentList DASH SegmentList，切片时长用 SegmentTimeline 精确描述
+type dashSegmentList struct {
+	Timescale       int                 `xml:"timescale,attr"`
+	StartNumber     int64               `xml:"startNumber,attr"`
+	Initialization  *dashURL            `xml:"Initialization,omitempty"`
+	SegmentTimeline dashSegmentTimeline `xml:"SegmentTimeline"`
+	SegmentURLs     []dashSegmentURL    `xml:"SegmentURL"`
+}
+
+// dashURL DASH Initialization
+type dashURL struct {
+	SourceURL string `xml:"sourceURL,attr"`
+	Range     string `xml:"range,attr,omitempty"`
+}
+
+// dashSegmentTimeline DASH SegmentTimeline
+type dashSegmentTimeline struct {
+	S []dashTimelineS `xml:"S"`
+}
+
+// dashTimelineS SegmentTimeline 中的一段，连续 r+1 个时长相同的切片合并为一段
+type dashTimelineS struct {
+	T *int64 `xml:"t,attr,omitempty"`
+	D int64  `xml:"d,attr"`
+	R int64  `xml:"r,attr,omitempty"`
+}
+
+// dashSegmentURL DASH SegmentURL
+type dashSegmentURL struct {
+	Media      string `xml:"media,attr"`
+	MediaRange string `xml:"mediaRange,attr,omitempty"`
+}
+
+// GenerateDASHManifest 生成 DASH MPD，每个清晰度一个 Representation，切片与 m3u8 使用相同的 cine_video_ts 数据
+func (p *Play) GenerateDASHManifest(ctx *gin.Context, videoID string) (string, error) {
+	if videoID == "" {
+		return "", errors.New("视频ID不能为空")
+	}
+	video, err := p.loadVideoCatalog(videoID)
+	if err != nil {
+		return "", err
+	}
+	if video.Live != nil && !video.Live.IsEnded() {
+		return "", ErrDashLiveUnsupported
+	}
+
+	renditions, err := newPlayRenditions(video)
+	if err != nil {
+		return "", err
+	}
+	encryptList, err := p.daoVideoEncrypt.GetListByVideoID(videoID)
+	if err != nil {
+		return "", errors.New("获取视频加密信息失败")
+	}
+	// 开启切片代理时，切片地址带播放密钥 token 校验权限
+	segmentURLs := newSegmentURLBuilder(ctx, videoID, "")
+	if code, ok := NewWatermark(ctx).UserCode(ctx); ok {
+		segmentURLs.withWatermark(code)
+	}
+	variants := make([]playVariant, 0, len(renditions.videoStats))
+	for _, stat := range renditions.videoStats {
+		variants = append(variants, buildPlayVariant(stat))
+	}
+	sort.SliceStable(variants, func(i, j int) bool {
+		return variants[i].bandwidth < variants[j].bandwidth
+	})
+
+	// 按封装格式分组，fmp4 和 ts 不能放在同一个 AdaptationSet
+	adaptationSets := map[string]*dashAdaptationSet{}
+	maxDuration := 0.0
+	for _, variant := range variants {
+		tsList, err := p.daoVideoTS.GetByVideoDefinition(videoID, variant.definition)
+		if err != nil {
+			return "", errors.New("查询TS切片列表失败")
+		}
+		if len(tsList) == 0 {
+			continue
+		}
+		for _, ts := range tsList[1:] {
+			if ts.IsFMP4() != tsList[0].IsFMP4() {
+				return "", fmt.Errorf("清晰度 %s 的切片封装格式不一致", variant.definition)
+			}
+		}
+		if hasSegmentEncrypt(encryptList, tsList) {
+			return "", ErrDashEncryptedUnsupported
+		}
+		representation, duration := buildDASHRepresentation(segmentURLs, variant, tsList)
+		if duration > maxDuration {
+			maxDuration = duration
+		}
+
+		adaptationID, mimeType := dashAdaptationMP2T, dashMimeTypeMP2T
+		if tsList[0].IsFMP4() {
+			adaptationID, mimeType = dashAdaptationFMP4, dashMimeTypeFMP4
+		}
+		adaptationSet, ok := adaptationSets[adaptationID]
+		if !ok {
+			adaptationSet = &dashAdaptationSet{
+				ID:               adaptationID,
+				ContentType:      "video",
+				MimeType:         mimeType,
+				SegmentAlignment: true,
+			}
+			adaptationSets[adaptationID] = adaptationSet
+		}
+		adaptationSet.Representations = append(adaptationSet.Representations, representation)
+	}
+
+	period := dashPeriod{ID: dashPeriodID, Start: "PT0S"}
+	for _, adaptationID := range []string{dashAdaptationFMP4, dashAdaptationMP2T} {
+		if adaptationSet, ok := adaptationSets[adaptationID]; ok {
+			period.AdaptationSets = append(period.AdaptationSets, *adaptationSet)
+		}
+	}
+
+	// 每个音轨一个 AdaptationSet
+	for _, audio := range renditions.audioList {
+		adaptationSet, duration, err := p.buildDASHAudioAdaptationSet(segmentURLs, videoID, audio, encryptList)
+		if err != nil {
+			return "", err
+		}
+		if adaptationSet == nil {
+			continue
+		}
+		if duration > maxDuration {
+			maxDuration = duration
+		}
+		period.AdaptationSets = append(period.AdaptationSets, *adaptationSet)
+	}
+
+	// 按实际用到的封装格式声明 profile
+	var hasFMP4, hasMP2T bool
+	for _, adaptationSet := range period.AdaptationSets {
+		switch adaptationSet.MimeType {
+		case dashMimeTypeFMP4, dashMimeTypeAudioFMP4:
+			hasFMP4 = true
+		default:
+			hasMP2T = true
+		}
+	}
+	var profiles []string
+	if hasFMP4 {
+		profiles = append(profiles, dashProfileISOFF)
+	}
+	if hasMP2T {
+		profiles = append(profiles, dashProfileMP2T)
+	}
+
+	mpd := dashMPD{
+		XMLNS:                     dashNamespace,
+		Type:                      "static",
+		Profiles:                  strings.Join(profiles, ","),
+		MinBufferTime:             "PT2S",
+		MediaPresentationDuration: formatDASHDuration(maxDuration),
+		Periods:                   []dashPeriod{period},
+	}
+	content, err := xml.MarshalIndent(mpd, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("生成MPD失败: %w", err)
+	}
+	return xml.Header + string(content) + "\n", nil
+}
+
+// hasSegmentEncrypt 是否有切片使用了加密信息
+// 加密信息是 HLS 的整段 AES-128-CBC，MPD 没有对应的 ContentProtection，输出后无法播放
+func hasSegmentEncrypt(encryptList []entity.VideoEncryptEntity, tsList []entity.VideoTSEntity) bool {
+	if len(encryptList) == 0 {
+		return false
+	}
+	for _, ts := range tsList {
+		if findSegmentEncrypt(encryptList, ts.Definition, ts.TSSequence) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// buildDASHAudioAdaptationSet 生成一个音轨的 AdaptationSet，音轨没有切片时返回 nil
+// 音轨的切片有加密信息时返回 ErrDashEncryptedUnsupported
+func (p *Play) buildDASHAudioAdaptationSet(segmentURLs *segmentURLBuilder, videoID string, audio playAudio,
+	encryptList []entity.VideoEncryptEntity) (*dashAdaptationSet, float64, error) {
+	tsList, err := p.daoVideoTS.GetByVideoDefinition(videoID, audio.audio.Definition)
+	if err != nil {
+		return nil, 0, errors.New("查询音轨切片列表失败")
+	}
+	if len(tsList) == 0 {
+		return nil, 0, nil
+	}
+	for _, ts := range tsList[1:] {
+		if ts.IsFMP4() != tsList[0].IsFMP4() {
+			return nil, 0, fmt.Errorf("音轨 %s 的切片封装格式不一致", audio.audio.Definition)
+		}
+	}
+	if hasSegmentEncrypt(encryptList, tsList) {
+		return nil, 0, ErrDashEncryptedUnsupported
+	}
+	variant := playVariant{
+		definition: audio.audio.Definition,
+		bandwidth:  audio.bandwidth,
+		codecs:     audio.audio.Codecs,
+	}
+	representation, duration := buildDASHRepresentation(segmentURLs, variant, tsList)
+	representation.AudioChannelConfiguration = &dashDescriptor{
+		SchemeIDURI: dashSchemeAudioChannel,
+		Value:       strconv.Itoa(audio.audio.Channels),
+	}
+
+	mimeType := dashMimeTypeAudioMP2T
+	if tsList[0].IsFMP4() {
+		mimeType = dashMimeTypeAudioFMP4
+	}
+	adaptationSet := &dashAdaptationSet{
+		ID:               audio.audio.Definition,
+		ContentType:      "audio",
+		MimeType:         mimeType,
+		Lang:             audio.audio.Language,
+		SegmentAlignment: true,
+		Representations:  []dashRepresentation{representation},
+	}
+	if audio.audio.IsDefault {
+		adaptationSet.Role = &dashDescriptor{SchemeIDURI: dashSchemeRole, Value: "main"}
+	}
+	return adaptationSet, duration, nil
+}
+
+// buildDASHRepresentation 生成一个清晰度的 Representation，返回 Representation 和总时长(秒)
+func buildDASHRepresentation(segmentURLs *segmentURLBuilder, variant playVariant, tsList []entity.VideoTSEntity) (dashRepresentation, float64) {
+	representation := dashRepresentation{
+		ID:        variant.definition,
+		Bandwidth: variant.bandwidth,
+		Codecs:    variant.codecs,
+	}
+	representation.Width, representation.Height = parseResolution(variant.resolution)
+
+	segmentList := dashSegmentList{
+		Timescale:   dashTimescale,
+		StartNumber: tsList[0].TSSequence,
+	}
+	// DASH 的一个 Representation 只有一个初始化切片，使用第一个切片的
+	if tsList[0].IsFMP4() {
+		segmentList.Initialization = &dashURL{SourceURL: segmentURLs.init(tsList[0])}
+		if tsList[0].InitByteLength > 0 {
+			segmentList.Initialization.Range = formatDASHRange(tsList[0].InitByteOffset, tsList[0].InitByteLength)
+		}
+	}
+
+	totalDuration := 0.0
+	var start int64
+	for i, ts := range tsList {
+		d := int64(math.Round(ts.Duration * dashTimescale))
+		timeline := segmentList.SegmentTimeline.S
+		if n := len(timeline); n > 0 && timeline[n-1].D == d {
+			timeline[n-1].R++
+		} else {
+			s := dashTimelineS{D: d}
+			if i == 0 {
+				s.T = &start
+			}
+			segmentList.SegmentTimeline.S = append(timeline, s)
+		}
+
+		segmentURL := dashSegmentURL{Media: segmentURLs.segment(ts)}
+		if ts.IsByteRange() {
+			segmentURL.MediaRange = formatDASHRange(ts.ByteOffset, ts.ByteLength)
+		}
+		segmentList.SegmentURLs = append(segmentList.SegmentURLs, segmentURL)
+		totalDuration += ts.Duration
+	}
+	representation.SegmentList = segmentList
+	return representation, totalDuration
+}
+
+// parseResolution 解析 1920x1080 格式的分辨率
+func parseResolution(resolution string) (int, int) {
+	parts := strings.SplitN(strings.ToLower(resolution), "x", 2)
+	if len(parts) != 2 {
+		return 0, 0
+	}
+	width, err1 := strconv.Atoi(parts[0])
+	height, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil {
+		return 0, 0
+	}
+	return width, height
+}
+
+// formatDASHRange 生成 DASH 的字节范围 first-last（包含 last）
+func formatDASHRange(offset, length int64) string {
+	return fmt.Sprintf("%d-%d", offset, offset+length-1)
+}
+
+// formatDASHDuration 生成 ISO 8601 时长，如 PT1H2M3.456S
+func formatDASHDuration(seconds float64) string {
+	ms := int64(math.Round(seconds * 1000))
+	hours := ms / 3600000
+	ms %= 3600000
+	minutes := ms / 60000
+	ms %= 60000
+	duration := "PT"
+	if hours > 0 {
+		duration += fmt.Sprintf("%dH", hours)
+	}
+	if minutes > 0 {
+		duration += fmt.Sprintf("%dM", minutes)
+	}
+	return duration + strconv.FormatFloat(float64(ms)/1000, 'f', -1, 64) + "S"
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// ErrIFrameNotFound 清晰度没有关键帧信息
+	ErrIFrameNotFound = errors.New("清晰度没有关键帧信息")
+	// ErrIFrameEncrypted 清晰度的切片加密，关键帧的字节范围无法单独解密
+	ErrIFrameEncrypted = errors.New("加密的清晰度不提供 I-frame 列表")
+)
+
+// buildIFrameStreamTag 生成主 m3u8 中清晰度对应的 #EXT-X-I-FRAME-STREAM-INF，query 追加到 I-frame m3u8 地址
+func buildIFrameStreamTag(videoID, appName, query string, variant playVariant) string {
+	attrs := []string{fmt.Sprintf("BANDWIDTH=%d", variant.bandwidth)}
+	if variant.resolution != "" {
+		attrs = append(attrs, "RESOLUTION="+variant.resolution)
+	}
+	if variant.codecs != "" {
+		attrs = append(attrs, fmt.Sprintf(`CODECS="%s"`, variant.codecs))
+	}
+	attrs = append(attrs, fmt.Sprintf(`URI="%s"`, buildIFramePlaylistURL(videoID, variant.definition, appName)+query))
+	return "#EXT-X-I-FRAME-STREAM-INF:" + strings.Join(attrs, ",") + "\n"
+}
+
+// buildIFramePlaylistURL 生成清晰度对应的 I-frame m3u8 地址
+func buildIFramePlaylistURL(videoID, definition, appName string) string {
+	return fmt.Sprintf("/play/%s/%s/iframe.m3u8?app=%s", videoID, url.PathEscape(definition), url.QueryEscape(appName))
+}
+
+// GenerateIFrameM3U8Content 生成单个清晰度的 I-frame m3u8 内容，用于快进快退时的预览
+// 每个关键帧一条，时长为到下一个关键帧的时间，地址为切片加关键帧的字节范围；
+// 整段 AES-128 加密的切片中关键帧的字节范围无法单独解密，有关键帧的切片加密时返回 ErrIFrameEncrypted
+func (p *Play) GenerateIFrameM3U8Content(ctx *gin.Context, videoID, definition string) (string, error) {
+	definition, err := p.ResolveDefinition(videoID, definition)
+	if err != nil {
+		return "", err
+	}
+	catalog, err := p.loadPlaylistCatalog(ctx, videoID, definition)
+	if err != nil {
+		return "", err
+	}
+	tsList, encryptList := catalog.TSList, catalog.EncryptList
+
+	// 关键帧在整个视频中的开始时间，最后一个关键帧持续到视频结束
+	type iframe struct {
+		ts         entity.VideoTSEntity
+		keyframe   entity.VideoTSKeyframe
+		start      float64
+		duration   float64
+		byteOffset int64
+	}
+	var iframes []*iframe
+	var segmentStart float64
+	for _, ts := range tsList {
+		keyframes := ts.GetKeyframes()
+		if len(keyframes) > 0 && findSegmentEncrypt(encryptList, ts.Definition, ts.TSSequence) != nil {
+			return "", fmt.Errorf("%w: %s", ErrIFrameEncrypted, definition)
+		}
+		for _, keyframe := range keyframes {
+			iframes = append(iframes, &iframe{
+				ts:         ts,
+				keyframe:   keyframe,
+				start:      segmentStart + keyframe.TimeOffset,
+				byteOffset: ts.ByteOffset + keyframe.ByteOffset,
+			})
+		}
+		segmentStart += ts.Duration
+	}
+	if len(iframes) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrIFrameNotFound, definition)
+	}
+	maxDuration := 0.0
+	for i, frame := range iframes {
+		end := segmentStart
+		if i+1 < len(iframes) {
+			end = iframes[i+1].start
+		}
+		frame.duration = end - frame.start
+		if frame.duration > maxDuration {
+			maxDuration = frame.duration
+		}
+	}
+	targetDuration := int(math.Ceil(maxDuration))
+	if targetDuration < 1 {
+		targetDuration = 1
+	}
+	// I-frame 列表要求版本号至少为 4，fmp4 为 7
+	version := 4
+	if tsList[0].IsFMP4() {
+		version = 7
+	}
+
+	// 开启切片代理时，切片地址带播放密钥 token 校验权限；A/B 版本与媒体 m3u8 相同，两个版本的关键帧字节范围相同
+	segmentURLs := newSegmentURLBuilder(ctx, videoID, SignPlayKeyToken(ctx, videoID))
+	segmentURLs.applyWatermark(tsList)
+
+	var builder strings.Builder
+	builder.WriteString("#EXTM3U\n")
+	builder.WriteString(fmt.Sprintf("#EXT-X-VERSION:%d\n", version))
+	builder.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	builder.WriteString("#EXT-X-I-FRAMES-ONLY\n")
+	builder.WriteString(fmt.Sprintf("#EXT-X-MEDIA-SEQUENCE:%d\n", iframes[0].ts.TSSequence))
+	builder.WriteString(fmt.Sprintf("#EXT-X-TARGETDURATION:%d\n", targetDuration))
+	currentInitMap := ""
+	for _, frame := range iframes {
+		initMap := fmt.Sprintf("%s@%d-%d", frame.ts.InitPath, frame.ts.InitByteOffset, frame.ts.InitByteLength)
+		if frame.ts.IsFMP4() && initMap != currentInitMap {
+			builder.WriteString(buildMapTag(segmentURLs.init(frame.ts), frame.ts))
+			currentInitMap = initMap
+		}
+		builder.WriteString("#EXTINF:" + formatDuration(frame.duration) + ",\n")
+		builder.WriteString(fmt.Sprintf("#EXT-X-BYTERANGE:%d@%d\n", frame.keyframe.ByteLength, frame.byteOffset))
+		builder.WriteString(segmentURLs.segment(frame.ts) + "\n")
+	}
+	builder.WriteString("#EXT-X-ENDLIST\n")
+	return builder.String(), nil
+}
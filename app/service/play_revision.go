@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aldge/cine_stream/app/dao"
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/config"
+	"github.com/aldge/cine_stream/logger"
+	"github.com/aldge/gopkg/app"
+	"github.com/gin-gonic/gin"
+)
+
+// PlayRevisionSource 计算播放内容版本使用的数据
+type PlayRevisionSource int
+
+// 播放内容版本的数据来源，可以组合使用
+const (
+	PlayRevisionSegments   PlayRevisionSource = 1 << iota // TS 切片
+	PlayRevisionKeys                                      // 加密信息
+	PlayRevisionAudios                                    // 音轨
+	PlayRevisionSubtitles                                 // 字幕轨道
+	PlayRevisionThumbnails                                // 缩略图雪碧图
+	PlayRevisionLive                                      // 直播状态
+)
+
+// playRevisionKeyPrefix 播放内容版本 key 前缀，Redis 中每个视频一个 hash，字段为数据来源的版本号和 update_time
+const playRevisionKeyPrefix = "cine_stream:play_rev:"
+
+// playRevisionFields 数据来源在 hash 中的字段
+var playRevisionFields = []struct {
+	source PlayRevisionSource
+	field  string
+}{
+	{PlayRevisionSegments, "ts"},
+	{PlayRevisionKeys, "key"},
+	{PlayRevisionAudios, "audio"},
+	{PlayRevisionSubtitles, "subtitle"},
+	{PlayRevisionThumbnails, "thumbnail"},
+	{PlayRevisionLive, "live"},
+}
+
+var (
+	// playRevisionStartTime 进程启动时间，没有 Redis 时加入版本，重启后的版本不会与重启前的相同
+	playRevisionStartTime = time.Now().UnixNano()
+	// playLocalRevisions 没有 Redis 时视频的内容版本（app:video_id -> 字段 -> 版本号），只在当前实例有效
+	playLocalRevisions   = make(map[string]map[string]int64)
+	playLocalRevisionsMu sync.Mutex
+)
+
+// PlayRevision 播放接口响应内容的版本，用于 ETag 和 Last-Modified
+type PlayRevision struct {
+	ETag         string
+	LastModified time.Time
+}
+
+// playRevisionKey 视频内容版本的 key
+func playRevisionKey(appName, videoID string) string {
+	return playRevisionKeyPrefix + appName + ":" + videoID
+}
+
+// bumpPlayRevision 视频的数据变化后增加数据来源的版本，之后的请求得到新的 ETag
+// 有 Redis 时保存在 Redis 中，所有实例同时生效；否则只在当前实例生效，其它实例在 token 刷新周期后 ETag 变化
+func bumpPlayRevision(ctx context.Context, videoID string, sources PlayRevisionSource) {
+	appName := contextAppName(ctx)
+	timeNow := time.Now().Unix()
+	if client := dao.GetRedis(); client != nil {
+		key := playRevisionKey(appName, videoID)
+		pipe := client.TxPipeline()
+		for _, item := range playRevisionFields {
+			if sources&item.source != 0 {
+				pipe.HIncrBy(ctx, key, item.field, 1)
+			}
+		}
+		pipe.HSet(ctx, key, "update_time", timeNow)
+		if _, err := pipe.Exec(ctx); err != nil {
+			logger.WithContext(ctx).Errorf("[bumpPlayRevision] 更新内容版本失败: %v, video_id: %s", err, videoID)
+		}
+		return
+	}
+
+	playLocalRevisionsMu.Lock()
+	defer playLocalRevisionsMu.Unlock()
+	versions := playLocalRevisions[appName+":"+videoID]
+	if versions == nil {
+		versions = make(map[string]int64)
+		playLocalRevisions[appName+":"+videoID] = versions
+	}
+	for _, item := range playRevisionFields {
+		if sources&item.source != 0 {
+			versions[item.field]++
+		}
+	}
+	versions["update_time"] = timeNow
+}
+
+// loadPlayRevisionVersion 读取视频数据来源的版本和最后更新时间（unix 秒，没有记录时为 0）
+func loadPlayRevisionVersion(ctx context.Context, videoID string, sources PlayRevisionSource) (string, int64, error) {
+	appName := contextAppName(ctx)
+	fields := []string{"update_time"}
+	for _, item := range playRevisionFields {
+		if sources&item.source != 0 {
+			fields = append(fields, item.field)
+		}
+	}
+
+	values := make([]int64, len(fields))
+	prefix := "redis"
+	if client := dao.GetRedis(); client != nil {
+		result, err := client.HMGet(ctx, playRevisionKey(appName, videoID), fields...).Result()
+		if err != nil {
+			return "", 0, err
+		}
+		for i, value := range result {
+			if str, ok := value.(string); ok {
+				values[i], _ = strconv.ParseInt(str, 10, 64)
+			}
+		}
+	} else {
+		prefix = fmt.Sprintf("local:%d", playRevisionStartTime)
+		playLocalRevisionsMu.Lock()
+		versions := playLocalRevisions[appName+":"+videoID]
+		for i, field := range fields {
+			values[i] = versions[field]
+		}
+		playLocalRevisionsMu.Unlock()
+	}
+
+	parts := []string{prefix}
+	for i := 1; i < len(fields); i++ {
+		parts = append(parts, fmt.Sprintf("%s:%d", fields[i], values[i]))
+	}
+	return strings.Join(parts, ","), values[0], nil
+}
+
+// GetPlayRevision 计算播放接口响应内容的版本，相同的数据版本、用户、请求地址得到相同的 ETag
+// 数据版本在保存切片、密钥、音轨、字幕、缩略图和直播状态时增加（bumpPlayRevision），计算时不查询数据库
+// 响应中的密钥 token 和 CDN 签名有有效期，ETag 每半个有效期变化一次，客户端在 token 过期前能取到新的内容
+// variant 为影响响应内容的其它状态（如是否试看）
+func (p *Play) GetPlayRevision(ctx *gin.Context, videoID string, sources PlayRevisionSource, variant string) (*PlayRevision, error) {
+	version, lastModified, err := loadPlayRevisionVersion(ctx, videoID, sources)
+	if err != nil {
+		return nil, errors.New("查询内容版本失败")
+	}
+	parts := []string{
+		videoID,
+		string(app.GetAppName(ctx)),
+		playSessionID(ctx),
+		ctx.Request.URL.RequestURI(),
+		variant,
+		version,
+	}
+
+	// 切片地址使用的 CDN 变化时（调度、故障切换）内容也变化
+	for _, candidate := range playCDNList(ctx) {
+		parts = append(parts, candidate.name+":"+candidate.status)
+	}
+	window := playTokenWindow(ctx)
+	windowStart := time.Now().Unix() / window * window
+	parts = append(parts, fmt.Sprintf("window:%d", windowStart))
+	if windowStart > lastModified {
+		lastModified = windowStart
+	}
+
+	sum := sha1.Sum([]byte(strings.Join(parts, "\n")))
+	return &PlayRevision{
+		ETag:         `"` + hex.EncodeToString(sum[:12]) + `"`,
+		LastModified: time.Unix(lastModified, 0).UTC(),
+	}, nil
+}
+
+// GetKeyRevision 计算加密密钥响应的版本，密钥内容不变，只和密钥记录有关
+func GetKeyRevision(encrypt *entity.VideoEncryptEntity) *PlayRevision {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s:%d:%d", encrypt.VideoID, encrypt.VideoEncryptID, encrypt.CreateTime)))
+	return &PlayRevision{
+		ETag:         `"` + hex.EncodeToString(sum[:12]) + `"`,
+		LastModified: time.Unix(int64(encrypt.CreateTime), 0).UTC(),
+	}
+}
+
+// playTokenWindow 响应中 token 和签名的刷新周期（秒），为密钥 token 和 CDN 签名有效期中较短的一半
+func playTokenWindow(ctx *gin.Context) int64 {
+	expireSeconds := config.GetAppConf().GetAuthConf().KeyToken.ExpireSeconds
+	for _, candidate := range playCDNList(ctx) {
+		signConf := candidate.conf.Sign
+		if signConf.Type == config.CDNSignTypeNone || signConf.Secret == "" {
+			continue
+		}
+		if signConf.GetExpireSeconds() < expireSeconds {
+			expireSeconds = signConf.GetExpireSeconds()
+		}
+	}
+	window := int64(expireSeconds / 2)
+	if window < 1 {
+		window = 1
+	}
+	return window
+}
@@ -0,0 +1,517 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/config"
+	"github.com/aldge/cine_stream/logger"
+	"github.com/aldge/cine_stream/utils"
+	"github.com/aldge/gopkg/app"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// ErrSegmentProxyDisabled app 没有开启切片代理
+	ErrSegmentProxyDisabled = errors.New("没有开启切片代理")
+	// ErrSegmentNotFound 切片不存在
+	ErrSegmentNotFound = errors.New("切片不存在")
+	// ErrSegmentProxyBusy 回源请求过多，等待超时
+	ErrSegmentProxyBusy = errors.New("回源请求过多，请稍后重试")
+	// ErrSegmentOriginFailed 回源失败
+	ErrSegmentOriginFailed = errors.New("切片回源失败")
+)
+
+// segmentOriginHeaders 透传给播放器的源站响应头
+var segmentOriginHeaders = []string{"Content-Length", "Content-Range", "Accept-Ranges", "ETag", "Last-Modified"}
+
+// PlaySegment 代理的切片内容，使用后需要调用 Close
+// File 不为空时内容来自磁盘缓存，由调用方按请求的 Range 输出；否则为透传的源站响应
+type PlaySegment struct {
+	File        *os.File       // 磁盘缓存中的切片
+	ModTime     time.Time      // 缓存文件的修改时间，作为 Last-Modified
+	Response    *http.Response // 源站响应（状态码、响应头、内容）
+	ContentType string
+}
+
+// Close 关闭文件或源站响应
+func (s *PlaySegment) Close() {
+	if s.File != nil {
+		_ = s.File.Close()
+	}
+	if s.Response != nil {
+		_ = s.Response.Body.Close()
+	}
+}
+
+// OriginHeaders 需要透传给播放器的源站响应头
+func (s *PlaySegment) OriginHeaders() http.Header {
+	header := http.Header{}
+	if s.Response == nil {
+		return header
+	}
+	for _, name := range segmentOriginHeaders {
+		if value := s.Response.Header.Get(name); value != "" {
+			header.Set(name, value)
+		}
+	}
+	return header
+}
+
+// segmentProxy 回源的并发限制、HTTP 客户端和磁盘缓存，按启动时的配置创建
+type segmentProxy struct {
+	slots        chan struct{} // 等待源站响应的回源名额
+	streams      chan struct{} // 透传源站响应的名额，输出结束时归还
+	queueTimeout time.Duration
+	idleTimeout  time.Duration    // 透传时两次读取之间的最长时间
+	client       *http.Client     // 写入磁盘缓存的回源，超时含读取内容
+	streamClient *http.Client     // 透传的回源，限制连接和等待响应头的时间，读取内容的速度跟随播放器，空闲超时由 segmentStreamBody 控制
+	cache        *utils.DiskCache // 没有配置缓存目录时为 nil
+	maxFileSize  int64
+
+	mu    sync.Mutex
+	fills map[string]*segmentFill // 正在写入磁盘缓存的切片，相同切片只回源一次
+}
+
+// segmentFill 一次写入磁盘缓存的回源
+type segmentFill struct {
+	done chan struct{}
+	err  error
+}
+
+var (
+	segmentProxyOnce     sync.Once
+	segmentProxyInstance *segmentProxy
+)
+
+// getSegmentProxy 获取切片代理
+func getSegmentProxy() *segmentProxy {
+	segmentProxyOnce.Do(func() {
+		proxyConf := config.GetAppConf().GetSegmentProxyConf()
+		timeout := time.Duration(proxyConf.TimeoutSeconds) * time.Second
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = (&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}).DialContext
+		transport.ResponseHeaderTimeout = timeout
+		proxy := &segmentProxy{
+			slots:        make(chan struct{}, proxyConf.MaxConcurrency),
+			streams:      make(chan struct{}, proxyConf.MaxStreams),
+			queueTimeout: time.Duration(proxyConf.QueueTimeoutMs) * time.Millisecond,
+			idleTimeout:  timeout,
+			client:       &http.Client{Transport: transport, Timeout: timeout},
+			streamClient: &http.Client{Transport: transport},
+			maxFileSize:  proxyConf.CacheMaxFileSizeMB << 20,
+			fills:        make(map[string]*segmentFill),
+		}
+		if proxyConf.CacheDir != "" {
+			cache, err := utils.NewDiskCache(proxyConf.CacheDir, proxyConf.CacheMaxMB<<20)
+			if err != nil {
+				logger.WithContext(context.Background()).Errorf("[getSegmentProxy] 初始化切片磁盘缓存失败，不使用缓存: %v", err)
+			} else {
+				proxy.cache = cache
+			}
+		}
+		segmentProxyInstance = proxy
+	})
+	return segmentProxyInstance
+}
+
+// acquire 获取回源名额，等待超过 queueTimeout 返回 ErrSegmentProxyBusy
+func (sp *segmentProxy) acquire(ctx context.Context) (func(), error) {
+	return sp.acquireSlot(ctx, sp.slots)
+}
+
+// acquireSlot 从 slots 获取名额，等待超过 queueTimeout 返回 ErrSegmentProxyBusy，返回的归还函数可以多次调用
+func (sp *segmentProxy) acquireSlot(ctx context.Context, slots chan struct{}) (func(), error) {
+	timer := time.NewTimer(sp.queueTimeout)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		var once sync.Once
+		return func() { once.Do(func() { <-slots }) }, nil
+	case <-timer.C:
+		return nil, ErrSegmentProxyBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// segmentURLBuilder 生成播放列表中的切片地址
+// 开启切片代理的 app 指向 /play/:video_id/seg/:seq（带密钥 token 校验权限），否则指向 CDN
+type segmentURLBuilder struct {
+	ctx           *gin.Context
+	proxy         bool
+	baseURL       string
+	videoID       string
+	appName       string
+	keyToken      string
+	watermark     bool   // 是否按水印码选择 A/B 版本
+	watermarkCode uint64 // 用户的水印码
+}
+
+// newSegmentURLBuilder 创建切片地址生成器，keyToken 为空时签发播放密钥 token
+func newSegmentURLBuilder(ctx *gin.Context, videoID, keyToken string) *segmentURLBuilder {
+	appName := string(app.GetAppName(ctx))
+	builder := &segmentURLBuilder{
+		ctx:     ctx,
+		proxy:   config.GetAppConf().GetSegmentProxyAppConf(appName).Enabled,
+		videoID: videoID,
+		appName: appName,
+	}
+	if builder.proxy {
+		builder.baseURL = utils.GetRequestBaseURL(ctx)
+		builder.keyToken = keyToken
+		if builder.keyToken == "" {
+			builder.keyToken = SignPlayKeyToken(ctx, videoID)
+		}
+	}
+	return builder
+}
+
+// withWatermark 按用户的水印码为有 B 版本的切片选择 A/B 版本
+func (b *segmentURLBuilder) withWatermark(code uint64) {
+	b.watermark = true
+	b.watermarkCode = code
+}
+
+// applyWatermark 列表中有 B 版本的切片时，按当前用户的水印码选择 A/B 版本
+func (b *segmentURLBuilder) applyWatermark(tsList []entity.VideoTSEntity) {
+	for _, ts := range tsList {
+		if ts.HasVariantB() {
+			if code, ok := NewWatermark(b.ctx).UserCode(b.ctx); ok {
+				b.withWatermark(code)
+			}
+			return
+		}
+	}
+}
+
+// variantB 切片是否使用 B 版本
+func (b *segmentURLBuilder) variantB(ts entity.VideoTSEntity) bool {
+	return b.watermark && ts.HasVariantB() && watermarkVariantB(b.watermarkCode, ts.TSSequence)
+}
+
+// segment 切片地址，切片代理的 A/B 版本由服务端按 token 的用户选择，地址中不区分
+func (b *segmentURLBuilder) segment(ts entity.VideoTSEntity) string {
+	if b.proxy {
+		return b.proxyURL(ts, false)
+	}
+	if b.variantB(ts) {
+		return buildTsUrl(b.ctx, ts.TSPathB)
+	}
+	return buildTsUrl(b.ctx, ts.TSPath)
+}
+
+// init fmp4 初始化切片地址
+func (b *segmentURLBuilder) init(ts entity.VideoTSEntity) string {
+	if !b.proxy {
+		return buildTsUrl(b.ctx, ts.InitPath)
+	}
+	return b.proxyURL(ts, true)
+}
+
+// proxyURL 切片代理地址，字节范围切片的地址对应整个文件，播放器按 Range 请求
+func (b *segmentURLBuilder) proxyURL(ts entity.VideoTSEntity, init bool) string {
+	segmentURL := fmt.Sprintf("%s/play/%s/seg/%d?definition=%s&app=%s&token=%s",
+		b.baseURL, b.videoID, ts.TSSequence, url.QueryEscape(ts.Definition), url.QueryEscape(b.appName), url.QueryEscape(b.keyToken))
+	if init {
+		segmentURL += "&part=init"
+	}
+	return segmentURL
+}
+
+// OpenSegment 打开代理的切片，init 为 true 时打开切片对应的 fmp4 初始化切片
+// 切片有 A/B 水印的 B 版本时，按播放密钥 token 所属用户的水印码选择版本
+// 独立文件的切片回源后写入磁盘缓存；字节范围切片（多个切片共用一个文件）不缓存，按请求的 Range 透传
+func (p *Play) OpenSegment(ctx *gin.Context, videoID, definition string, sequence int64, init bool, token string) (*PlaySegment, error) {
+	appName := string(app.GetAppName(ctx))
+	appConf := config.GetAppConf().GetSegmentProxyAppConf(appName)
+	if !appConf.Enabled {
+		return nil, ErrSegmentProxyDisabled
+	}
+
+	catalog, err := p.loadPlaylistCatalog(ctx, videoID, definition)
+	if err != nil {
+		return nil, err
+	}
+	tsList := catalog.TSList
+	i := sort.Search(len(tsList), func(i int) bool {
+		return tsList[i].TSSequence >= sequence
+	})
+	if i == len(tsList) || tsList[i].TSSequence != sequence {
+		return nil, ErrSegmentNotFound
+	}
+	ts := tsList[i]
+	segmentPath, byteRange := ts.TSPath, ts.IsByteRange()
+	if !init && ts.HasVariantB() {
+		if code, ok := NewWatermark(ctx).KeyTokenUserCode(ctx, token); ok && watermarkVariantB(code, ts.TSSequence) {
+			segmentPath = ts.TSPathB
+		}
+	}
+	if init {
+		if !ts.IsFMP4() || ts.InitPath == "" {
+			return nil, ErrSegmentNotFound
+		}
+		segmentPath, byteRange = ts.InitPath, ts.InitByteLength > 0
+	}
+	originURL, err := segmentOriginURL(ctx, appConf, segmentPath)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := getSegmentProxy()
+	contentType := segmentContentType(segmentPath)
+	if proxy.cache != nil && !byteRange {
+		segment, err := proxy.openCached(ctx, appConf, originURL, segmentCacheKey(appConf, segmentPath))
+		if err == nil {
+			segment.ContentType = contentType
+			return segment, nil
+		}
+		if !errors.Is(err, utils.ErrDiskCacheTooLarge) {
+			return nil, err
+		}
+		// 文件太大不缓存，透传
+	}
+	segment, err := proxy.fetch(ctx, appConf, originURL, ctx.Request.Header)
+	if err != nil {
+		return nil, err
+	}
+	segment.ContentType = contentType
+	return segment, nil
+}
+
+// openCached 从磁盘缓存打开切片，没有缓存时回源写入缓存，同一切片同时只回源一次
+func (sp *segmentProxy) openCached(ctx *gin.Context, appConf config.SegmentProxyAppConf, originURL, cacheKey string) (*PlaySegment, error) {
+	if file, ok := sp.cache.Open(cacheKey); ok {
+		return newCachedSegment(file)
+	}
+
+	sp.mu.Lock()
+	fill, filling := sp.fills[cacheKey]
+	if !filling {
+		fill = &segmentFill{done: make(chan struct{})}
+		sp.fills[cacheKey] = fill
+	}
+	sp.mu.Unlock()
+
+	if filling {
+		select {
+		case <-fill.done:
+		case <-ctx.Request.Context().Done():
+			return nil, ctx.Request.Context().Err()
+		}
+	} else {
+		fill.err = sp.fill(ctx, appConf, originURL, cacheKey)
+		sp.mu.Lock()
+		delete(sp.fills, cacheKey)
+		sp.mu.Unlock()
+		close(fill.done)
+	}
+	if fill.err != nil {
+		return nil, fill.err
+	}
+	file, ok := sp.cache.Open(cacheKey)
+	if !ok {
+		// 写入后马上被淘汰（缓存总大小小于切片大小），按不能缓存处理
+		return nil, utils.ErrDiskCacheTooLarge
+	}
+	return newCachedSegment(file)
+}
+
+// fill 回源整个切片文件写入磁盘缓存
+// 播放器断开不影响写入缓存（可能有其他请求在等待），回源只受超时限制
+func (sp *segmentProxy) fill(ctx *gin.Context, appConf config.SegmentProxyAppConf, originURL, cacheKey string) error {
+	fillCtx := context.WithoutCancel(ctx.Request.Context())
+	release, err := sp.acquire(fillCtx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	request, err := newSegmentOriginRequest(fillCtx, appConf, originURL)
+	if err != nil {
+		return err
+	}
+	response, err := sp.client.Do(request)
+	if err != nil {
+		logger.WithContext(ctx).Errorf("[segmentProxy.fill] 回源失败: %v, url: %s", err, originURL)
+		return ErrSegmentOriginFailed
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return ErrSegmentNotFound
+	}
+	if response.StatusCode != http.StatusOK {
+		logger.WithContext(ctx).Errorf("[segmentProxy.fill] 回源状态码: %d, url: %s", response.StatusCode, originURL)
+		return ErrSegmentOriginFailed
+	}
+	if response.ContentLength > sp.maxFileSize {
+		return utils.ErrDiskCacheTooLarge
+	}
+	if err = sp.cache.Store(cacheKey, response.Body, sp.maxFileSize); err != nil {
+		if !errors.Is(err, utils.ErrDiskCacheTooLarge) {
+			logger.WithContext(ctx).Errorf("[segmentProxy.fill] 写入切片缓存失败: %v, url: %s", err, originURL)
+			err = ErrSegmentOriginFailed
+		}
+		return err
+	}
+	return nil
+}
+
+// fetch 回源并透传，转发播放器的 Range 和 If-Range
+// 回源名额限制同时等待源站响应的请求数，收到响应头后归还；透传名额限制同时透传的响应数，在 PlaySegment.Close 时归还。
+// 内容随播放器读取，两次读取之间超过 idleTimeout 或播放器断开时取消回源
+func (sp *segmentProxy) fetch(ctx *gin.Context, appConf config.SegmentProxyAppConf, originURL string, clientHeader http.Header) (*PlaySegment, error) {
+	fetchCtx, cancel := context.WithCancel(ctx.Request.Context())
+	request, err := newSegmentOriginRequest(fetchCtx, appConf, originURL)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	for _, name := range []string{"Range", "If-Range"} {
+		if value := clientHeader.Get(name); value != "" {
+			request.Header.Set(name, value)
+		}
+	}
+	releaseStream, err := sp.acquireSlot(fetchCtx, sp.streams)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	release, err := sp.acquire(fetchCtx)
+	if err != nil {
+		releaseStream()
+		cancel()
+		return nil, err
+	}
+	response, err := sp.streamClient.Do(request)
+	release()
+	if err != nil {
+		releaseStream()
+		cancel()
+		logger.WithContext(ctx).Errorf("[segmentProxy.fetch] 回源失败: %v, url: %s", err, originURL)
+		return nil, ErrSegmentOriginFailed
+	}
+	switch response.StatusCode {
+	case http.StatusOK, http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable:
+		response.Body = newSegmentStreamBody(response.Body, sp.idleTimeout, cancel, releaseStream)
+		return &PlaySegment{Response: response}, nil
+	case http.StatusNotFound:
+		_ = response.Body.Close()
+		releaseStream()
+		cancel()
+		return nil, ErrSegmentNotFound
+	}
+	_ = response.Body.Close()
+	releaseStream()
+	cancel()
+	logger.WithContext(ctx).Errorf("[segmentProxy.fetch] 回源状态码: %d, url: %s", response.StatusCode, originURL)
+	return nil, ErrSegmentOriginFailed
+}
+
+// segmentStreamBody 透传的源站响应内容
+// 两次读取之间（播放器不读取，或源站不返回数据）超过 idleTimeout 时取消回源并归还透传名额，关闭时同样处理
+type segmentStreamBody struct {
+	io.ReadCloser
+	idleTimeout time.Duration
+	timer       *time.Timer
+	stop        func()
+}
+
+// newSegmentStreamBody 包装源站响应内容，cancel 取消回源请求，release 归还透传名额
+func newSegmentStreamBody(body io.ReadCloser, idleTimeout time.Duration, cancel, release func()) *segmentStreamBody {
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			cancel()
+			release()
+		})
+	}
+	return &segmentStreamBody{
+		ReadCloser:  body,
+		idleTimeout: idleTimeout,
+		timer:       time.AfterFunc(idleTimeout, stop),
+		stop:        stop,
+	}
+}
+
+func (b *segmentStreamBody) Read(p []byte) (int, error) {
+	b.timer.Reset(b.idleTimeout)
+	n, err := b.ReadCloser.Read(p)
+	b.timer.Reset(b.idleTimeout)
+	return n, err
+}
+
+func (b *segmentStreamBody) Close() error {
+	b.timer.Stop()
+	err := b.ReadCloser.Close()
+	b.stop()
+	return err
+}
+
+// newCachedSegment 缓存文件的切片
+func newCachedSegment(file *os.File) (*PlaySegment, error) {
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &PlaySegment{File: file, ModTime: info.ModTime()}, nil
+}
+
+// newSegmentOriginRequest 创建回源请求，带上 app 配置的回源请求头
+func newSegmentOriginRequest(ctx context.Context, appConf config.SegmentProxyAppConf, originURL string) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, originURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range appConf.Headers {
+		request.Header.Set(name, value)
+	}
+	return request, nil
+}
+
+// segmentOriginURL 切片的回源地址：绝对地址直接使用，相对路径拼接 app 配置的源站，没有配置源站时使用 CDN
+func segmentOriginURL(ctx context.Context, appConf config.SegmentProxyAppConf, segmentPath string) (string, error) {
+	if strings.HasPrefix(segmentPath, "http://") || strings.HasPrefix(segmentPath, "https://") || appConf.Origin == "" {
+		return segmentFetchURL(ctx, segmentPath)
+	}
+	return strings.TrimSuffix(appConf.Origin, "/") + "/" + strings.TrimPrefix(segmentPath, "/"), nil
+}
+
+// segmentCacheKey 切片的磁盘缓存 key，源站中的切片文件内容不变，按源站和路径缓存
+func segmentCacheKey(appConf config.SegmentProxyAppConf, segmentPath string) string {
+	sum := sha256.Sum256([]byte(appConf.Origin + "\n" + segmentPath))
+	return hex.EncodeToString(sum[:])
+}
+
+// segmentContentType 按切片文件扩展名返回 Content-Type
+func segmentContentType(segmentPath string) string {
+	if u, err := url.Parse(segmentPath); err == nil {
+		segmentPath = u.Path
+	}
+	switch strings.ToLower(path.Ext(segmentPath)) {
+	case ".ts":
+		return "video/mp2t"
+	case ".aac":
+		return "audio/aac"
+	case ".m4a":
+		return "audio/mp4"
+	case ".mp4", ".m4s", ".m4v", ".cmfv", ".cmfa":
+		return "video/mp4"
+	}
+	return "application/octet-stream"
+}
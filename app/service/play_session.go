@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aldge/cine_stream/app/dao"
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/config"
+	"github.com/aldge/cine_stream/logger"
+	"github.com/aldge/gopkg/app"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrPlaySessionLimit 用户同时播放的设备数已达上限
+var ErrPlaySessionLimit = errors.New("同时播放的设备数已达上限，请先停止其它设备的播放")
+
+const (
+	// playSessionKeyPrefix 播放会话 Redis key 前缀，完整 key 为 前缀+app:user_id
+	playSessionKeyPrefix = "cine_stream:play_session:"
+	// PlayDeviceHeader 播放器上报设备 ID 的请求头
+	PlayDeviceHeader = "X-Device-ID"
+	// playDeviceIDMaxLength 设备 ID 的最大长度，超过时截断
+	playDeviceIDMaxLength = 64
+)
+
+// playSessionStore 播放会话存储，每个用户一组 (设备 -> 过期时间)
+type playSessionStore interface {
+	// touch 登记或续期设备的会话；设备没有会话且用户的会话数已达 limit 时不登记，返回 false
+	touch(ctx context.Context, key, deviceID string, limit int, ttl time.Duration) (bool, error)
+	// release 删除设备的会话
+	release(ctx context.Context, key, deviceID string) error
+}
+
+var (
+	playSessionMemoryOnce sync.Once
+	playSessionMemory     *memoryPlaySessionStore
+)
+
+// getPlaySessionStore 获取播放会话存储：开启 Redis 时多实例共享，否则保存在本机内存
+func getPlaySessionStore() playSessionStore {
+	if config.GetAppConf().GetPlaySessionConf().UseRedis {
+		if client := dao.GetRedis(); client != nil {
+			return &redisPlaySessionStore{client: client}
+		}
+	}
+	playSessionMemoryOnce.Do(func() {
+		playSessionMemory = &memoryPlaySessionStore{sessions: make(map[string]map[string]time.Time)}
+	})
+	return playSessionMemory
+}
+
+// PlayDeviceID 当前请求的设备 ID
+// 优先使用 X-Device-ID 请求头，其次是 device_id 参数（播放器无法给 m3u8 和密钥请求设置请求头时使用），
+// 都没有时使用 User-Agent 和客户端 IP 的 hash，同一浏览器的请求是同一设备
+func PlayDeviceID(ctx *gin.Context) string {
+	if deviceID := normalizePlayDeviceID(ctx.GetHeader(PlayDeviceHeader)); deviceID != "" {
+		return deviceID
+	}
+	if deviceID := normalizePlayDeviceID(ctx.Query("device_id")); deviceID != "" {
+		return deviceID
+	}
+	sum := sha256.Sum256([]byte(ctx.Request.UserAgent() + "\n" + ctx.ClientIP()))
+	return "ua:" + hex.EncodeToString(sum[:8])
+}
+
+// normalizePlayDeviceID 去掉首尾空白，超过最大长度时截断
+func normalizePlayDeviceID(deviceID string) string {
+	deviceID = strings.TrimSpace(deviceID)
+	if len(deviceID) > playDeviceIDMaxLength {
+		deviceID = deviceID[:playDeviceIDMaxLength]
+	}
+	return deviceID
+}
+
+// playDeviceQuery 播放列表中的 m3u8 和密钥地址追加的设备 ID 参数
+// 设备 ID 来自 device_id 参数时才需要传递，请求头和 User-Agent 的 hash 在后续请求中仍然一样
+func playDeviceQuery(ctx *gin.Context) string {
+	if normalizePlayDeviceID(ctx.GetHeader(PlayDeviceHeader)) != "" {
+		return ""
+	}
+	deviceID := normalizePlayDeviceID(ctx.Query("device_id"))
+	if deviceID == "" {
+		return ""
+	}
+	return "&device_id=" + url.QueryEscape(deviceID)
+}
+
+// TouchPlaySession 为用户的当前设备登记或续期播放会话
+// 用户同时播放的设备数已达 app 和套餐的上限、且当前设备没有会话时返回 ErrPlaySessionLimit；
+// 没有登录或不限制设备数时不登记；存储出错时不限制播放，只记录日志
+func TouchPlaySession(ctx *gin.Context, userID string) error {
+	return touchPlaySession(ctx, userID, entity.ContextValueLoginPlan(ctx))
+}
+
+// TouchKeyTokenPlaySession 为播放密钥 token 中的用户登记或续期当前设备的播放会话，上限按 token 签发时的套餐
+// 用于没有登录信息的密钥请求（hls.js 跨域请求密钥时不带登录信息），调用方需要先校验 token
+func TouchKeyTokenPlaySession(ctx *gin.Context, token string) error {
+	payloadPart, _, _ := strings.Cut(token, ".")
+	userID, _, plan, _ := parsePlayKeyTokenPayload(payloadPart)
+	return touchPlaySession(ctx, userID, plan)
+}
+
+// touchPlaySession 按套餐的上限为用户的当前设备登记或续期播放会话
+func touchPlaySession(ctx *gin.Context, userID, plan string) error {
+	if userID == "" {
+		return nil
+	}
+	appName := string(app.GetAppName(ctx))
+	limit := config.GetAppConf().GetPlaySessionLimit(appName, plan)
+	if limit <= 0 {
+		return nil
+	}
+	ttl := time.Duration(config.GetAppConf().GetPlaySessionConf().TTLSeconds) * time.Second
+	deviceID := PlayDeviceID(ctx)
+	ok, err := getPlaySessionStore().touch(ctx, appName+":"+userID, deviceID, limit, ttl)
+	if err != nil {
+		logger.WithContext(ctx).Warnf("[touchPlaySession] 登记播放会话失败: %v, user_id: %s", err, userID)
+		return nil
+	}
+	if !ok {
+		logger.WithContext(ctx).Infof("[touchPlaySession] 同时播放的设备数已达上限, user_id: %s, device_id: %s, limit: %d", userID, deviceID, limit)
+		return ErrPlaySessionLimit
+	}
+	return nil
+}
+
+// ReleasePlaySession 播放结束时释放用户当前设备的播放会话，其它设备不需要等会话过期
+func ReleasePlaySession(ctx *gin.Context, userID string) {
+	if userID == "" {
+		return
+	}
+	appName := string(app.GetAppName(ctx))
+	if err := getPlaySessionStore().release(ctx, appName+":"+userID, PlayDeviceID(ctx)); err != nil {
+		logger.WithContext(ctx).Warnf("[ReleasePlaySession] 释放播放会话失败: %v, user_id: %s", err, userID)
+	}
+}
+
+// memoryPlaySessionStore 本机内存中的播放会话，只适用于单实例部署
+type memoryPlaySessionStore struct {
+	mu        sync.Mutex
+	sessions  map[string]map[string]time.Time // key -> 设备 ID -> 过期时间
+	lastSweep time.Time
+}
+
+func (s *memoryPlaySessionStore) touch(_ context.Context, key, deviceID string, limit int, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 每个 TTL 清理一次所有用户的过期会话，避免不再播放的用户一直占用内存
+	if now.Sub(s.lastSweep) > ttl {
+		for sessionKey, devices := range s.sessions {
+			purgePlaySessions(devices, now)
+			if len(devices) == 0 {
+				delete(s.sessions, sessionKey)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	devices, ok := s.sessions[key]
+	if !ok {
+		devices = make(map[string]time.Time)
+		s.sessions[key] = devices
+	}
+	purgePlaySessions(devices, now)
+	if _, ok = devices[deviceID]; !ok && len(devices) >= limit {
+		return false, nil
+	}
+	devices[deviceID] = now.Add(ttl)
+	return true, nil
+}
+
+func (s *memoryPlaySessionStore) release(_ context.Context, key, deviceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if devices, ok := s.sessions[key]; ok {
+		delete(devices, deviceID)
+		if len(devices) == 0 {
+			delete(s.sessions, key)
+		}
+	}
+	return nil
+}
+
+// purgePlaySessions 删除过期的会话，调用方需持有锁
+func purgePlaySessions(devices map[string]time.Time, now time.Time) {
+	for deviceID, expire := range devices {
+		if !expire.After(now) {
+			delete(devices, deviceID)
+		}
+	}
+}
+
+// redisPlaySessionStore Redis 中的播放会话，多实例共享
+// 每个用户一个 ZSET，member 为设备 ID，score 为过期时间（毫秒）
+type redisPlaySessionStore struct {
+	client *redis.Client
+}
+
+// playSessionTouchScript 清理过期会话后登记或续期，检查和写入在一个脚本中完成，多实例同时登记不会超过上限
+// KEYS[1] 会话 key；ARGV: 当前时间（毫秒）、过期时间（毫秒）、上限、设备 ID、key 的过期时长（毫秒）
+var playSessionTouchScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+if not redis.call('ZSCORE', KEYS[1], ARGV[4]) and redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[3]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[4])
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+return 1
+`)
+
+func (s *redisPlaySessionStore) touch(ctx context.Context, key, deviceID string, limit int, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	result, err := playSessionTouchScript.Run(ctx, s.client, []string{playSessionKeyPrefix + key},
+		now.UnixMilli(), now.Add(ttl).UnixMilli(), limit, deviceID, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return result == 1, nil
+}
+
+func (s *redisPlaySessionStore) release(ctx context.Context, key, deviceID string) error {
+	return s.client.ZRem(ctx, playSessionKeyPrefix+key, deviceID).Err()
+}
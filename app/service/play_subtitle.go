@@ -0,0 +1,108 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+
+	"github.com/aldge/cine_stream/app/dao"
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/gopkg/app"
+	"github.com/gin-gonic/gin"
+)
+
+// playSubtitleGroupID 主 m3u8 中字幕的 GROUP-ID
+const playSubtitleGroupID = "subs"
+
+// buildSubtitleMediaTags 生成主 m3u8 的字幕 EXT-X-MEDIA，没有字幕时返回空字符串
+func buildSubtitleMediaTags(videoID, appName string, subtitleList []entity.VideoSubtitleEntity) string {
+	var builder strings.Builder
+	for _, subtitle := range subtitleList {
+		attrs := []string{
+			"TYPE=SUBTITLES",
+			fmt.Sprintf(`GROUP-ID="%s"`, playSubtitleGroupID),
+			fmt.Sprintf(`NAME="%s"`, quotedStringEscape(subtitle.Name)),
+			fmt.Sprintf(`LANGUAGE="%s"`, quotedStringEscape(subtitle.Language)),
+			"DEFAULT=" + yesNo(subtitle.IsDefault),
+			// DEFAULT=YES 时 AUTOSELECT 必须为 YES
+			"AUTOSELECT=YES",
+			"FORCED=" + yesNo(subtitle.IsForced),
+			fmt.Sprintf(`URI="%s"`, buildSubtitlePlaylistURL(videoID, subtitle.VideoSubtitleID, appName)),
+		}
+		builder.WriteString("#EXT-X-MEDIA:" + strings.Join(attrs, ",") + "\n")
+	}
+	return builder.String()
+}
+
+// buildSubtitlePlaylistURL 生成字幕轨道的媒体 m3u8 地址
+func buildSubtitlePlaylistURL(videoID string, subtitleID uint64, appName string) string {
+	return fmt.Sprintf("/play/%s/subtitle/%d/index.m3u8?app=%s", videoID, subtitleID, url.QueryEscape(appName))
+}
+
+// GenerateSubtitleM3U8Content 生成字幕轨道的媒体 m3u8 内容（WebVTT 切片，不加密）
+func (p *Play) GenerateSubtitleM3U8Content(ctx *gin.Context, videoID string, subtitleID uint64) (string, error) {
+	subtitle, err := p.daoVideoSubtitle.GetByID(videoID, subtitleID)
+	if errors.Is(err, dao.ErrRecordNotFound) {
+		return "", ErrSubtitleNotFound
+	}
+	if err != nil {
+		return "", errors.New("查询字幕失败")
+	}
+	segmentList, err := p.daoVideoSubtitle.GetSegments(subtitle.VideoSubtitleID)
+	if err != nil {
+		return "", errors.New("查询字幕切片失败")
+	}
+	if len(segmentList) == 0 {
+		return "", ErrSubtitleNotFound
+	}
+
+	maxDuration := 0.0
+	for _, segment := range segmentList {
+		if segment.Duration > maxDuration {
+			maxDuration = segment.Duration
+		}
+	}
+	targetDuration := int(math.Ceil(maxDuration))
+	if targetDuration < 1 {
+		targetDuration = 1
+	}
+
+	var builder strings.Builder
+	builder.WriteString("#EXTM3U\n")
+	builder.WriteString("#EXT-X-VERSION:3\n")
+	builder.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	builder.WriteString(fmt.Sprintf("#EXT-X-MEDIA-SEQUENCE:%d\n", segmentList[0].Sequence))
+	builder.WriteString(fmt.Sprintf("#EXT-X-TARGETDURATION:%d\n", targetDuration))
+	// 上传转换生成的切片没有路径，由服务输出，地址带上密钥 token 在本地校验权限
+	appName := string(app.GetAppName(ctx))
+	keyToken := ""
+	for _, segment := range segmentList {
+		builder.WriteString("#EXTINF:" + formatDuration(segment.Duration) + ",\n")
+		if segment.Path != "" {
+			builder.WriteString(buildTsUrl(ctx, segment.Path) + "\n")
+			continue
+		}
+		if keyToken == "" {
+			keyToken = SignPlayKeyToken(ctx, videoID)
+		}
+		builder.WriteString(fmt.Sprintf("/play/%s/subtitle/%d/%d.vtt?app=%s&token=%s\n",
+			videoID, subtitle.VideoSubtitleID, segment.Sequence, url.QueryEscape(appName), url.QueryEscape(keyToken)))
+	}
+	builder.WriteString("#EXT-X-ENDLIST\n")
+	return builder.String(), nil
+}
+
+// quotedStringEscape m3u8 的 quoted-string 不能包含双引号和换行
+func quotedStringEscape(value string) string {
+	return strings.NewReplacer(`"`, "'", "\n", " ", "\r", " ").Replace(value)
+}
+
+// yesNo 布尔值转换为 m3u8 的 YES/NO
+func yesNo(value bool) string {
+	if value {
+		return "YES"
+	}
+	return "NO"
+}
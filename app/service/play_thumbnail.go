@@ -0,0 +1,65 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/aldge/cine_stream/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// ErrThumbnailNotFound 视频没有缩略图
+var ErrThumbnailNotFound = errors.New("视频没有缩略图")
+
+// GenerateThumbnailVTT 生成视频的 WebVTT 缩略图轨道，每个 cue 指向雪碧图中的一个缩略图（#xywh=x,y,w,h）
+// 雪碧图地址和切片一样按 CDN 调度拼接域名并签名；最后一个缩略图的结束时间不超过视频时长
+func (p *Play) GenerateThumbnailVTT(ctx *gin.Context, videoID string) (string, error) {
+	thumbnailList, err := p.daoVideoThumbnail.GetListByVideoID(videoID)
+	if err != nil {
+		return "", errors.New("查询视频缩略图失败")
+	}
+	if len(thumbnailList) == 0 {
+		return "", ErrThumbnailNotFound
+	}
+	video, err := p.loadVideoCatalog(videoID)
+	if err != nil {
+		return "", err
+	}
+	videoDuration := 0.0
+	for _, stat := range video.DefinitionStats {
+		videoDuration = math.Max(videoDuration, stat.TotalDuration)
+	}
+
+	var builder strings.Builder
+	builder.WriteString("WEBVTT\n")
+	index := 0
+	for _, thumbnail := range thumbnailList {
+		spriteURL := buildTsUrl(ctx, thumbnail.Path)
+		for i := 0; i < thumbnail.TileCount; i++ {
+			start := float64(index) * thumbnail.Interval
+			end := start + thumbnail.Interval
+			index++
+			if videoDuration > 0 {
+				if start >= videoDuration {
+					return builder.String(), nil
+				}
+				end = math.Min(end, videoDuration)
+			}
+			x := i % thumbnail.Columns * thumbnail.TileWidth
+			y := i / thumbnail.Columns * thumbnail.TileHeight
+			builder.WriteString("\n")
+			builder.WriteString(utils.FormatWebVTTTimestamp(secondsToDuration(start)) + " --> " +
+				utils.FormatWebVTTTimestamp(secondsToDuration(end)) + "\n")
+			builder.WriteString(fmt.Sprintf("%s#xywh=%d,%d,%d,%d\n", spriteURL, x, y, thumbnail.TileWidth, thumbnail.TileHeight))
+		}
+	}
+	return builder.String(), nil
+}
+
+// secondsToDuration 秒转为 time.Duration，按毫秒四舍五入
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Round(seconds*1000)) * time.Millisecond
+}
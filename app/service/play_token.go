@@ -0,0 +1,231 @@
+package service
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/config"
+	"github.com/aldge/cine_stream/utils"
+	"github.com/aldge/gopkg/app"
+	"github.com/gin-gonic/gin"
+)
+
+// 播放密钥 token 校验错误
+var (
+	ErrPlayTokenInvalid = errors.New("播放密钥 token 无效")
+	ErrPlayTokenExpired = errors.New("播放密钥 token 已过期")
+)
+
+// playTrialTokenScope 试看密钥 token 的范围前缀
+const playTrialTokenScope = "trial:"
+
+// SignPlayKeyToken 生成绑定用户和视频的播放密钥 token
+// 格式：base64url(user_id:expire[@plan]).base64url(hmac_sha256(user_id:video_id:app:expire[:plan=plan]))，
+// plan 为用户的套餐（url 编码），没有登录信息的密钥请求按 token 中的套餐限制同时播放的设备数
+func SignPlayKeyToken(ctx *gin.Context, videoID string) string {
+	return signPlayKeyToken(ctx, videoID, "")
+}
+
+// PlayTrialKeyScope 试看密钥 token 的范围
+type PlayTrialKeyScope struct {
+	KeyIDs      []uint64 // 可以获取的密钥 ID
+	Definition  string   // 试看的清晰度
+	EndSequence int64    // 最后一个试看切片的序号，-1 表示没有试看切片
+}
+
+// CoversSegment 切片（及其初始化切片）是否在试看范围内
+func (s *PlayTrialKeyScope) CoversSegment(definition string, sequence int64) bool {
+	return definition == s.Definition && sequence <= s.EndSequence
+}
+
+// SignPlayTrialKeyToken 生成试看密钥 token，只能获取 scope 中的密钥和试看范围内的切片
+// 格式：在播放密钥 token 后追加 .base64url(trial:key_id,key_id...;definition;end_sequence)，签名包含该范围
+func SignPlayTrialKeyToken(ctx *gin.Context, videoID string, scope *PlayTrialKeyScope) string {
+	ids := make([]string, 0, len(scope.KeyIDs))
+	for _, keyID := range scope.KeyIDs {
+		ids = append(ids, strconv.FormatUint(keyID, 10))
+	}
+	scopeText := fmt.Sprintf("%s%s;%s;%d", playTrialTokenScope, strings.Join(ids, ","), url.QueryEscape(scope.Definition), scope.EndSequence)
+	return signPlayKeyToken(ctx, videoID, scopeText) + "." + base64.RawURLEncoding.EncodeToString([]byte(scopeText))
+}
+
+// signPlayKeyToken 生成播放密钥 token，scope 为空表示不限制密钥
+func signPlayKeyToken(ctx *gin.Context, videoID string, scope string) string {
+	userID, plan := entity.ContextValueLoginUserID(ctx), entity.ContextValueLoginPlan(ctx)
+	keyTokenConf := config.GetAppConf().GetAuthConf().KeyToken
+	expire := time.Now().Add(time.Duration(keyTokenConf.ExpireSeconds) * time.Second).Unix()
+	payload := fmt.Sprintf("%s:%d", userID, expire)
+	if plan != "" {
+		payload += "@" + url.QueryEscape(plan)
+	}
+	sign := signPlayKeyPayload(keyTokenConf.Secret, userID, videoID, string(app.GetAppName(ctx)), expire, plan, scope)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + base64.RawURLEncoding.EncodeToString(sign)
+}
+
+// VerifyPlayKeyToken 校验播放密钥 token
+// 签名不对或与当前登录用户不一致返回 ErrPlayTokenInvalid，过期返回 ErrPlayTokenExpired
+func VerifyPlayKeyToken(ctx *gin.Context, videoID string, token string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return ErrPlayTokenInvalid
+	}
+	return verifyPlayKeyToken(ctx, videoID, parts[0], parts[1], "")
+}
+
+// IsPlayTrialKeyToken 是否为试看密钥 token
+func IsPlayTrialKeyToken(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// VerifyPlayTrialKeyToken 校验试看密钥 token，返回 token 的试看范围
+// 试看 token 过期后不回退到播放权限检查，需要重新获取试看 m3u8
+func VerifyPlayTrialKeyToken(ctx *gin.Context, videoID string, token string) (*PlayTrialKeyScope, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrPlayTokenInvalid
+	}
+	scope, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !strings.HasPrefix(string(scope), playTrialTokenScope) {
+		return nil, ErrPlayTokenInvalid
+	}
+	if err = verifyPlayKeyToken(ctx, videoID, parts[0], parts[1], string(scope)); err != nil {
+		return nil, err
+	}
+	fields := strings.Split(strings.TrimPrefix(string(scope), playTrialTokenScope), ";")
+	if len(fields) != 3 {
+		return nil, ErrPlayTokenInvalid
+	}
+	trialScope := &PlayTrialKeyScope{}
+	for _, id := range strings.Split(fields[0], ",") {
+		if id == "" {
+			continue
+		}
+		keyID, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return nil, ErrPlayTokenInvalid
+		}
+		trialScope.KeyIDs = append(trialScope.KeyIDs, keyID)
+	}
+	if trialScope.Definition, err = url.QueryUnescape(fields[1]); err != nil {
+		return nil, ErrPlayTokenInvalid
+	}
+	if trialScope.EndSequence, err = strconv.ParseInt(fields[2], 10, 64); err != nil {
+		return nil, ErrPlayTokenInvalid
+	}
+	return trialScope, nil
+}
+
+// verifyPlayKeyToken 校验 token 的 payload 和签名
+func verifyPlayKeyToken(ctx *gin.Context, videoID, payloadPart, signPart, scope string) error {
+	userID, expire, plan, ok := parsePlayKeyTokenPayload(payloadPart)
+	if !ok {
+		return ErrPlayTokenInvalid
+	}
+	sign, err := base64.RawURLEncoding.DecodeString(signPart)
+	if err != nil {
+		return ErrPlayTokenInvalid
+	}
+
+	keyTokenConf := config.GetAppConf().GetAuthConf().KeyToken
+	expectSign := signPlayKeyPayload(keyTokenConf.Secret, userID, videoID, string(app.GetAppName(ctx)), expire, plan, scope)
+	if !hmac.Equal(sign, expectSign) {
+		return ErrPlayTokenInvalid
+	}
+	// 请求带了登录信息时，必须是签发 token 的用户
+	if loginUserID := entity.ContextValueLoginUserID(ctx); loginUserID != "" && loginUserID != userID {
+		return ErrPlayTokenInvalid
+	}
+	if time.Now().Unix() > expire {
+		return ErrPlayTokenExpired
+	}
+	return nil
+}
+
+// signPlayKeyPayload 计算播放密钥 token 的签名，plan、scope 不为空时一起签名
+func signPlayKeyPayload(secret, userID, videoID, appName string, expire int64, plan, scope string) []byte {
+	data := fmt.Sprintf("%s:%s:%s:%d", userID, videoID, appName, expire)
+	if plan != "" {
+		data += ":plan=" + url.QueryEscape(plan)
+	}
+	if scope != "" {
+		data += ":" + scope
+	}
+	return utils.Encrypt.HmacSHA256([]byte(data), []byte(secret))
+}
+
+// parsePlayKeyTokenPayload 解析 token 的 payload：user_id:expire[@plan]，返回用户 ID、过期时间和套餐
+func parsePlayKeyTokenPayload(payloadPart string) (string, int64, string, bool) {
+	payload, err := base64.RawURLEncoding.DecodeString(payloadPart)
+	if err != nil {
+		return "", 0, "", false
+	}
+	sep := strings.LastIndex(string(payload), ":")
+	if sep < 0 {
+		return "", 0, "", false
+	}
+	expirePart, planPart, _ := strings.Cut(string(payload[sep+1:]), "@")
+	expire, err := strconv.ParseInt(expirePart, 10, 64)
+	if err != nil {
+		return "", 0, "", false
+	}
+	plan, err := url.QueryUnescape(planPart)
+	if err != nil {
+		return "", 0, "", false
+	}
+	return string(payload[:sep]), expire, plan, true
+}
+
+// PlayKeyTokenUserID 播放密钥 token 签发时的用户 ID，token 格式不对时为空
+// 不校验签名，调用方需要先校验 token
+func PlayKeyTokenUserID(token string) string {
+	payloadPart, _, _ := strings.Cut(token, ".")
+	userID, _, _, _ := parsePlayKeyTokenPayload(payloadPart)
+	return userID
+}
+
+// RefreshPlayKeyToken 播放心跳时刷新播放密钥 token，返回新 token，不需要刷新或不能刷新时返回空字符串
+// 点播的 m3u8 只请求一次，播放器用心跳换取的新 token 替换密钥地址中的 token，token 的有效期可以很短；
+// 原 token 必须是当前登录用户的（可以已过期），剩余有效期不到一半时重新检查播放权限后签发，
+// 每个播放器每半个有效期请求一次 passport
+func RefreshPlayKeyToken(ctx *gin.Context, videoID string, token string) string {
+	if token == "" || IsPlayTrialKeyToken(token) {
+		return ""
+	}
+	err := VerifyPlayKeyToken(ctx, videoID, token)
+	if err != nil && !errors.Is(err, ErrPlayTokenExpired) {
+		return ""
+	}
+	payloadPart, _, _ := strings.Cut(token, ".")
+	userID, expire, _, _ := parsePlayKeyTokenPayload(payloadPart)
+	if userID == "" || userID != entity.ContextValueLoginUserID(ctx) {
+		return ""
+	}
+	ttl := int64(config.GetAppConf().GetAuthConf().KeyToken.ExpireSeconds)
+	if expire-time.Now().Unix() > ttl/2 {
+		return ""
+	}
+	if !CheckPlayRights(ctx, videoID) {
+		return ""
+	}
+	return SignPlayKeyToken(ctx, videoID)
+}
+
+// CheckPlayKeyRights 检查密钥请求的播放权限
+// 带了有效 token 时本地校验，不请求 passport；token 缺失或过期时回退到 CheckPlayRights
+func CheckPlayKeyRights(ctx *gin.Context, videoID string, token string) bool {
+	if token == "" {
+		return CheckPlayRights(ctx, videoID)
+	}
+	err := VerifyPlayKeyToken(ctx, videoID, token)
+	if errors.Is(err, ErrPlayTokenExpired) {
+		return CheckPlayRights(ctx, videoID)
+	}
+	return err == nil
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aldge/cine_stream/app/dao"
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/config"
+	"github.com/aldge/cine_stream/logger"
+	"github.com/aldge/gopkg/app"
+	"github.com/gin-gonic/gin"
+)
+
+// ErrTrialUnavailable 视频不能试看
+var ErrTrialUnavailable = errors.New("视频不能试看")
+
+// playTrialDataID 主 m3u8 中试看标记的 EXT-X-SESSION-DATA DATA-ID
+const playTrialDataID = "com.cine.trial"
+
+// PlayTrial 没有播放权限时的试看范围
+type PlayTrial struct {
+	VodID    int64   `json:"vod_id,omitempty"` // 请求带的 vod_id，主 m3u8 中的媒体 m3u8 地址继续带上
+	Episode  bool    `json:"episode"`          // 剧集在 vod_trysee 的试看集数内，整集试看
+	Duration float64 `json:"duration"`         // 试看时长(秒)，整集试看时为 0
+}
+
+// ResolvePlayTrial 确定没有播放权限的用户的试看范围
+// vodID 对应的剧集在 vod_trysee 集数内时整集试看，否则按 app 配置的分钟数试看；都不满足时返回 ErrTrialUnavailable
+func ResolvePlayTrial(ctx *gin.Context, videoID string, vodID int64) (*PlayTrial, error) {
+	trialConf := config.GetAppConf().GetTrialConf(string(app.GetAppName(ctx)))
+	if !trialConf.Enabled {
+		return nil, ErrTrialUnavailable
+	}
+	trial := &PlayTrial{VodID: vodID}
+	if vodID > 0 {
+		vod, err := dao.NewVod(ctx).GetByID(vodID)
+		if err != nil {
+			logger.WithContext(ctx).Warnf("[ResolvePlayTrial] 查询vod失败: %v, vod_id: %d", err, vodID)
+		} else if vod.VodTrysee > 0 && vod.VodPlayURL != nil {
+			episode := vodEpisodeIndex(*vod.VodPlayURL, videoID)
+			if episode >= 0 && int64(episode) < vod.VodTrysee {
+				trial.Episode = true
+				return trial, nil
+			}
+		}
+	}
+	if trialConf.Minutes <= 0 {
+		return nil, ErrTrialUnavailable
+	}
+	trial.Duration = float64(trialConf.Minutes * 60)
+	return trial, nil
+}
+
+// vodEpisodeIndex 视频在 vod_play_url 中的剧集下标（从 0 开始），没有时返回 -1
+// vod_play_url 格式：播放组之间用 $$$ 分隔，剧集之间用 # 分隔，每集为 名称$地址
+func vodEpisodeIndex(playURL, videoID string) int {
+	for _, group := range strings.Split(playURL, "$$$") {
+		for i, episode := range strings.Split(group, "#") {
+			episodeURL := episode
+			if sep := strings.LastIndex(episode, "$"); sep >= 0 {
+				episodeURL = episode[sep+1:]
+			}
+			if strings.Contains(episodeURL, videoID) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// playlistQuery 试看主 m3u8 中媒体 m3u8 地址追加的参数
+func (t *PlayTrial) playlistQuery() string {
+	if t == nil || t.VodID <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("&vod_id=%d", t.VodID)
+}
+
+// sessionDataTags 主 m3u8 中的试看标记，播放器据此提示购买
+func (t *PlayTrial) sessionDataTags() string {
+	if t == nil {
+		return ""
+	}
+	tags := fmt.Sprintf(`#EXT-X-SESSION-DATA:DATA-ID="%s",VALUE="1"`+"\n", playTrialDataID)
+	if t.Duration > 0 {
+		tags += fmt.Sprintf(`#EXT-X-SESSION-DATA:DATA-ID="%s.duration",VALUE="%d"`+"\n", playTrialDataID, int64(t.Duration))
+	}
+	return tags
+}
+
+// truncate 截取试看范围内的切片，开始时间在试看时长内的切片都保留
+func (t *PlayTrial) truncate(tsList []entity.VideoTSEntity) []entity.VideoTSEntity {
+	if t.Episode {
+		return tsList
+	}
+	start := 0.0
+	for i, ts := range tsList {
+		if start >= t.Duration {
+			return tsList[:i]
+		}
+		start += ts.Duration
+	}
+	return tsList
+}
+
+// GenerateTrialMasterM3U8Content 生成试看的主 m3u8，不输出字幕和 I-frame 列表，带上试看标记
+func (p *Play) GenerateTrialMasterM3U8Content(ctx *gin.Context, videoID string, trial *PlayTrial) (string, error) {
+	return p.generateMasterM3U8Content(ctx, videoID, trial)
+}
+
+// GenerateTrialMediaM3U8Content 生成试看的媒体 m3u8，只包含试看范围内的切片并输出 EXT-X-ENDLIST
+// 密钥和代理切片地址使用试看 token，只能获取试看切片和试看切片的密钥；试看切片和之后的切片共用密钥时不能试看
+func (p *Play) GenerateTrialMediaM3U8Content(ctx *gin.Context, videoID, definition string, trial *PlayTrial) (string, error) {
+	video, err := p.loadVideoCatalog(videoID)
+	if err != nil {
+		return "", err
+	}
+	renditions, err := newPlayRenditions(video)
+	if err != nil {
+		return "", err
+	}
+	definition, err = renditions.resolveDefinition(definition)
+	if err != nil {
+		return "", err
+	}
+	// 直播不提供试看
+	if video.Live != nil {
+		return "", fmt.Errorf("%w: 直播不提供试看", ErrTrialUnavailable)
+	}
+
+	catalog, err := p.loadPlaylistCatalog(ctx, videoID, definition)
+	if err != nil {
+		return "", err
+	}
+	trialList := trial.truncate(catalog.TSList)
+	keyIDs, err := trialKeyIDs(catalog.EncryptList, catalog.TSList, len(trialList))
+	if err != nil {
+		return "", err
+	}
+
+	scope := &PlayTrialKeyScope{KeyIDs: keyIDs, Definition: definition, EndSequence: -1}
+	if len(trialList) > 0 {
+		scope.EndSequence = trialList[len(trialList)-1].TSSequence
+	}
+	opts := vodPlaylistOptions
+	opts.keyToken = SignPlayTrialKeyToken(ctx, videoID, scope)
+	opts.adBreaks = p.loadAdBreaks(ctx, videoID, video.AudioList, trialList)
+	return p.generateM3U8Content(ctx, videoID, trialList, catalog.EncryptList, opts)
+}
+
+// trialKeyIDs 前 trialCount 个切片使用的密钥 ID，这些密钥不能用于之后的切片
+func trialKeyIDs(encryptList []entity.VideoEncryptEntity, tsList []entity.VideoTSEntity, trialCount int) ([]uint64, error) {
+	used := make(map[uint64]bool)
+	var keyIDs []uint64
+	for i, ts := range tsList {
+		encryptInfo := findSegmentEncrypt(encryptList, ts.Definition, ts.TSSequence)
+		if encryptInfo == nil {
+			continue
+		}
+		if i >= trialCount {
+			if used[encryptInfo.VideoEncryptID] {
+				return nil, fmt.Errorf("%w: 试看切片和之后的切片共用密钥, key_id: %d", ErrTrialUnavailable, encryptInfo.VideoEncryptID)
+			}
+			continue
+		}
+		if !used[encryptInfo.VideoEncryptID] {
+			used[encryptInfo.VideoEncryptID] = true
+			keyIDs = append(keyIDs, encryptInfo.VideoEncryptID)
+		}
+	}
+	return keyIDs, nil
+}
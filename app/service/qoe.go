@@ -0,0 +1,234 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aldge/cine_stream/app/dao"
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/app/worker"
+	"github.com/aldge/cine_stream/config"
+	"github.com/aldge/cine_stream/logger"
+	"github.com/aldge/cine_stream/utils"
+	"github.com/aldge/gopkg/app"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// ErrQoEDisabled 没有开启播放质量上报
+	ErrQoEDisabled = errors.New("没有开启播放质量上报")
+	// ErrQoEBusy 播放质量事件队列已满
+	ErrQoEBusy = errors.New("播放质量上报繁忙，请稍后重试")
+	// ErrQoEVideoNotFound 上报的视频没有切片
+	ErrQoEVideoNotFound = errors.New("视频不存在")
+)
+
+// 播放质量上报的校验范围，超出范围的事件丢弃
+const (
+	qoeBeaconMaxEvents  = 100            // 每次上报最多的事件数
+	qoeVideoIDMaxLength = 32             // 视频 ID 最大长度
+	qoeMaxStartupMs     = 600 * 1000     // 起播耗时上限（毫秒）
+	qoeMaxDurationMs    = 3600 * 1000    // 单次卡顿或播放时长上限（毫秒）
+	qoeMaxBitrate       = 1000 * 1000000 // 码率上限（bit/s）
+	qoeErrorMaxLength   = 256            // 错误描述记录日志时的最大长度
+)
+
+// qoeCDNOther 不属于配置的 CDN 的域名都汇总到该名称，任意上报的域名不会产生新的汇总行
+const qoeCDNOther = "other"
+
+// 上报的视频是否存在的缓存，按 app 和视频缓存，不存在的结果也缓存
+const (
+	qoeVideoCacheSize = 10000
+	qoeVideoCacheTTL  = 10 * time.Minute
+)
+
+var (
+	qoeVideoCacheOnce sync.Once
+	qoeVideoCache     *utils.LRUCache[string, bool]
+)
+
+// QoE 播放质量业务逻辑
+type QoE struct {
+	ctx context.Context
+}
+
+// NewQoE 创建播放质量业务逻辑对象
+func NewQoE(ctx context.Context) *QoE {
+	return &QoE{ctx: ctx}
+}
+
+// Ingest 校验播放器上报的事件并提交给汇总任务，返回接受的事件数
+// 时间段按服务端接收时间划分，不信任播放器时间；域名属于配置的 CDN 时按 CDN 名称汇总，否则汇总到 other；
+// 没有切片的视频不接受，任意上报的视频 ID 不会产生新的汇总行
+func (q *QoE) Ingest(ctx *gin.Context, req *entity.QoEBeaconRequest) (int, error) {
+	if !config.GetAppConf().GetQoEConf().Enabled {
+		return 0, ErrQoEDisabled
+	}
+	if len(req.VideoID) > qoeVideoIDMaxLength {
+		return 0, errors.New("视频ID不合法")
+	}
+	if len(req.Events) > qoeBeaconMaxEvents {
+		return 0, errors.New("每次最多上报 100 个事件")
+	}
+
+	appName := string(app.GetAppName(ctx))
+	if !qoeVideoExists(ctx, appName, req.VideoID) {
+		return 0, ErrQoEVideoNotFound
+	}
+	now := time.Now().Unix()
+	cdnNames := make(map[string]string)
+	events := make([]entity.QoEEvent, 0, len(req.Events))
+	for _, beaconEvent := range req.Events {
+		event := entity.QoEEvent{
+			App:     appName,
+			VideoID: req.VideoID,
+			Time:    now,
+			Type:    beaconEvent.Type,
+		}
+		switch beaconEvent.Type {
+		case entity.QoEEventStartup:
+			if beaconEvent.StartupMs < 0 || beaconEvent.StartupMs > qoeMaxStartupMs {
+				continue
+			}
+			event.Value = beaconEvent.StartupMs
+			if beaconEvent.Bitrate > 0 && beaconEvent.Bitrate <= qoeMaxBitrate {
+				event.Bitrate = beaconEvent.Bitrate
+			}
+		case entity.QoEEventRebuffer, entity.QoEEventWatch:
+			if beaconEvent.DurationMs <= 0 || beaconEvent.DurationMs > qoeMaxDurationMs {
+				continue
+			}
+			event.Value = beaconEvent.DurationMs
+		case entity.QoEEventBitrateSwitch:
+			if beaconEvent.Bitrate <= 0 || beaconEvent.Bitrate > qoeMaxBitrate {
+				continue
+			}
+			event.Value = beaconEvent.Bitrate
+		case entity.QoEEventError:
+			errorMessage := beaconEvent.Error
+			if len(errorMessage) > qoeErrorMaxLength {
+				errorMessage = errorMessage[:qoeErrorMaxLength]
+			}
+			logger.WithContext(ctx).Infof("[QoE.Ingest] 播放失败, video_id: %s, cdn_host: %s, error: %s",
+				req.VideoID, beaconEvent.CDNHost, errorMessage)
+		default:
+			continue
+		}
+
+		host := beaconEvent.CDNHost
+		if host == "" {
+			host = req.CDNHost
+		}
+		name, ok := cdnNames[host]
+		if !ok {
+			name = qoeCDNName(host)
+			cdnNames[host] = name
+		}
+		event.CDN = name
+		events = append(events, event)
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+	if !worker.SubmitQoEEvents(events) {
+		return 0, ErrQoEBusy
+	}
+	return len(events), nil
+}
+
+// qoeVideoExists 视频是否有切片，结果按 app 和视频缓存；查询失败时按存在处理，不丢弃上报也不缓存
+func qoeVideoExists(ctx *gin.Context, appName, videoID string) bool {
+	qoeVideoCacheOnce.Do(func() {
+		qoeVideoCache = utils.NewLRUCache[string, bool](qoeVideoCacheSize, qoeVideoCacheTTL)
+	})
+	cacheKey := appName + ":" + videoID
+	if exists, ok := qoeVideoCache.Get(cacheKey); ok {
+		return exists
+	}
+	count, err := dao.NewVideoTS(ctx).GetCountByVideoID(videoID)
+	if err != nil {
+		logger.WithContext(ctx).Warnf("[qoeVideoExists] 查询视频切片数量失败: %v, video_id: %s", err, videoID)
+		return true
+	}
+	qoeVideoCache.Set(cacheKey, count > 0)
+	return count > 0
+}
+
+// qoeCDNName 切片域名对应的 CDN 名称，不属于配置的 CDN 时返回 other
+// 播放器上报的可以是域名或完整的切片地址
+func qoeCDNName(host string) string {
+	host = normalizeQoEHost(host)
+	if host == "" {
+		return ""
+	}
+	for name, cdnConf := range config.GetAppConf().GetCDNConf() {
+		if normalizeQoEHost(cdnConf.URL) == host {
+			return name
+		}
+	}
+	return qoeCDNOther
+}
+
+// normalizeQoEHost 从域名或地址中取出小写的域名
+func normalizeQoEHost(host string) string {
+	host = strings.TrimSpace(host)
+	if host == "" {
+		return ""
+	}
+	if !strings.Contains(host, "://") {
+		host = "//" + host
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// Report 查询播放质量汇总，计算平均起播耗时、卡顿率、平均码率和播放失败率
+func (q *QoE) Report(query *entity.QoEReportQuery) ([]entity.QoEReportItem, error) {
+	stats, err := dao.NewQoEStat(q.ctx, query.App).Report(query)
+	if err != nil {
+		logger.WithContext(q.ctx).Errorf("[QoE.Report] 查询播放质量汇总失败: %v", err)
+		return nil, errors.New("查询播放质量汇总失败")
+	}
+	items := make([]entity.QoEReportItem, 0, len(stats))
+	for _, stat := range stats {
+		item := entity.QoEReportItem{
+			BucketTime:      stat.BucketTime,
+			VideoID:         stat.VideoID,
+			CDN:             stat.CDN,
+			Plays:           stat.Plays,
+			MaxStartupMs:    stat.StartupMsMax,
+			Rebuffers:       stat.Rebuffers,
+			RebufferMs:      stat.RebufferMsTotal,
+			WatchMs:         stat.WatchMsTotal,
+			BitrateSwitches: stat.BitrateSwitches,
+			Errors:          stat.Errors,
+		}
+		if stat.Plays > 0 {
+			item.AvgStartupMs = stat.StartupMsTotal / stat.Plays
+		}
+		if total := stat.WatchMsTotal + stat.RebufferMsTotal; total > 0 {
+			item.RebufferRatio = roundQoERatio(float64(stat.RebufferMsTotal) / float64(total))
+		}
+		if stat.BitrateSamples > 0 {
+			item.AvgBitrate = stat.BitrateTotal / stat.BitrateSamples
+		}
+		if attempts := stat.Plays + stat.Errors; attempts > 0 {
+			item.ErrorRate = roundQoERatio(float64(stat.Errors) / float64(attempts))
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// roundQoERatio 比率保留四位小数
+func roundQoERatio(ratio float64) float64 {
+	return math.Round(ratio*10000) / 10000
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aldge/cine_stream/app/dao"
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/logger"
+)
+
+const (
+	defaultAudioChannels  = 2           // 默认声道数
+	defaultAudioCodecs    = "mp4a.40.2" // 默认音频编码 AAC-LC
+	defaultAudioBandwidth = 128000      // 音轨没有上报切片大小时使用的码率 bit/s
+)
+
+// VideoAudio 音轨业务逻辑
+type VideoAudio struct {
+	ctx           context.Context
+	daoVideoAudio *dao.VideoAudio
+}
+
+// NewVideoAudio 创建音轨业务逻辑对象
+func NewVideoAudio(ctx context.Context) *VideoAudio {
+	return &VideoAudio{
+		ctx:           ctx,
+		daoVideoAudio: dao.NewVideoAudio(ctx),
+	}
+}
+
+// Save 保存音轨和它的切片，音轨已存在时替换全部切片和只作用于该音轨的加密信息
+func (v *VideoAudio) Save(req *entity.VideoAudioSaveRequest) (*entity.VideoAudioEntity, error) {
+	if req.VideoID == "" {
+		return nil, errors.New("视频ID不能为空")
+	}
+	if req.Language == "" {
+		return nil, errors.New("音轨语言不能为空")
+	}
+	if len(req.TSData) == 0 {
+		return nil, errors.New("音轨切片列表不能为空")
+	}
+	if req.Channels < 0 {
+		return nil, errors.New("声道数不能为负数")
+	}
+	definition := req.Definition
+	if definition == "" {
+		definition = entity.VideoAudioDefinitionPrefix + req.Language
+	}
+	// 音轨保存时会替换 definition 下的全部切片和密钥，不能是视频清晰度
+	if !strings.HasPrefix(definition, entity.VideoAudioDefinitionPrefix) || definition == entity.VideoAudioDefinitionPrefix {
+		return nil, fmt.Errorf("音轨的 definition 必须以 %s 开头", entity.VideoAudioDefinitionPrefix)
+	}
+
+	// 音轨的切片和密钥都归到音轨的 definition 下，不影响视频清晰度
+	for _, ts := range req.TSData {
+		ts.Definition = definition
+	}
+	keyList := req.Keys
+	if len(keyList) == 0 && req.Key != "" {
+		keyList = []*entity.VideoEncryptSaveItem{{Key: req.Key, IV: req.IV}}
+	}
+	for _, key := range keyList {
+		if key.Definition != "" && key.Definition != definition {
+			return nil, fmt.Errorf("音轨加密区间的清晰度必须为 %s", definition)
+		}
+		key.Definition = definition
+	}
+	tsEntityList, err := buildTSEntityList(req.VideoID, req.TSData, map[string]bool{definition: true})
+	if err != nil {
+		return nil, err
+	}
+	var encryptList []*entity.VideoEncryptEntity
+	if len(keyList) > 0 {
+		// 原有的密钥会被替换，只需要检查本次的区间
+		if encryptList, err = buildEncryptList(req.VideoID, keyList); err != nil {
+			return nil, err
+		}
+	}
+
+	channels := req.Channels
+	if channels == 0 {
+		channels = defaultAudioChannels
+	}
+	codecs := req.Codecs
+	if codecs == "" {
+		codecs = defaultAudioCodecs
+	}
+	name := req.Name
+	if name == "" {
+		name = req.Language
+	}
+	timeNow := time.Now().Unix()
+	audio := &entity.VideoAudioEntity{
+		VideoID:    req.VideoID,
+		Definition: definition,
+		Language:   req.Language,
+		Name:       name,
+		Channels:   channels,
+		Codecs:     codecs,
+		IsDefault:  req.Default,
+		CreateTime: timeNow,
+		UpdateTime: timeNow,
+	}
+	// 音轨、切片和加密信息在一个事务中替换
+	if err = v.daoVideoAudio.Replace(audio, tsEntityList, encryptList); err != nil {
+		logger.WithContext(v.ctx).Errorf("[VideoAudio.Save] 保存音轨失败: %v", err)
+		return nil, errors.New("保存音轨失败")
+	}
+	invalidatePlaylistCache(v.ctx, req.VideoID)
+
+	logger.WithContext(v.ctx).Infof("[VideoAudio.Save] 保存音轨成功, video_id: %s, definition: %s, count: %d",
+		req.VideoID, definition, len(req.TSData))
+	return audio, nil
+}
+
+// GetList 获取视频的所有音轨
+func (v *VideoAudio) GetList(videoID string) ([]entity.VideoAudioEntity, error) {
+	if videoID == "" {
+		return nil, errors.New("视频ID不能为空")
+	}
+	audioList, err := v.daoVideoAudio.GetListByVideoID(videoID)
+	if err != nil {
+		logger.WithContext(v.ctx).Errorf("[VideoAudio.GetList] 查询音轨列表失败: %v", err)
+		return nil, errors.New("查询音轨列表失败")
+	}
+	return audioList, nil
+}
@@ -3,10 +3,13 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sort"
 	"time"
 
 	"github.com/aldge/cine_stream/app/dao"
 	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/config"
 	"github.com/aldge/cine_stream/logger"
 )
 
@@ -24,32 +27,266 @@ func NewVideoEncrypt(ctx context.Context) *VideoEncrypt {
 	}
 }
 
-// Create 保存视频加密信息（单个）
-func (v *VideoEncrypt) Create(videoID, key, iv string) error {
+// Create 保存没有按区间指定的 key/iv（旧接口），返回每个清晰度最后一个试看切片的序号
+// 密钥只作用于本次保存的切片：每个清晰度一个区间，范围为本次切片的最小到最大序号，
+// 分开保存的清晰度或分批保存的切片使用各自的密钥，不会被后保存的密钥覆盖。
+// 指定了 trialKey 时在 app 配置的试看时长处轮换密钥：开始时间在试看时长内的切片使用 trialKey，
+// 之后的切片使用 key，试看 token 只能获取 trialKey，不能解密试看之后的切片
+func (v *VideoEncrypt) Create(videoID, key, iv, trialKey, trialIV string, tsList []*entity.VideoTsSaveDataItem) (map[string]int64, error) {
+	if key == "" {
+		return nil, errors.New("加密密钥不能为空")
+	}
+	if len(tsList) == 0 {
+		return nil, errors.New("TS切片列表不能为空")
+	}
+	// 每个清晰度的切片按序号排列
+	definitionTS := make(map[string][]*entity.VideoTsSaveDataItem)
+	var definitions []string
+	for _, ts := range tsList {
+		if _, ok := definitionTS[ts.Definition]; !ok {
+			definitions = append(definitions, ts.Definition)
+		}
+		definitionTS[ts.Definition] = append(definitionTS[ts.Definition], ts)
+	}
+
+	var trialSeconds float64
+	if trialKey != "" {
+		if trialKey == key {
+			return nil, errors.New("试看密钥不能与视频密钥相同")
+		}
+		trialConf := config.GetAppConf().GetTrialConf(contextAppName(v.ctx))
+		if !trialConf.Enabled || trialConf.Minutes <= 0 {
+			return nil, errors.New("app 没有开启按分钟试看，不能指定试看密钥")
+		}
+		trialSeconds = float64(trialConf.Minutes * 60)
+	}
+
+	var keyList []*entity.VideoEncryptSaveItem
+	trialEnds := make(map[string]int64)
+	for _, definition := range definitions {
+		list := definitionTS[definition]
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].TSSequence < list[j].TSSequence
+		})
+		startSequence, endSequence := list[0].TSSequence, list[len(list)-1].TSSequence
+		if trialKey != "" {
+			trialEnd, err := v.trialEndSequence(videoID, definition, list, trialSeconds)
+			if err != nil {
+				return nil, err
+			}
+			if trialEnd >= startSequence {
+				end := min(trialEnd, endSequence)
+				keyList = append(keyList, &entity.VideoEncryptSaveItem{
+					Key: trialKey, IV: trialIV, Definition: definition, StartSequence: startSequence, EndSequence: &end,
+				})
+				trialEnds[definition] = trialEnd
+				startSequence = end + 1
+			}
+		}
+		if startSequence > endSequence {
+			continue
+		}
+		end := endSequence
+		keyList = append(keyList, &entity.VideoEncryptSaveItem{
+			Key: key, IV: iv, Definition: definition, StartSequence: startSequence, EndSequence: &end,
+		})
+	}
+	if err := v.BatchCreate(videoID, keyList); err != nil {
+		return nil, err
+	}
+	return trialEnds, nil
+}
+
+// trialEndSequence 清晰度最后一个试看切片的序号，与试看 m3u8 的截取规则相同：开始时间小于试看时长的切片都是试看切片
+// list 为本次保存的切片（按序号排列），之前保存的切片时长从数据库中累加；本次切片都不在试看范围内时返回 -1
+func (v *VideoEncrypt) trialEndSequence(videoID, definition string, list []*entity.VideoTsSaveDataItem, trialSeconds float64) (int64, error) {
+	start := 0.0
+	if list[0].TSSequence > 0 {
+		savedList, err := dao.NewVideoTS(v.ctx).GetByVideoDefinition(videoID, definition)
+		if err != nil {
+			logger.WithContext(v.ctx).Errorf("[VideoEncrypt.trialEndSequence] 查询TS切片列表失败: %v", err)
+			return 0, errors.New("查询TS切片列表失败")
+		}
+		for _, ts := range savedList {
+			if ts.TSSequence < list[0].TSSequence {
+				start += ts.Duration
+			}
+		}
+	}
+	trialEnd := int64(-1)
+	for _, ts := range list {
+		if start >= trialSeconds {
+			break
+		}
+		trialEnd = ts.TSSequence
+		start += ts.Duration
+	}
+	return trialEnd, nil
+}
+
+// BatchCreate 按TS序号区间批量保存视频加密信息（密钥轮换）
+// 新区间不能与本次或已保存的同一清晰度的区间重叠，以下两种情况除外：
+// 与已保存的区间完全相同（重复提交）时跳过；已保存的区间没有结束且起始序号更小时，在新区间之前结束（直播轮换密钥）
+func (v *VideoEncrypt) BatchCreate(videoID string, keyList []*entity.VideoEncryptSaveItem) error {
 	if videoID == "" {
 		return errors.New("视频ID不能为空")
 	}
-	if key == "" {
-		return errors.New("加密密钥不能为空")
+	encryptList, err := buildEncryptList(videoID, keyList)
+	if err != nil {
+		return err
 	}
 
-	encrypt := &entity.VideoEncryptEntity{
-		VideoID:    videoID,
-		Key:        key,
-		IV:         iv,
-		CreateTime: uint64(time.Now().Unix()),
+	existList, err := v.daoVideoEncrypt.GetListByVideoID(videoID)
+	if err != nil {
+		logger.WithContext(v.ctx).Errorf("[VideoEncrypt.BatchCreate] 查询已保存的加密信息失败: %v", err)
+		return errors.New("查询视频加密信息失败")
+	}
+	insertList, closeList, err := mergeEncryptList(existList, encryptList)
+	if err != nil {
+		return err
+	}
+	if len(insertList) == 0 && len(closeList) == 0 {
+		return nil
 	}
 
-	err := v.daoVideoEncrypt.Insert(encrypt)
+	err = v.daoVideoEncrypt.BatchSave(insertList, closeList)
 	if err != nil {
-		logger.WithContext(v.ctx).Errorf("[VideoEncrypt.SaveEncryptInfo] 保存视频加密信息失败: %v", err)
+		logger.WithContext(v.ctx).Errorf("[VideoEncrypt.BatchCreate] 批量保存视频加密信息失败: %v", err)
 		return errors.New("保存视频加密信息失败")
 	}
+	invalidatePlaylistCache(v.ctx, videoID)
 
-	logger.WithContext(v.ctx).Infof("[VideoEncrypt.SaveEncryptInfo] 保存视频加密信息成功, video_id: %s", videoID)
+	logger.WithContext(v.ctx).Infof("[VideoEncrypt.BatchCreate] 批量保存视频加密信息成功, video_id: %s, count: %d, closed: %d",
+		videoID, len(insertList), len(closeList))
 	return nil
 }
 
+// buildEncryptList 校验上报的加密区间并转换为加密信息记录，同一清晰度的区间不能重叠
+func buildEncryptList(videoID string, keyList []*entity.VideoEncryptSaveItem) ([]*entity.VideoEncryptEntity, error) {
+	if len(keyList) == 0 {
+		return nil, errors.New("加密信息列表不能为空")
+	}
+	timeNow := uint64(time.Now().Unix())
+
+	var encryptList []*entity.VideoEncryptEntity
+	for _, item := range keyList {
+		if item.Key == "" {
+			return nil, errors.New("加密密钥不能为空")
+		}
+		if item.StartSequence < 0 {
+			return nil, errors.New("加密区间起始序号不能为负数")
+		}
+		endSequence := int64(-1)
+		if item.EndSequence != nil && *item.EndSequence >= 0 {
+			endSequence = *item.EndSequence
+			if endSequence < item.StartSequence {
+				return nil, fmt.Errorf("加密区间结束序号不能小于起始序号: %d-%d", item.StartSequence, endSequence)
+			}
+		}
+		encryptList = append(encryptList, &entity.VideoEncryptEntity{
+			VideoID:       videoID,
+			Key:           item.Key,
+			IV:            item.IV,
+			Definition:    item.Definition,
+			StartSequence: item.StartSequence,
+			EndSequence:   endSequence,
+			CreateTime:    timeNow,
+		})
+	}
+	if err := checkEncryptOverlap(encryptList); err != nil {
+		return nil, err
+	}
+	return encryptList, nil
+}
+
+// checkEncryptOverlap 检查同一清晰度的加密区间是否重叠
+func checkEncryptOverlap(encryptList []*entity.VideoEncryptEntity) error {
+	sorted := make([]*entity.VideoEncryptEntity, len(encryptList))
+	copy(sorted, encryptList)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Definition != sorted[j].Definition {
+			return sorted[i].Definition < sorted[j].Definition
+		}
+		return sorted[i].StartSequence < sorted[j].StartSequence
+	})
+	for i := 1; i < len(sorted); i++ {
+		prev, cur := sorted[i-1], sorted[i]
+		if prev.Definition != cur.Definition {
+			continue
+		}
+		if prev.EndSequence < 0 || cur.StartSequence <= prev.EndSequence {
+			return fmt.Errorf("加密区间重叠, definition: %s, start_sequence: %d", cur.Definition, cur.StartSequence)
+		}
+	}
+	return nil
+}
+
+// mergeEncryptList 把新区间和已保存的区间合并，返回需要新增的区间和需要结束的已保存区间
+// 规则见 BatchCreate；已保存的区间之间的重叠（旧数据）不处理
+func mergeEncryptList(existList []entity.VideoEncryptEntity, encryptList []*entity.VideoEncryptEntity) (
+	[]*entity.VideoEncryptEntity, []*entity.VideoEncryptEntity, error) {
+	exists := make([]*entity.VideoEncryptEntity, len(existList))
+	for i := range existList {
+		exists[i] = &existList[i]
+	}
+	closed := make(map[uint64]*entity.VideoEncryptEntity)
+	var insertList, closeList []*entity.VideoEncryptEntity
+
+NextEncrypt:
+	for _, encrypt := range encryptList {
+		for _, exist := range exists {
+			if exist.Definition != encrypt.Definition {
+				continue
+			}
+			if exist.StartSequence == encrypt.StartSequence && exist.EndSequence == encrypt.EndSequence &&
+				exist.Key == encrypt.Key && exist.IV == encrypt.IV {
+				continue NextEncrypt
+			}
+		}
+		for _, exist := range exists {
+			if exist.Definition != encrypt.Definition || !encryptRangeOverlap(exist, encrypt) {
+				continue
+			}
+			if exist.EndSequence < 0 && exist.StartSequence < encrypt.StartSequence {
+				exist.EndSequence = encrypt.StartSequence - 1
+				if _, ok := closed[exist.VideoEncryptID]; !ok {
+					closed[exist.VideoEncryptID] = exist
+					closeList = append(closeList, exist)
+				}
+				continue
+			}
+			return nil, nil, fmt.Errorf("加密区间与已保存的区间重叠, definition: %s, start_sequence: %d, 已保存: %d-%d",
+				encrypt.Definition, encrypt.StartSequence, exist.StartSequence, exist.EndSequence)
+		}
+		insertList = append(insertList, encrypt)
+	}
+	return insertList, closeList, nil
+}
+
+// encryptRangeOverlap 两个加密区间的序号范围是否重叠，结束序号小于 0 表示到最后
+func encryptRangeOverlap(a, b *entity.VideoEncryptEntity) bool {
+	if a.EndSequence >= 0 && a.EndSequence < b.StartSequence {
+		return false
+	}
+	if b.EndSequence >= 0 && b.EndSequence < a.StartSequence {
+		return false
+	}
+	return true
+}
+
+// GetEncryptInfo 获取视频指定的加密信息，keyID 为 0 时返回第一个
+func (v *VideoEncrypt) GetEncryptInfo(videoID string, keyID uint64) (*entity.VideoEncryptEntity, error) {
+	if keyID == 0 {
+		return v.GetEncryptInfoByVideoID(videoID)
+	}
+	encryptInfo, err := v.daoVideoEncrypt.GetByID(videoID, keyID)
+	if err != nil {
+		logger.WithContext(v.ctx).Errorf("[VideoEncrypt.GetEncryptInfo] 查询视频加密信息失败: %v, key_id: %d", err, keyID)
+		return nil, errors.New("查询视频加密信息失败")
+	}
+	return encryptInfo, nil
+}
+
 // GetEncryptInfoByVideoID 根据video_id获取视频加密信息（兼容旧接口，返回第一个）
 func (v *VideoEncrypt) GetEncryptInfoByVideoID(videoID string) (*entity.VideoEncryptEntity, error) {
 	if videoID == "" {
@@ -75,6 +312,7 @@ func (v *VideoEncrypt) DeleteEncryptInfoByVideoID(videoID string) error {
 		logger.WithContext(v.ctx).Errorf("[VideoEncrypt.DeleteEncryptInfoByVideoID] 删除视频加密信息失败: %v", err)
 		return errors.New("删除视频加密信息失败")
 	}
+	invalidatePlaylistCache(v.ctx, videoID)
 
 	logger.WithContext(v.ctx).Infof("[VideoEncrypt.DeleteEncryptInfoByVideoID] 删除视频加密信息成功, video_id: %s", videoID)
 	return nil
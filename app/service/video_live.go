@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aldge/cine_stream/app/dao"
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/logger"
+)
+
+const defaultLiveWindowSize = 6 // 默认滑动窗口切片数
+
+var (
+	// ErrLiveNotFound 直播不存在
+	ErrLiveNotFound = errors.New("直播不存在")
+	// ErrLiveEnded 直播已结束
+	ErrLiveEnded = errors.New("直播已结束")
+)
+
+// VideoLive 直播业务逻辑
+type VideoLive struct {
+	ctx          context.Context
+	daoVideoLive *dao.VideoLive
+}
+
+// NewVideoLive 创建直播业务逻辑对象
+func NewVideoLive(ctx context.Context) *VideoLive {
+	return &VideoLive{
+		ctx:          ctx,
+		daoVideoLive: dao.NewVideoLive(ctx),
+	}
+}
+
+// Start 开始直播，视频的媒体 m3u8 从此按直播输出
+func (v *VideoLive) Start(req *entity.VideoLiveStartRequest) (*entity.VideoLiveEntity, error) {
+	if req.VideoID == "" {
+		return nil, errors.New("视频ID不能为空")
+	}
+	playlistType := req.PlaylistType
+	if playlistType == "" {
+		playlistType = entity.VideoLivePlaylistTypeLive
+	}
+	if playlistType != entity.VideoLivePlaylistTypeLive && playlistType != entity.VideoLivePlaylistTypeEvent {
+		return nil, errors.New("不支持的直播类型: " + playlistType)
+	}
+	if req.WindowSize < 0 || req.TargetDuration < 0 {
+		return nil, errors.New("滑动窗口和目标时长不能为负数")
+	}
+	windowSize := req.WindowSize
+	if windowSize == 0 {
+		windowSize = defaultLiveWindowSize
+	}
+
+	timeNow := time.Now().Unix()
+	live := &entity.VideoLiveEntity{
+		VideoID:        req.VideoID,
+		PlaylistType:   playlistType,
+		WindowSize:     windowSize,
+		TargetDuration: req.TargetDuration,
+		Status:         entity.VideoLiveStatusLive,
+		CreateTime:     timeNow,
+		UpdateTime:     timeNow,
+	}
+	if err := v.daoVideoLive.Insert(live); err != nil {
+		logger.WithContext(v.ctx).Errorf("[VideoLive.Start] 保存直播信息失败: %v", err)
+		return nil, errors.New("保存直播信息失败")
+	}
+	bumpPlayRevision(v.ctx, req.VideoID, PlayRevisionLive)
+	bumpPlaylistCacheVersion(v.ctx, req.VideoID)
+
+	logger.WithContext(v.ctx).Infof("[VideoLive.Start] 开始直播, video_id: %s, type: %s", req.VideoID, playlistType)
+	return live, nil
+}
+
+// Get 获取直播信息
+func (v *VideoLive) Get(videoID string) (*entity.VideoLiveEntity, error) {
+	live, err := v.daoVideoLive.GetByVideoID(videoID)
+	if errors.Is(err, dao.ErrRecordNotFound) {
+		return nil, ErrLiveNotFound
+	}
+	if err != nil {
+		logger.WithContext(v.ctx).Errorf("[VideoLive.Get] 查询直播信息失败: %v", err)
+		return nil, errors.New("查询直播信息失败")
+	}
+	return live, nil
+}
+
+// Append 直播追加切片，可同时追加新切片的加密区间（密钥轮换）
+func (v *VideoLive) Append(req *entity.VideoLiveAppendRequest) error {
+	live, err := v.Get(req.VideoID)
+	if err != nil {
+		return err
+	}
+	if live.IsEnded() {
+		return ErrLiveEnded
+	}
+
+	// 先保存轮换的密钥再保存切片：播放器刷新 m3u8 时新切片一定有对应的密钥，
+	// 不会用上一个密钥解密；保存切片失败时重试追加，相同的密钥不会重复保存
+	if len(req.Keys) > 0 {
+		if err = NewVideoEncrypt(v.ctx).BatchCreate(req.VideoID, req.Keys); err != nil {
+			return err
+		}
+	}
+	if err = NewVideoTS(v.ctx).BatchCreate(req.VideoID, req.TSData); err != nil {
+		return err
+	}
+
+	logger.WithContext(v.ctx).Infof("[VideoLive.Append] 追加直播切片成功, video_id: %s, count: %d", req.VideoID, len(req.TSData))
+	return nil
+}
+
+// Finalize 结束直播，之后 m3u8 输出 EXT-X-ENDLIST
+func (v *VideoLive) Finalize(videoID string) error {
+	live, err := v.Get(videoID)
+	if err != nil {
+		return err
+	}
+	if live.IsEnded() {
+		return nil
+	}
+	if err = v.daoVideoLive.UpdateStatus(videoID, entity.VideoLiveStatusEnded, time.Now().Unix()); err != nil {
+		logger.WithContext(v.ctx).Errorf("[VideoLive.Finalize] 更新直播状态失败: %v", err)
+		return errors.New("更新直播状态失败")
+	}
+	bumpPlayRevision(v.ctx, videoID, PlayRevisionLive)
+	bumpPlaylistCacheVersion(v.ctx, videoID)
+
+	logger.WithContext(v.ctx).Infof("[VideoLive.Finalize] 结束直播, video_id: %s", videoID)
+	return nil
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aldge/cine_stream/app/dao"
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/config"
+	"github.com/aldge/cine_stream/logger"
+	"github.com/aldge/cine_stream/utils"
+)
+
+// ErrSubtitleNotFound 字幕轨道不存在
+var ErrSubtitleNotFound = errors.New("字幕不存在")
+
+// VideoSubtitle 字幕业务逻辑
+type VideoSubtitle struct {
+	ctx              context.Context
+	daoVideoSubtitle *dao.VideoSubtitle
+	daoVideoTS       *dao.VideoTS
+}
+
+// NewVideoSubtitle 创建字幕业务逻辑对象
+func NewVideoSubtitle(ctx context.Context) *VideoSubtitle {
+	return &VideoSubtitle{
+		ctx:              ctx,
+		daoVideoSubtitle: dao.NewVideoSubtitle(ctx),
+		daoVideoTS:       dao.NewVideoTS(ctx),
+	}
+}
+
+// Save 保存字幕轨道和它的 WebVTT 切片，轨道已存在时替换全部切片
+func (v *VideoSubtitle) Save(req *entity.VideoSubtitleSaveRequest) (*entity.VideoSubtitleEntity, error) {
+	if req.VideoID == "" {
+		return nil, errors.New("视频ID不能为空")
+	}
+	if req.Language == "" {
+		return nil, errors.New("字幕语言不能为空")
+	}
+	if len(req.Segments) == 0 {
+		return nil, errors.New("字幕切片列表不能为空")
+	}
+	timeNow := time.Now().Unix()
+
+	sequences := make(map[int64]bool, len(req.Segments))
+	segmentList := make([]*entity.VideoSubtitleSegmentEntity, 0, len(req.Segments))
+	for _, item := range req.Segments {
+		if item.Path == "" {
+			return nil, fmt.Errorf("字幕切片路径不能为空, sequence: %d", item.Sequence)
+		}
+		if item.Sequence < 0 || item.Duration <= 0 {
+			return nil, fmt.Errorf("字幕切片序号或时长不合法, sequence: %d", item.Sequence)
+		}
+		if sequences[item.Sequence] {
+			return nil, fmt.Errorf("字幕切片序号重复, sequence: %d", item.Sequence)
+		}
+		sequences[item.Sequence] = true
+		segmentList = append(segmentList, &entity.VideoSubtitleSegmentEntity{
+			VideoID:    req.VideoID,
+			Sequence:   item.Sequence,
+			Path:       item.Path,
+			Duration:   item.Duration,
+			CreateTime: timeNow,
+		})
+	}
+
+	subtitle := newSubtitleEntity(req.VideoID, req.Language, req.Name, req.Default, req.Forced, timeNow)
+	if err := v.daoVideoSubtitle.SaveWithSegments(subtitle, segmentList); err != nil {
+		logger.WithContext(v.ctx).Errorf("[VideoSubtitle.Save] 保存字幕失败: %v", err)
+		return nil, errors.New("保存字幕失败")
+	}
+	bumpPlayRevision(v.ctx, req.VideoID, PlayRevisionSubtitles)
+
+	logger.WithContext(v.ctx).Infof("[VideoSubtitle.Save] 保存字幕成功, video_id: %s, language: %s, count: %d",
+		req.VideoID, req.Language, len(segmentList))
+	return subtitle, nil
+}
+
+// Upload 上传 SRT/ASS 字幕：转换为 WebVTT，按视频切片的时长切分后保存，返回字幕轨道和切片数
+func (v *VideoSubtitle) Upload(req *entity.VideoSubtitleUploadRequest, filename string, data []byte) (*entity.VideoSubtitleEntity, int, error) {
+	if req.VideoID == "" {
+		return nil, 0, errors.New("视频ID不能为空")
+	}
+	if req.Language == "" {
+		return nil, 0, errors.New("字幕语言不能为空")
+	}
+	text, err := utils.DecodeSubtitleText(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	format := strings.ToLower(req.Format)
+	if format == "" {
+		format = utils.DetectSubtitleFormat(filename, text)
+	}
+	cues, err := utils.ParseSubtitle(format, text)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(cues) == 0 {
+		return nil, 0, errors.New("字幕文件中没有字幕")
+	}
+
+	// 字幕切片与视频切片一一对应，播放器按相同的边界加载
+	definition, err := NewPlay(v.ctx).ResolveDefinition(req.VideoID, req.Definition)
+	if err != nil {
+		return nil, 0, err
+	}
+	tsList, err := v.daoVideoTS.GetByVideoDefinition(req.VideoID, definition)
+	if err != nil {
+		logger.WithContext(v.ctx).Errorf("[VideoSubtitle.Upload] 查询TS切片列表失败: %v", err)
+		return nil, 0, errors.New("查询TS切片列表失败")
+	}
+	if len(tsList) == 0 {
+		return nil, 0, errors.New("该视频没有TS切片")
+	}
+	mpegts := config.GetAppConf().GetSubtitleConf().TimestampMPEGTS
+	if req.MPEGTS != nil {
+		mpegts = *req.MPEGTS
+	}
+
+	timeNow := time.Now().Unix()
+	durations := make([]float64, 0, len(tsList))
+	for _, ts := range tsList {
+		durations = append(durations, ts.Duration)
+	}
+	segmentCues := utils.SplitSubtitleCues(cues, durations)
+	segmentList := make([]*entity.VideoSubtitleSegmentEntity, 0, len(tsList))
+	for i, ts := range tsList {
+		segmentList = append(segmentList, &entity.VideoSubtitleSegmentEntity{
+			VideoID:    req.VideoID,
+			Sequence:   ts.TSSequence,
+			Duration:   ts.Duration,
+			Content:    utils.BuildWebVTT(segmentCues[i], mpegts),
+			CreateTime: timeNow,
+		})
+	}
+
+	subtitle := newSubtitleEntity(req.VideoID, req.Language, req.Name, req.Default, req.Forced, timeNow)
+	if err = v.daoVideoSubtitle.SaveWithSegments(subtitle, segmentList); err != nil {
+		logger.WithContext(v.ctx).Errorf("[VideoSubtitle.Upload] 保存字幕失败: %v", err)
+		return nil, 0, errors.New("保存字幕失败")
+	}
+	bumpPlayRevision(v.ctx, req.VideoID, PlayRevisionSubtitles)
+
+	logger.WithContext(v.ctx).Infof("[VideoSubtitle.Upload] 上传字幕成功, video_id: %s, language: %s, format: %s, cues: %d, segments: %d",
+		req.VideoID, req.Language, format, len(cues), len(segmentList))
+	return subtitle, len(segmentList), nil
+}
+
+// GetSegmentContent 获取转换生成的 WebVTT 切片内容
+func (v *VideoSubtitle) GetSegmentContent(videoID string, subtitleID uint64, sequence int64) (string, error) {
+	segment, err := v.daoVideoSubtitle.GetSegment(videoID, subtitleID, sequence)
+	if errors.Is(err, dao.ErrRecordNotFound) {
+		return "", ErrSubtitleNotFound
+	}
+	if err != nil {
+		logger.WithContext(v.ctx).Errorf("[VideoSubtitle.GetSegmentContent] 查询字幕切片失败: %v", err)
+		return "", errors.New("查询字幕切片失败")
+	}
+	if segment.Content == "" {
+		return "", ErrSubtitleNotFound
+	}
+	return segment.Content, nil
+}
+
+// newSubtitleEntity 创建字幕轨道实体，名称默认为语言
+func newSubtitleEntity(videoID, language, name string, isDefault, isForced bool, timeNow int64) *entity.VideoSubtitleEntity {
+	if name == "" {
+		name = language
+	}
+	return &entity.VideoSubtitleEntity{
+		VideoID:    videoID,
+		Language:   language,
+		Name:       name,
+		IsDefault:  isDefault,
+		IsForced:   isForced,
+		CreateTime: timeNow,
+		UpdateTime: timeNow,
+	}
+}
+
+// GetList 获取视频的所有字幕轨道
+func (v *VideoSubtitle) GetList(videoID string) ([]entity.VideoSubtitleEntity, error) {
+	if videoID == "" {
+		return nil, errors.New("视频ID不能为空")
+	}
+	subtitleList, err := v.daoVideoSubtitle.GetListByVideoID(videoID)
+	if err != nil {
+		logger.WithContext(v.ctx).Errorf("[VideoSubtitle.GetList] 查询字幕列表失败: %v", err)
+		return nil, errors.New("查询字幕列表失败")
+	}
+	return subtitleList, nil
+}
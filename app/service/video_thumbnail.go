@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aldge/cine_stream/app/dao"
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/logger"
+)
+
+// VideoThumbnail 缩略图雪碧图业务逻辑
+type VideoThumbnail struct {
+	ctx               context.Context
+	daoVideoThumbnail *dao.VideoThumbnail
+}
+
+// NewVideoThumbnail 创建缩略图雪碧图业务逻辑对象
+func NewVideoThumbnail(ctx context.Context) *VideoThumbnail {
+	return &VideoThumbnail{
+		ctx:               ctx,
+		daoVideoThumbnail: dao.NewVideoThumbnail(ctx),
+	}
+}
+
+// Save 保存视频的缩略图雪碧图，替换原有的全部雪碧图
+func (v *VideoThumbnail) Save(req *entity.VideoThumbnailSaveRequest) ([]*entity.VideoThumbnailEntity, error) {
+	if req.VideoID == "" {
+		return nil, errors.New("视频ID不能为空")
+	}
+	if req.Interval <= 0 {
+		return nil, errors.New("缩略图间隔必须大于 0")
+	}
+	if req.Columns <= 0 || req.Rows <= 0 || req.TileWidth <= 0 || req.TileHeight <= 0 {
+		return nil, errors.New("雪碧图网格和缩略图尺寸必须大于 0")
+	}
+	if len(req.Sprites) == 0 {
+		return nil, errors.New("雪碧图列表不能为空")
+	}
+
+	gridSize := req.Columns * req.Rows
+	timeNow := time.Now().Unix()
+	thumbnails := make([]*entity.VideoThumbnailEntity, 0, len(req.Sprites))
+	for i, sprite := range req.Sprites {
+		if sprite.Path == "" {
+			return nil, fmt.Errorf("第 %d 张雪碧图路径不能为空", i)
+		}
+		count := sprite.Count
+		if count == 0 {
+			count = gridSize
+		}
+		if count < 0 || count > gridSize {
+			return nil, fmt.Errorf("第 %d 张雪碧图的缩略图数量必须在 1 到 %d 之间", i, gridSize)
+		}
+		// 缩略图按顺序连续排列，只有最后一张可以不满
+		if count < gridSize && i != len(req.Sprites)-1 {
+			return nil, fmt.Errorf("只有最后一张雪碧图可以不满, 第 %d 张只有 %d 张缩略图", i, count)
+		}
+		thumbnails = append(thumbnails, &entity.VideoThumbnailEntity{
+			VideoID:    req.VideoID,
+			Sequence:   int64(i),
+			Path:       sprite.Path,
+			Columns:    req.Columns,
+			Rows:       req.Rows,
+			TileWidth:  req.TileWidth,
+			TileHeight: req.TileHeight,
+			TileCount:  count,
+			Interval:   req.Interval,
+			CreateTime: timeNow,
+		})
+	}
+
+	if err := v.daoVideoThumbnail.Replace(req.VideoID, thumbnails); err != nil {
+		logger.WithContext(v.ctx).Errorf("[VideoThumbnail.Save] 保存雪碧图失败: %v", err)
+		return nil, errors.New("保存雪碧图失败")
+	}
+	bumpPlayRevision(v.ctx, req.VideoID, PlayRevisionThumbnails)
+	logger.WithContext(v.ctx).Infof("[VideoThumbnail.Save] 保存雪碧图成功, video_id: %s, count: %d", req.VideoID, len(thumbnails))
+	return thumbnails, nil
+}
+
+// GetList 获取视频的所有雪碧图
+func (v *VideoThumbnail) GetList(videoID string) ([]entity.VideoThumbnailEntity, error) {
+	if videoID == "" {
+		return nil, errors.New("视频ID不能为空")
+	}
+	thumbnailList, err := v.daoVideoThumbnail.GetListByVideoID(videoID)
+	if err != nil {
+		logger.WithContext(v.ctx).Errorf("[VideoThumbnail.GetList] 查询雪碧图列表失败: %v", err)
+		return nil, errors.New("查询雪碧图列表失败")
+	}
+	return thumbnailList, nil
+}
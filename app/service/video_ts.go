@@ -3,6 +3,8 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/aldge/cine_stream/app/dao"
@@ -10,17 +12,24 @@ import (
 	"github.com/aldge/cine_stream/logger"
 )
 
+// ErrAudioDefinitionNotFound 切片的 definition 使用音轨前缀，但视频没有该音轨
+var ErrAudioDefinitionNotFound = errors.New("视频没有该音轨，音轨切片需要通过 /video_audio/save 保存")
+
 // VideoTS TS切片业务逻辑
 type VideoTS struct {
-	ctx        context.Context
-	daoVideoTS *dao.VideoTS
+	ctx             context.Context
+	daoVideoTS      *dao.VideoTS
+	daoVideoEncrypt *dao.VideoEncrypt
+	daoVideoAudio   *dao.VideoAudio
 }
 
 // NewVideoTS 创建TS切片业务逻辑对象
 func NewVideoTS(ctx context.Context) *VideoTS {
 	return &VideoTS{
-		ctx:        ctx,
-		daoVideoTS: dao.NewVideoTS(ctx),
+		ctx:             ctx,
+		daoVideoTS:      dao.NewVideoTS(ctx),
+		daoVideoEncrypt: dao.NewVideoEncrypt(ctx),
+		daoVideoAudio:   dao.NewVideoAudio(ctx),
 	}
 }
 
@@ -29,8 +38,80 @@ func (v *VideoTS) BatchCreate(videoID string, tsList []*entity.VideoTsSaveDataIt
 	if videoID == "" {
 		return errors.New("视频ID不能为空")
 	}
+	audioDefinitions, err := v.loadAudioDefinitions(videoID, tsList)
+	if err != nil {
+		return err
+	}
+	tsEntityList, err := buildTSEntityList(videoID, tsList, audioDefinitions)
+	if err != nil {
+		return err
+	}
+	if err = v.dropEncryptedKeyframes(videoID, tsEntityList); err != nil {
+		return err
+	}
+
+	// 批量保存到数据库
+	err = v.daoVideoTS.BatchInsert(videoID, tsEntityList)
+	if err != nil {
+		logger.WithContext(v.ctx).Errorf("[VideoTS.BatchCreate] 批量保存TS切片失败: %v", err)
+		return err
+	}
+	invalidatePlaylistCache(v.ctx, videoID)
+
+	logger.WithContext(v.ctx).Infof("[VideoTS.BatchCreate] 批量保存TS切片成功, video_id: %s, count: %d", videoID, len(tsList))
+	return nil
+}
+
+// loadAudioDefinitions 切片中有音轨前缀的 definition 时，查询视频已保存的音轨 definition
+func (v *VideoTS) loadAudioDefinitions(videoID string, tsList []*entity.VideoTsSaveDataItem) (map[string]bool, error) {
+	hasAudio := false
+	for _, ts := range tsList {
+		if strings.HasPrefix(ts.Definition, entity.VideoAudioDefinitionPrefix) {
+			hasAudio = true
+			break
+		}
+	}
+	if !hasAudio {
+		return nil, nil
+	}
+	audioList, err := v.daoVideoAudio.GetListByVideoID(videoID)
+	if err != nil {
+		logger.WithContext(v.ctx).Errorf("[VideoTS.loadAudioDefinitions] 查询视频音轨失败: %v", err)
+		return nil, errors.New("查询视频音轨失败")
+	}
+	audioDefinitions := make(map[string]bool, len(audioList))
+	for _, audio := range audioList {
+		audioDefinitions[audio.Definition] = true
+	}
+	return audioDefinitions, nil
+}
+
+// dropEncryptedKeyframes 去掉加密切片的关键帧信息
+// 切片整段 AES-128-CBC 加密，关键帧的字节范围无法单独解密，不能用于 I-frame 列表；密钥先于切片保存
+func (v *VideoTS) dropEncryptedKeyframes(videoID string, tsEntityList []*entity.VideoTSEntity) error {
+	encryptList, err := v.daoVideoEncrypt.GetListByVideoID(videoID)
+	if err != nil {
+		logger.WithContext(v.ctx).Errorf("[VideoTS.dropEncryptedKeyframes] 查询视频加密信息失败: %v", err)
+		return errors.New("查询视频加密信息失败")
+	}
+	dropped := 0
+	for _, tsEntity := range tsEntityList {
+		if tsEntity.Keyframes != "" && findSegmentEncrypt(encryptList, tsEntity.Definition, tsEntity.TSSequence) != nil {
+			tsEntity.Keyframes = ""
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		logger.WithContext(v.ctx).Infof("[VideoTS.dropEncryptedKeyframes] 加密切片不保存关键帧, video_id: %s, count: %d", videoID, dropped)
+	}
+	return nil
+}
+
+// buildTSEntityList 校验上报的切片并转换为切片记录
+// 音轨前缀的 definition 只能是 audioDefinitions 中已登记的音轨，没有音轨记录的切片会被当作视频清晰度输出
+func buildTSEntityList(videoID string, tsList []*entity.VideoTsSaveDataItem, audioDefinitions map[string]bool) ([]*entity.VideoTSEntity, error) {
 	if len(tsList) == 0 {
-		return errors.New("TS切片列表不能为空")
+		return nil, errors.New("TS切片列表不能为空")
 	}
 	timeNow := time.Now().Unix()
 
@@ -39,30 +120,65 @@ func (v *VideoTS) BatchCreate(videoID string, tsList []*entity.VideoTsSaveDataIt
 	// 设置每个TS切片的默认值
 	for _, ts := range tsList {
 		if ts.TSSequence < 0 {
-			return errors.New("TS序号不能为负数")
+			return nil, errors.New("TS序号不能为负数")
 		}
 		if ts.Duration <= 0 {
-			return errors.New("TS时长必须大于0")
+			return nil, errors.New("TS时长必须大于0")
+		}
+		if strings.HasPrefix(ts.Definition, entity.VideoAudioDefinitionPrefix) && !audioDefinitions[ts.Definition] {
+			return nil, fmt.Errorf("%w: %s", ErrAudioDefinitionNotFound, ts.Definition)
+		}
+		if ts.TSSize < 0 {
+			return nil, errors.New("TS大小不能为负数")
+		}
+		container := ts.Container
+		if container == "" {
+			container = entity.VideoTSContainerTS
+		}
+		if container != entity.VideoTSContainerTS && container != entity.VideoTSContainerFMP4 {
+			return nil, fmt.Errorf("不支持的切片封装格式: %s", ts.Container)
+		}
+		if container == entity.VideoTSContainerFMP4 && ts.InitPath == "" {
+			return nil, errors.New("fmp4 切片的初始化切片路径不能为空")
+		}
+		if ts.ByteOffset < 0 || ts.ByteLength < 0 || ts.InitByteOffset < 0 || ts.InitByteLength < 0 {
+			return nil, errors.New("字节范围不能为负数")
+		}
+		if ts.ByteOffset > 0 && ts.ByteLength == 0 {
+			return nil, errors.New("指定了起始字节时字节长度必须大于0")
+		}
+		if ts.InitByteOffset > 0 && ts.InitByteLength == 0 {
+			return nil, errors.New("指定了初始化切片起始字节时字节长度必须大于0")
+		}
+		// 字节范围切片的大小就是字节长度
+		tsSize := ts.TSSize
+		if tsSize == 0 && ts.ByteLength > 0 {
+			tsSize = ts.ByteLength
+		}
+		keyframes, err := encodeKeyframes(ts, tsSize)
+		if err != nil {
+			return nil, err
 		}
 		var tsEntity entity.VideoTSEntity
 		tsEntity.VideoID = videoID
 		tsEntity.TSPath = ts.TSPath
+		tsEntity.TSPathB = ts.TSPathB
 		tsEntity.TSSequence = ts.TSSequence
 		tsEntity.Duration = ts.Duration
 		tsEntity.Definition = ts.Definition
+		tsEntity.TSSize = tsSize
+		tsEntity.ByteOffset = ts.ByteOffset
+		tsEntity.ByteLength = ts.ByteLength
+		tsEntity.Container = container
+		tsEntity.InitPath = ts.InitPath
+		tsEntity.InitByteOffset = ts.InitByteOffset
+		tsEntity.InitByteLength = ts.InitByteLength
+		tsEntity.Codecs = ts.Codecs
+		tsEntity.Keyframes = keyframes
 		tsEntity.CreateTime = timeNow
 		tsEntityList = append(tsEntityList, &tsEntity)
 	}
-
-	// 批量保存到数据库
-	err := v.daoVideoTS.BatchInsert(videoID, tsEntityList)
-	if err != nil {
-		logger.WithContext(v.ctx).Errorf("[VideoTS.BatchCreate] 批量保存TS切片失败: %v", err)
-		return err
-	}
-
-	logger.WithContext(v.ctx).Infof("[VideoTS.BatchCreate] 批量保存TS切片成功, video_id: %s, count: %d", videoID, len(tsList))
-	return nil
+	return tsEntityList, nil
 }
 
 // GetList 获取视频的TS切片列表
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/logger"
+	"github.com/aldge/cine_stream/utils"
+)
+
+const (
+	keyframeScanConcurrency = 4                // 扫描关键帧时并发下载切片的数量
+	keyframeScanTimeout     = 30 * time.Second // 下载单个切片的超时时间
+	keyframeScanMaxSize     = int64(64 << 20)  // 单个切片的大小上限
+	keyframeScanSessionID   = "keyframe_scan"  // 下载切片时 CDN 签名使用的会话
+	keyframeScanMaxJobs     = 2                // 同时扫描关键帧的视频数
+)
+
+var (
+	// keyframeScanClient 扫描关键帧下载切片使用的 http 客户端
+	keyframeScanClient = &http.Client{Timeout: keyframeScanTimeout}
+	// keyframeScanJobs 正在扫描关键帧的视频
+	keyframeScanJobs = make(chan struct{}, keyframeScanMaxJobs)
+)
+
+// encodeKeyframes 校验切片上报的关键帧并编码为 JSON，没有关键帧时返回空字符串
+func encodeKeyframes(ts *entity.VideoTsSaveDataItem, tsSize int64) (string, error) {
+	if len(ts.Keyframes) == 0 {
+		return "", nil
+	}
+	keyframes := make([]entity.VideoTSKeyframe, 0, len(ts.Keyframes))
+	for _, keyframe := range ts.Keyframes {
+		if keyframe.ByteOffset < 0 || keyframe.ByteLength <= 0 {
+			return "", fmt.Errorf("关键帧字节范围不合法, ts_sequence: %d", ts.TSSequence)
+		}
+		if tsSize > 0 && keyframe.ByteOffset+keyframe.ByteLength > tsSize {
+			return "", fmt.Errorf("关键帧字节范围超出切片大小, ts_sequence: %d", ts.TSSequence)
+		}
+		if keyframe.TimeOffset < 0 || keyframe.TimeOffset >= ts.Duration {
+			return "", fmt.Errorf("关键帧时间超出切片时长, ts_sequence: %d", ts.TSSequence)
+		}
+		keyframes = append(keyframes, *keyframe)
+	}
+	data, err := json.Marshal(keyframes)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ScanKeyframes 在后台下载没有上报关键帧的 ts 切片，扫描 random_access_indicator 计算关键帧并更新到切片记录
+// 切片需要已经保存；加密的切片不扫描（下载到的是密文，关键帧的字节范围也无法单独解密）。
+// 不等待扫描完成，同时扫描的视频数不超过 keyframeScanMaxJobs，多出的排队；单个切片扫描失败只记录日志。
+// v 的 ctx 在请求结束后仍会使用，gin 请求需要传入 ctx.Copy()
+func (v *VideoTS) ScanKeyframes(videoID string, tsList []*entity.VideoTsSaveDataItem) {
+	var scanList []*entity.VideoTsSaveDataItem
+	for _, ts := range tsList {
+		if len(ts.Keyframes) > 0 || (ts.Container != "" && ts.Container != entity.VideoTSContainerTS) {
+			continue
+		}
+		scanList = append(scanList, ts)
+	}
+	if len(scanList) == 0 {
+		return
+	}
+	go func() {
+		keyframeScanJobs <- struct{}{}
+		defer func() {
+			<-keyframeScanJobs
+		}()
+		v.scanKeyframes(videoID, scanList)
+	}()
+}
+
+// scanKeyframes 扫描切片的关键帧并更新到切片记录
+func (v *VideoTS) scanKeyframes(videoID string, tsList []*entity.VideoTsSaveDataItem) {
+	encryptList, err := v.daoVideoEncrypt.GetListByVideoID(videoID)
+	if err != nil {
+		logger.WithContext(v.ctx).Errorf("[VideoTS.scanKeyframes] 查询视频加密信息失败: %v, video_id: %s", err, videoID)
+		return
+	}
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		updated int
+	)
+	sem := make(chan struct{}, keyframeScanConcurrency)
+	for _, ts := range tsList {
+		if findSegmentEncrypt(encryptList, ts.Definition, ts.TSSequence) != nil {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(ts *entity.VideoTsSaveDataItem) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			keyframes, err := scanSegmentKeyframes(v.ctx, ts)
+			if err != nil {
+				logger.WithContext(v.ctx).Warnf("[VideoTS.scanKeyframes] 扫描关键帧失败: %v, ts_path: %s", err, ts.TSPath)
+				return
+			}
+			ts.Keyframes = keyframes
+			tsSize := ts.TSSize
+			if tsSize == 0 && ts.ByteLength > 0 {
+				tsSize = ts.ByteLength
+			}
+			data, err := encodeKeyframes(ts, tsSize)
+			if err != nil || data == "" {
+				return
+			}
+			if err = v.daoVideoTS.UpdateKeyframes(videoID, ts.Definition, ts.TSSequence, data); err != nil {
+				logger.WithContext(v.ctx).Errorf("[VideoTS.scanKeyframes] 保存关键帧失败: %v, ts_path: %s", err, ts.TSPath)
+				return
+			}
+			mu.Lock()
+			updated++
+			mu.Unlock()
+		}(ts)
+	}
+	wg.Wait()
+	if updated == 0 {
+		return
+	}
+	invalidatePlaylistCache(v.ctx, videoID)
+	logger.WithContext(v.ctx).Infof("[VideoTS.scanKeyframes] 扫描关键帧完成, video_id: %s, count: %d", videoID, updated)
+}
+
+// scanSegmentKeyframes 下载切片并扫描关键帧
+func scanSegmentKeyframes(ctx context.Context, ts *entity.VideoTsSaveDataItem) ([]*entity.VideoTSKeyframe, error) {
+	segmentURL, err := segmentFetchURL(ctx, ts.TSPath)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, segmentURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if ts.ByteLength > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", ts.ByteOffset, ts.ByteOffset+ts.ByteLength-1))
+	}
+	resp, err := keyframeScanClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("下载切片失败, status: %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, keyframeScanMaxSize))
+	if err != nil {
+		return nil, err
+	}
+	// 源站不支持 Range 时返回整个文件；文件超过下载上限被截断（或比字节范围短）时不能取出切片，不扫描
+	if ts.ByteLength > 0 && resp.StatusCode == http.StatusOK {
+		end := ts.ByteOffset + ts.ByteLength
+		if int64(len(data)) < end {
+			return nil, fmt.Errorf("源站不支持 Range，下载的内容不包含切片的字节范围, size: %d, range_end: %d", len(data), end)
+		}
+		data = data[ts.ByteOffset:end]
+	}
+
+	result, err := utils.ScanTSKeyframes(data)
+	if err != nil {
+		return nil, err
+	}
+	keyframes := make([]*entity.VideoTSKeyframe, 0, len(result.Keyframes))
+	for _, keyframe := range result.Keyframes {
+		timeOffset := result.KeyframeTimeOffset(keyframe)
+		if timeOffset >= ts.Duration {
+			continue
+		}
+		keyframes = append(keyframes, &entity.VideoTSKeyframe{
+			ByteOffset: keyframe.ByteOffset,
+			ByteLength: keyframe.ByteLength,
+			TimeOffset: timeOffset,
+		})
+	}
+	return keyframes, nil
+}
+
+// segmentFetchURL 服务端下载切片的地址，相对路径使用第一个可用的 CDN
+func segmentFetchURL(ctx context.Context, tsPath string) (string, error) {
+	if strings.HasPrefix(tsPath, "http://") || strings.HasPrefix(tsPath, "https://") {
+		return tsPath, nil
+	}
+	candidates := rankCDN(loadCDNCandidates(ctx), "", keyframeScanSessionID)
+	if len(candidates) == 0 {
+		return "", errors.New("没有可用的 CDN")
+	}
+	cdn := candidates[0]
+	return signCDNURL(cdn.conf.URL, strings.TrimPrefix(tsPath, "/"), cdn.conf.Sign, keyframeScanSessionID), nil
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/aldge/cine_stream/app/dao"
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/logger"
+)
+
+const (
+	// watchFinishedRatio 播放位置达到总时长的该比例时视为看完（跳过片尾）
+	watchFinishedRatio = 0.95
+	// watchContinueScanLimit 生成继续观看列表时最多读取的观看记录数
+	watchContinueScanLimit = 200
+)
+
+// ErrWatchProgressInvalid 上报的播放位置或时长不合法
+var ErrWatchProgressInvalid = errors.New("播放位置或时长不合法")
+
+// WatchProgress 观看进度业务逻辑
+type WatchProgress struct {
+	ctx              context.Context
+	daoWatchProgress *dao.WatchProgress
+}
+
+// NewWatchProgress 创建观看进度业务逻辑对象
+func NewWatchProgress(ctx context.Context) *WatchProgress {
+	return &WatchProgress{
+		ctx:              ctx,
+		daoWatchProgress: dao.NewWatchProgress(ctx),
+	}
+}
+
+// Report 保存播放心跳上报的观看进度，播放位置为 0（还没有开始播放）时不保存
+func (w *WatchProgress) Report(userID, videoID string, req *entity.PlayHeartbeatRequest) error {
+	if req.Position < 0 || req.Duration < 0 {
+		return ErrWatchProgressInvalid
+	}
+	if req.Position == 0 {
+		return nil
+	}
+	position := req.Position
+	if req.Duration > 0 && position > req.Duration {
+		position = req.Duration
+	}
+	now := time.Now().Unix()
+	return w.daoWatchProgress.Save(&entity.WatchProgressEntity{
+		UserID:     userID,
+		VideoID:    videoID,
+		VodID:      req.VodID,
+		Position:   position,
+		Duration:   req.Duration,
+		CreateTime: now,
+		UpdateTime: now,
+	})
+}
+
+// Get 查询用户某个视频的观看进度，没有观看记录时播放位置为 0
+func (w *WatchProgress) Get(userID, videoID string) (*entity.WatchProgressItem, error) {
+	progress, err := w.daoWatchProgress.Get(userID, videoID)
+	if errors.Is(err, dao.ErrRecordNotFound) {
+		return &entity.WatchProgressItem{VideoID: videoID}, nil
+	}
+	if err != nil {
+		logger.WithContext(w.ctx).Errorf("[WatchProgress.Get] 查询观看进度失败: %v, user_id: %s, video_id: %s", err, userID, videoID)
+		return nil, errors.New("查询观看进度失败")
+	}
+	return buildWatchProgressItem(progress), nil
+}
+
+// ContinueWatching 用户的继续观看列表，按最后观看时间倒序，最多 limit 条
+// 已看完的视频不在列表中；同一影片（vod_id）的多集只保留最近观看的一集，最近观看的一集已看完时整部影片不在列表中
+func (w *WatchProgress) ContinueWatching(userID string, limit int) ([]*entity.WatchProgressItem, error) {
+	progressList, err := w.daoWatchProgress.GetRecentListByUserID(userID, watchContinueScanLimit)
+	if err != nil {
+		logger.WithContext(w.ctx).Errorf("[WatchProgress.ContinueWatching] 查询观看进度失败: %v, user_id: %s", err, userID)
+		return nil, errors.New("查询观看进度失败")
+	}
+	items := make([]*entity.WatchProgressItem, 0, limit)
+	seenVods := make(map[int64]bool)
+	for i := range progressList {
+		progress := &progressList[i]
+		if progress.VodID > 0 {
+			if seenVods[progress.VodID] {
+				continue
+			}
+			seenVods[progress.VodID] = true
+		}
+		item := buildWatchProgressItem(progress)
+		if item.Finished {
+			continue
+		}
+		items = append(items, item)
+		if len(items) >= limit {
+			break
+		}
+	}
+	return items, nil
+}
+
+// buildWatchProgressItem 计算完成百分比和是否看完
+func buildWatchProgressItem(progress *entity.WatchProgressEntity) *entity.WatchProgressItem {
+	item := &entity.WatchProgressItem{
+		VideoID:    progress.VideoID,
+		VodID:      progress.VodID,
+		Position:   progress.Position,
+		Duration:   progress.Duration,
+		UpdateTime: progress.UpdateTime,
+	}
+	if progress.Duration > 0 {
+		item.Percent = math.Min(math.Round(progress.Position/progress.Duration*1000)/10, 100)
+		item.Finished = progress.Position >= progress.Duration*watchFinishedRatio
+	}
+	return item
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aldge/cine_stream/app/dao"
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/config"
+	"github.com/aldge/cine_stream/logger"
+	"github.com/aldge/gopkg/app"
+	"github.com/gin-gonic/gin"
+)
+
+// watermarkCodeBits 水印码的位数，切片序号按 64 取模对应水印码的一位，每 64 个切片重复一次
+const watermarkCodeBits = 64
+
+var (
+	// ErrWatermarkIncomplete 识别出的切片没有覆盖水印码的所有位，或某一位 A/B 票数相同
+	ErrWatermarkIncomplete = errors.New("识别出的切片不足，无法解码水印")
+	// ErrWatermarkUserNotFound 解码出的水印码没有对应的用户
+	ErrWatermarkUserNotFound = errors.New("没有匹配的用户")
+)
+
+// watermarkRegistered 已保存水印码的用户（app:user_id），避免每次生成播放列表都写数据库
+var watermarkRegistered sync.Map
+
+// Watermark A/B 切片水印业务逻辑
+// 每个用户有一个 64 位的水印码，播放列表中序号为 n 的切片在水印码第 n%64 位为 1 时使用 B 版本，否则使用 A 版本
+type Watermark struct {
+	ctx              context.Context
+	daoWatermarkUser *dao.WatermarkUser
+}
+
+// NewWatermark 创建 A/B 切片水印业务逻辑对象
+func NewWatermark(ctx context.Context) *Watermark {
+	return &Watermark{
+		ctx:              ctx,
+		daoWatermarkUser: dao.NewWatermarkUser(ctx),
+	}
+}
+
+// watermarkCode 用户的水印码：HMAC-SHA256(secret, user_id) 的前 8 字节
+// 水印码是随机的，识别错误的少量切片不会恰好得到另一个用户的水印码
+func watermarkCode(secret, userID string) uint64 {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("cine-watermark:" + userID))
+	return binary.BigEndian.Uint64(mac.Sum(nil))
+}
+
+// watermarkVariantB 序号为 sequence 的切片是否使用 B 版本
+func watermarkVariantB(code uint64, sequence int64) bool {
+	return code>>(uint64(sequence)%watermarkCodeBits)&1 == 1
+}
+
+// UserCode 获取当前登录用户的水印码，第一次使用时保存用于解码
+// 没有开启水印、没有登录或保存失败时返回 false，播放列表只使用 A 版本
+func (w *Watermark) UserCode(ctx *gin.Context) (uint64, bool) {
+	return w.userCode(ctx, entity.ContextValueLoginUserID(ctx))
+}
+
+// KeyTokenUserCode 获取播放密钥 token 所属用户的水印码，token 为空时使用当前登录用户
+// 切片代理按 token 的用户选择 A/B 版本，不信任客户端传的版本
+func (w *Watermark) KeyTokenUserCode(ctx *gin.Context, token string) (uint64, bool) {
+	if token == "" {
+		return w.UserCode(ctx)
+	}
+	return w.userCode(ctx, PlayKeyTokenUserID(token))
+}
+
+// userCode 获取用户的水印码，第一次使用时保存用于解码
+func (w *Watermark) userCode(ctx *gin.Context, userID string) (uint64, bool) {
+	appName := string(app.GetAppName(ctx))
+	if !config.GetAppConf().GetWatermarkConf(appName).Enabled {
+		return 0, false
+	}
+	secret := config.GetAppConf().Watermark.Secret
+	if secret == "" {
+		logger.WithContext(ctx).Warnf("[Watermark.UserCode] 没有配置水印密钥, app: %s", appName)
+		return 0, false
+	}
+	if userID == "" {
+		return 0, false
+	}
+
+	code := watermarkCode(secret, userID)
+	registeredKey := appName + ":" + userID
+	if _, ok := watermarkRegistered.Load(registeredKey); ok {
+		return code, true
+	}
+	err := w.daoWatermarkUser.Save(&entity.WatermarkUserEntity{
+		UserID:     userID,
+		Code:       code,
+		CreateTime: time.Now().Unix(),
+	})
+	if err != nil {
+		// 没有保存的水印码无法解码，不输出水印
+		logger.WithContext(ctx).Errorf("[Watermark.UserCode] 保存用户水印码失败: %v, user_id: %s", err, userID)
+		return 0, false
+	}
+	watermarkRegistered.Store(registeredKey, struct{}{})
+	return code, true
+}
+
+// Decode 从泄露视频中识别出的 A/B 序列解码水印码并查询用户
+// 每一位按对应切片的多数票决定，识别出的切片需要覆盖水印码的所有位（至少连续 64 个切片）
+func (w *Watermark) Decode(req *entity.WatermarkDecodeRequest) (*entity.WatermarkDecodeResult, error) {
+	if req.StartSequence < 0 {
+		return nil, errors.New("起始序号不能为负数")
+	}
+	var votes [watermarkCodeBits][2]int
+	observed := 0
+	for i := 0; i < len(req.Variants); i++ {
+		bit := (req.StartSequence + int64(i)) % watermarkCodeBits
+		switch req.Variants[i] {
+		case 'A', 'a':
+			votes[bit][0]++
+		case 'B', 'b':
+			votes[bit][1]++
+		default:
+			continue
+		}
+		observed++
+	}
+
+	var code uint64
+	conflicts := 0
+	for bit, vote := range votes {
+		if vote[0] == vote[1] {
+			return nil, fmt.Errorf("%w: 第 %d 位（序号按 64 取模）没有识别结果或 A/B 票数相同", ErrWatermarkIncomplete, bit)
+		}
+		if vote[1] > vote[0] {
+			code |= 1 << uint(bit)
+			conflicts += vote[0]
+		} else {
+			conflicts += vote[1]
+		}
+	}
+
+	user, err := w.daoWatermarkUser.GetByCode(code)
+	if errors.Is(err, dao.ErrRecordNotFound) {
+		return nil, ErrWatermarkUserNotFound
+	}
+	if err != nil {
+		logger.WithContext(w.ctx).Errorf("[Watermark.Decode] 查询水印用户失败: %v", err)
+		return nil, errors.New("查询水印用户失败")
+	}
+	return &entity.WatermarkDecodeResult{
+		UserID:    user.UserID,
+		Code:      fmt.Sprintf("%016x", code),
+		Observed:  observed,
+		Conflicts: conflicts,
+	}, nil
+}
@@ -0,0 +1,200 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aldge/cine_stream/app/dao"
+	"github.com/aldge/cine_stream/app/entity"
+	"github.com/aldge/cine_stream/config"
+	"github.com/aldge/cine_stream/logger"
+)
+
+// qoeMaxPendingStats 写入数据库失败时最多保留等待重试的汇总行数，超过时丢弃，避免数据库长时间不可用时占用过多内存
+const qoeMaxPendingStats = 100000
+
+// qoeStatKey 汇总的维度：时间段、app、视频、CDN
+type qoeStatKey struct {
+	bucketTime int64
+	app        string
+	videoID    string
+	cdn        string
+}
+
+// qoeAggregator 播放质量汇总任务
+// 上报的事件写入队列，由一个协程按维度累加，每隔 FlushSeconds 把累加结果交给写入协程后重新累加，
+// 写入数据库不阻塞汇总；进程退出时没有写入的汇总结果会丢失（最多 FlushSeconds 秒的数据）
+type qoeAggregator struct {
+	events        chan entity.QoEEvent
+	bucketSeconds int64
+	flushInterval time.Duration
+	stats         map[qoeStatKey]*entity.QoEStatEntity
+	flushes       chan map[qoeStatKey]*entity.QoEStatEntity // 等待写入的汇总结果，写入协程同时只处理一批
+	pending       map[qoeStatKey]*entity.QoEStatEntity      // 写入失败等待重试的汇总结果，只在写入协程中使用
+}
+
+var (
+	qoeOnce sync.Once
+	qoe     *qoeAggregator
+)
+
+// StartQoE 启动播放质量汇总任务，没有开启播放质量上报时不启动
+func StartQoE() {
+	conf := config.GetAppConf().GetQoEConf()
+	if !conf.Enabled {
+		return
+	}
+	qoeOnce.Do(func() {
+		qoe = &qoeAggregator{
+			events:        make(chan entity.QoEEvent, conf.QueueSize),
+			bucketSeconds: int64(conf.BucketSeconds),
+			flushInterval: time.Duration(conf.FlushSeconds) * time.Second,
+			stats:         make(map[qoeStatKey]*entity.QoEStatEntity),
+			flushes:       make(chan map[qoeStatKey]*entity.QoEStatEntity),
+			pending:       make(map[qoeStatKey]*entity.QoEStatEntity),
+		}
+		go qoe.run()
+		go qoe.runFlush()
+		logger.Infof("[StartQoE] 播放质量汇总任务已启动, bucket_seconds: %d, flush_seconds: %d", conf.BucketSeconds, conf.FlushSeconds)
+	})
+}
+
+// SubmitQoEEvents 提交播放质量事件等待汇总，不阻塞请求
+// 汇总任务没有启动或队列已满时丢弃事件并返回 false
+func SubmitQoEEvents(events []entity.QoEEvent) bool {
+	if qoe == nil {
+		return false
+	}
+	for i := range events {
+		select {
+		case qoe.events <- events[i]:
+		default:
+			logger.Warnf("[SubmitQoEEvents] 播放质量事件队列已满，丢弃 %d 个事件", len(events)-i)
+			return false
+		}
+	}
+	return true
+}
+
+// run 汇总事件，定时把汇总结果交给写入协程（没有新结果时也交，写入协程重试上次失败的行）
+// 写入协程还在写入上一批时不等待，继续累加到下一个周期
+func (a *qoeAggregator) run() {
+	ticker := time.NewTicker(a.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case event := <-a.events:
+			a.add(&event)
+		case <-ticker.C:
+			select {
+			case a.flushes <- a.stats:
+				a.stats = make(map[qoeStatKey]*entity.QoEStatEntity)
+			default:
+			}
+		}
+	}
+}
+
+// runFlush 写入协程，把交来的汇总结果和上次失败的结果一起写入数据库
+func (a *qoeAggregator) runFlush() {
+	for stats := range a.flushes {
+		for key, stat := range stats {
+			if pending, ok := a.pending[key]; ok {
+				mergeQoEStat(pending, stat)
+			} else {
+				a.pending[key] = stat
+			}
+		}
+		a.flush()
+	}
+}
+
+// add 把事件累加到所在时间段的汇总结果
+func (a *qoeAggregator) add(event *entity.QoEEvent) {
+	key := qoeStatKey{
+		bucketTime: event.Time - event.Time%a.bucketSeconds,
+		app:        event.App,
+		videoID:    event.VideoID,
+		cdn:        event.CDN,
+	}
+	stat, ok := a.stats[key]
+	if !ok {
+		stat = &entity.QoEStatEntity{
+			BucketTime: key.bucketTime,
+			App:        key.app,
+			VideoID:    key.videoID,
+			CDN:        key.cdn,
+		}
+		a.stats[key] = stat
+	}
+
+	switch event.Type {
+	case entity.QoEEventStartup:
+		stat.Plays++
+		stat.StartupMsTotal += event.Value
+		if event.Value > stat.StartupMsMax {
+			stat.StartupMsMax = event.Value
+		}
+		if event.Bitrate > 0 {
+			stat.BitrateTotal += event.Bitrate
+			stat.BitrateSamples++
+		}
+	case entity.QoEEventRebuffer:
+		stat.Rebuffers++
+		stat.RebufferMsTotal += event.Value
+	case entity.QoEEventWatch:
+		stat.WatchMsTotal += event.Value
+	case entity.QoEEventBitrateSwitch:
+		stat.BitrateSwitches++
+		stat.BitrateTotal += event.Value
+		stat.BitrateSamples++
+	case entity.QoEEventError:
+		stat.Errors++
+	}
+}
+
+// flush 按 app 批量把汇总结果累加到数据库
+// 写入失败的 app 的行保留到下次重试，写入成功的行删除
+func (a *qoeAggregator) flush() {
+	now := time.Now().Unix()
+	appStats := make(map[string][]*entity.QoEStatEntity)
+	for _, stat := range a.pending {
+		stat.UpdateTime = now
+		appStats[stat.App] = append(appStats[stat.App], stat)
+	}
+	failed := 0
+	var lastErr error
+	for appName, stats := range appStats {
+		if err := dao.NewQoEStat(context.Background(), appName).BatchIncrement(stats); err != nil {
+			failed += len(stats)
+			lastErr = err
+			continue
+		}
+		for _, stat := range stats {
+			delete(a.pending, qoeStatKey{bucketTime: stat.BucketTime, app: stat.App, videoID: stat.VideoID, cdn: stat.CDN})
+		}
+	}
+	if failed == 0 {
+		return
+	}
+	logger.Errorf("[qoeAggregator.flush] 写入播放质量汇总失败: %v, 失败行数: %d", lastErr, failed)
+	if len(a.pending) > qoeMaxPendingStats {
+		logger.Errorf("[qoeAggregator.flush] 等待重试的汇总行数超过 %d，丢弃 %d 行", qoeMaxPendingStats, len(a.pending))
+		a.pending = make(map[qoeStatKey]*entity.QoEStatEntity)
+	}
+}
+
+// mergeQoEStat 把 src 的计数累加到 dst，最长起播耗时取较大值
+func mergeQoEStat(dst, src *entity.QoEStatEntity) {
+	dst.Plays += src.Plays
+	dst.StartupMsTotal += src.StartupMsTotal
+	dst.StartupMsMax = max(dst.StartupMsMax, src.StartupMsMax)
+	dst.Rebuffers += src.Rebuffers
+	dst.RebufferMsTotal += src.RebufferMsTotal
+	dst.WatchMsTotal += src.WatchMsTotal
+	dst.BitrateSwitches += src.BitrateSwitches
+	dst.BitrateTotal += src.BitrateTotal
+	dst.BitrateSamples += src.BitrateSamples
+	dst.Errors += src.Errors
+}
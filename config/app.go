@@ -1,9 +1,13 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/aldge/cine_stream/cmd"
@@ -16,6 +20,9 @@ var (
 	appConfig *AppConfig
 )
 
+// EnvProd 生产环境（Global.env）
+const EnvProd = "prod"
+
 // AppConfig 配置数据结构
 type AppConfig struct {
 	// Global 全局配置
@@ -34,6 +41,32 @@ type AppConfig struct {
 	Database map[string]DatabaseConf `yaml:"Database"`
 	// CDN 配置
 	CDN map[string]CDNConf `yaml:"CDN"`
+	// CDNRoute CDN 调度配置
+	CDNRoute CDNRouteConf `yaml:"CDNRoute"`
+	// Definition 清晰度配置（主 m3u8 的码率、分辨率、编码）
+	Definition map[string]DefinitionConf `yaml:"Definition"`
+	// Subtitle 字幕转换配置
+	Subtitle SubtitleConf `yaml:"Subtitle"`
+	// Trial 试看配置
+	Trial TrialConf `yaml:"Trial"`
+	// Ad 服务端插入广告配置
+	Ad AdConf `yaml:"Ad"`
+	// C3u8 cine 播放器私有协议配置
+	C3u8 C3u8Conf `yaml:"C3u8"`
+	// Redis 配置，地址为空时不使用 Redis
+	Redis RedisConf `yaml:"Redis"`
+	// PlaylistCache 播放列表缓存配置
+	PlaylistCache PlaylistCacheConf `yaml:"PlaylistCache"`
+	// SegmentProxy 切片代理配置
+	SegmentProxy SegmentProxyConf `yaml:"SegmentProxy"`
+	// Watermark A/B 切片水印配置
+	Watermark WatermarkConf `yaml:"Watermark"`
+	// PlaySession 同时播放设备数限制配置
+	PlaySession PlaySessionConf `yaml:"PlaySession"`
+	// QoE 播放质量上报配置
+	QoE QoEConf `yaml:"QoE"`
+	// HTTPCache 播放接口的 HTTP 缓存策略，key 为接口名（见 HTTPCacheXxx），没有配置的接口使用内置策略
+	HTTPCache map[string]HTTPCachePolicy `yaml:"HTTPCache"`
 	// Logger 日志配置
 	Logger map[string]klog.Config `yaml:"Logger"`
 	// Auth 登录认证配置
@@ -66,6 +99,13 @@ type AuthConf struct {
 	JwtSecret   string       `yaml:"jwt_secret"`   // jwt 密匙
 	ExpireHours int          `yaml:"expire_hours"` // 过期时间小时
 	Passport    PassportConf `yaml:"passport"`     // Passport 配置
+	KeyToken    KeyTokenConf `yaml:"key_token"`    // 播放密钥 URL 签名配置
+}
+
+// KeyTokenConf 播放密钥 URL 签名配置
+type KeyTokenConf struct {
+	Secret        string `yaml:"secret"`         // HMAC 签名密钥，生产环境必须配置且不能与 jwt_secret 相同
+	ExpireSeconds int    `yaml:"expire_seconds"` // 有效期（秒），默认 10 分钟，播放器通过心跳刷新
 }
 
 // PassportConf Passport 配置
@@ -81,7 +121,230 @@ type PassportConf struct {
 
 // CDNConf CDN 配置
 type CDNConf struct {
-	URL string `yaml:"url"` // CDN URL
+	URL     string      `yaml:"url"`     // CDN URL
+	Weight  int         `yaml:"weight"`  // 权重，默认 1
+	Regions []string    `yaml:"regions"` // 服务的地域，为空表示服务所有地域
+	Status  string      `yaml:"status"`  // 健康状态：up | down，默认 up
+	Sign    CDNSignConf `yaml:"sign"`    // URL 鉴权签名配置
+}
+
+// CDN 健康状态
+const (
+	CDNStatusUp   = "up"   // 正常
+	CDNStatusDown = "down" // 下线，不再分配流量
+)
+
+// CDNRouteConf CDN 调度配置
+type CDNRouteConf struct {
+	RegionHeader string            `yaml:"region_header"` // 客户端地域请求头，默认 X-Client-Region
+	IPRegions    []CDNIPRegionConf `yaml:"ip_regions"`    // 请求头没有地域时按客户端 IP 段匹配
+}
+
+// CDNIPRegionConf IP 段对应的地域
+type CDNIPRegionConf struct {
+	CIDR   string `yaml:"cidr"`   // IP 段，如 10.0.0.0/8
+	Region string `yaml:"region"` // 地域
+}
+
+// CDN URL 签名方式
+const (
+	CDNSignTypeNone          = ""               // 不签名
+	CDNSignTypeQueryToken    = "query_token"    // ?auth_key={expire}-{rand}-{uid}-{md5}
+	CDNSignTypePathTimestamp = "path_timestamp" // /{md5}/{expire_hex}/path
+	CDNSignTypeHMAC          = "hmac"           // ?expires=&session=&signature=hmac(path:expires:session)
+)
+
+// CDNSignConf CDN URL 签名配置
+type CDNSignConf struct {
+	Type          string `yaml:"type"`           // 签名方式：query_token | path_timestamp | hmac，为空不签名
+	Secret        string `yaml:"secret"`         // 签名密钥
+	ExpireSeconds int    `yaml:"expire_seconds"` // 有效期（秒），默认 4 小时
+	Algorithm     string `yaml:"algorithm"`      // hmac 方式的算法：sha256 | sha1 | md5，默认 sha256
+}
+
+// DefinitionConf 清晰度配置
+type DefinitionConf struct {
+	Bandwidth  int64  `yaml:"bandwidth"`  // 峰值码率 bit/s，切片没有上报大小时使用
+	Resolution string `yaml:"resolution"` // 分辨率，如 1920x1080
+	Codecs     string `yaml:"codecs"`     // 编码，如 avc1.640028,mp4a.40.2
+}
+
+// SubtitleConf 字幕转换配置
+type SubtitleConf struct {
+	// TimestampMPEGTS WebVTT 切片 X-TIMESTAMP-MAP 的 MPEGTS 值（90kHz），需与 TS 切片的起始 PTS 一致，默认 900000（10 秒）
+	TimestampMPEGTS int64 `yaml:"timestamp_mpegts"`
+	// MaxUploadSize 字幕文件大小上限（字节），默认 10MB
+	MaxUploadSize int64 `yaml:"max_upload_size"`
+}
+
+// TrialConf 试看配置，没有播放权限的用户播放试看内容而不是返回 403
+type TrialConf struct {
+	TrialAppConf `yaml:",inline"`
+	// Apps 按 app 覆盖默认配置
+	Apps map[string]TrialAppConf `yaml:"apps"`
+}
+
+// TrialAppConf 单个 app 的试看配置
+type TrialAppConf struct {
+	Enabled bool `yaml:"enabled"` // 是否开启试看
+	Minutes int  `yaml:"minutes"` // 试看分钟数，0 表示只允许 vod_trysee 内的剧集整集试看
+}
+
+// C3u8Conf cine 播放器私有协议配置
+type C3u8Conf struct {
+	C3u8AppConf `yaml:",inline"`
+	// Apps 按 app 覆盖默认配置
+	Apps map[string]C3u8AppConf `yaml:"apps"`
+}
+
+// C3u8AppConf 单个 app 的 c3u8 协议配置
+type C3u8AppConf struct {
+	// Legacy 是否允许 v1 协议（固定密钥和 nonce），只在旧版播放器迁移期间开启
+	Legacy bool `yaml:"legacy"`
+}
+
+// AdConf 服务端插入广告配置
+type AdConf struct {
+	AdAppConf `yaml:",inline"`
+	// Apps 按 app 覆盖默认配置
+	Apps map[string]AdAppConf `yaml:"apps"`
+}
+
+// AdAppConf 单个 app 的广告配置
+type AdAppConf struct {
+	Enabled  bool    `yaml:"enabled"`   // 是否插入广告
+	PreRoll  bool    `yaml:"pre_roll"`  // 片头广告
+	PostRoll bool    `yaml:"post_roll"` // 片尾广告
+	MidRolls []int64 `yaml:"mid_rolls"` // 中插广告位，正片中的时间(秒)，在该时间之后的第一个切片前插入
+	// Static 静态广告决策：广告位（pre | mid | post）对应的广告组 ID
+	Static map[string][]uint64 `yaml:"static"`
+}
+
+// RedisConf Redis 配置
+type RedisConf struct {
+	Addr     string `yaml:"addr"`     // 地址 host:port，为空时不使用 Redis
+	Password string `yaml:"password"` // 密码
+	DB       int    `yaml:"db"`       // 数据库编号
+}
+
+// PlaylistCacheConf 播放列表缓存配置，缓存生成媒体 m3u8 需要的切片和加密信息
+type PlaylistCacheConf struct {
+	Enabled    bool `yaml:"enabled"`     // 是否开启缓存
+	LRUSize    int  `yaml:"lru_size"`    // 进程内 LRU 缓存的条目数，默认 1024
+	TTLSeconds int  `yaml:"ttl_seconds"` // 缓存有效期（秒），默认 300
+	UseRedis   bool `yaml:"use_redis"`   // 是否使用 Redis 作为二级缓存（多实例共享缓存和失效）
+}
+
+// SegmentProxyConf 切片代理配置，开启代理的 app 播放列表中的切片地址指向 /play/:video_id/seg/:seq，由服务端回源
+type SegmentProxyConf struct {
+	SegmentProxyAppConf `yaml:",inline"`
+	// Apps 按 app 覆盖默认配置
+	Apps map[string]SegmentProxyAppConf `yaml:"apps"`
+
+	MaxConcurrency     int    `yaml:"max_concurrency"`        // 同时回源的请求数，默认 64
+	MaxStreams         int    `yaml:"max_streams"`            // 同时透传的源站响应数，默认 512，超过时等待 queue_timeout_ms 后返回 503
+	QueueTimeoutMs     int    `yaml:"queue_timeout_ms"`       // 等待回源名额的最长时间（毫秒），默认 3000，超时返回 503
+	TimeoutSeconds     int    `yaml:"timeout_seconds"`        // 回源连接、等待响应头和透传时两次读取之间的超时时间（秒），写入磁盘缓存的回源含读取内容，默认 30
+	CacheDir           string `yaml:"cache_dir"`              // 磁盘缓存目录，为空时不缓存
+	CacheMaxMB         int64  `yaml:"cache_max_mb"`           // 磁盘缓存总大小（MB），默认 10240，超过时淘汰最久未使用的切片
+	CacheMaxFileSizeMB int64  `yaml:"cache_max_file_size_mb"` // 单个切片文件的最大缓存大小（MB），默认 32
+}
+
+// SegmentProxyAppConf 单个 app 的切片代理配置
+type SegmentProxyAppConf struct {
+	Enabled bool   `yaml:"enabled"` // 是否开启切片代理
+	Origin  string `yaml:"origin"`  // 源站地址（如私有存储桶的内网地址），为空时使用 CDN 配置回源
+	// Headers 回源请求头，如私有存储的认证信息
+	Headers map[string]string `yaml:"headers"`
+}
+
+// WatermarkConf A/B 切片水印配置，开启的 app 按用户的水印码为每个切片位置选择 A 或 B 版本
+type WatermarkConf struct {
+	WatermarkAppConf `yaml:",inline"`
+	// Apps 按 app 覆盖默认配置
+	Apps map[string]WatermarkAppConf `yaml:"apps"`
+	// Secret 生成用户水印码的 HMAC 密钥，修改后已分发的视频无法解码，不能修改
+	Secret string `yaml:"secret"`
+}
+
+// WatermarkAppConf 单个 app 的 A/B 切片水印配置
+type WatermarkAppConf struct {
+	Enabled bool `yaml:"enabled"` // 是否开启 A/B 水印（只作用于有 B 版本的切片）
+}
+
+// PlaySessionConf 同时播放设备数限制配置
+// 播放列表和密钥请求为 (用户, 设备) 登记或续期播放会话，会话超过 TTL 没有续期时过期；
+// 用户同时播放的设备数达到上限后，新设备的播放请求被拒绝
+type PlaySessionConf struct {
+	PlaySessionAppConf `yaml:",inline"`
+	// Apps 按 app 覆盖默认配置
+	Apps map[string]PlaySessionAppConf `yaml:"apps"`
+
+	TTLSeconds int  `yaml:"ttl_seconds"` // 播放会话没有心跳后的过期时间（秒），默认 120
+	UseRedis   bool `yaml:"use_redis"`   // 是否使用 Redis 保存播放会话（多实例部署时开启），否则保存在本机内存
+}
+
+// PlaySessionAppConf 单个 app 的同时播放设备数限制
+type PlaySessionAppConf struct {
+	MaxStreams int `yaml:"max_streams"` // 每个用户同时播放的设备数，0 表示不限制
+	// Plans 按套餐覆盖 MaxStreams，key 为登录 token 中用户的 tag（套餐）
+	Plans map[string]int `yaml:"plans"`
+}
+
+// QoEConf 播放质量上报配置，播放器上报的事件按时间段、视频、CDN 汇总后写入数据库
+type QoEConf struct {
+	Enabled       bool `yaml:"enabled"`        // 是否接收播放质量上报
+	BucketSeconds int  `yaml:"bucket_seconds"` // 汇总的时间段长度（秒），默认 300
+	FlushSeconds  int  `yaml:"flush_seconds"`  // 汇总结果写入数据库的间隔（秒），默认 30
+	QueueSize     int  `yaml:"queue_size"`     // 等待汇总的事件队列长度，默认 10000，队列满时丢弃新的上报
+}
+
+// 播放接口名，用于 HTTP 缓存策略配置
+const (
+	HTTPCacheMaster          = "master"           // 主 m3u8
+	HTTPCacheMedia           = "media"            // 媒体 m3u8
+	HTTPCacheC3u8            = "c3u8"             // cine 播放器私有协议
+	HTTPCacheIFrame          = "iframe"           // I-frame m3u8
+	HTTPCacheDash            = "dash"             // DASH mpd
+	HTTPCacheSubtitle        = "subtitle"         // 字幕 m3u8
+	HTTPCacheSubtitleSegment = "subtitle_segment" // 字幕切片
+	HTTPCacheThumbnail       = "thumbnail"        // 缩略图 WebVTT
+	HTTPCacheKey             = "key"              // 加密密钥
+	HTTPCacheSegment         = "segment"          // 代理的切片
+)
+
+// HTTPCachePolicy 播放接口的 HTTP 缓存策略
+// 播放接口都需要播放权限，响应中带有用户的密钥 token 和 CDN 签名，始终输出 private，只允许客户端缓存
+type HTTPCachePolicy struct {
+	MaxAge               int  `yaml:"max_age"`                // 客户端缓存时间（秒），为 0 时每次都需要重新验证（no-cache）
+	StaleWhileRevalidate int  `yaml:"stale_while_revalidate"` // 过期后重新验证期间可以继续使用旧内容的时间（秒）
+	NoStore              bool `yaml:"no_store"`               // 不允许缓存，不输出 ETag 和 Last-Modified，也不处理条件请求
+}
+
+// defaultHTTPCachePolicy 内置的播放接口缓存策略，可被配置文件覆盖
+// 直播的媒体 m3u8 每个切片时长刷新一次，缓存时间不能超过切片时长的一半
+var defaultHTTPCachePolicy = map[string]HTTPCachePolicy{
+	HTTPCacheMaster:          {MaxAge: 30},
+	HTTPCacheMedia:           {MaxAge: 1},
+	HTTPCacheC3u8:            {MaxAge: 1},
+	HTTPCacheIFrame:          {MaxAge: 30},
+	HTTPCacheDash:            {MaxAge: 10},
+	HTTPCacheSubtitle:        {MaxAge: 30},
+	HTTPCacheSubtitleSegment: {MaxAge: 3600},
+	HTTPCacheThumbnail:       {MaxAge: 60},
+	HTTPCacheKey:             {},
+	HTTPCacheSegment:         {MaxAge: 3600},
+}
+
+// defaultDefinitionConf 内置的常用清晰度配置，可被配置文件覆盖
+var defaultDefinitionConf = map[string]DefinitionConf{
+	"2160p": {Bandwidth: 16000000, Resolution: "3840x2160", Codecs: "avc1.640033,mp4a.40.2"},
+	"1440p": {Bandwidth: 9000000, Resolution: "2560x1440", Codecs: "avc1.640032,mp4a.40.2"},
+	"1080p": {Bandwidth: 4096000, Resolution: "1920x1080", Codecs: "avc1.640028,mp4a.40.2"},
+	"720p":  {Bandwidth: 2560000, Resolution: "1280x720", Codecs: "avc1.64001f,mp4a.40.2"},
+	"480p":  {Bandwidth: 1200000, Resolution: "854x480", Codecs: "avc1.4d401e,mp4a.40.2"},
+	"360p":  {Bandwidth: 800000, Resolution: "640x360", Codecs: "avc1.4d401e,mp4a.40.2"},
+	"240p":  {Bandwidth: 400000, Resolution: "426x240", Codecs: "avc1.42c015,mp4a.40.2"},
 }
 
 // getAppConfigPath 获取服务启动配置文件路径
@@ -115,6 +378,22 @@ func initAppConfig() {
 
 // CorrectConfig 修正配置
 func CorrectConfig(config *AppConfig) error {
+	// 播放密钥 token 的签名密钥不能使用登录 jwt 密钥（默认值写在代码和配置中）
+	keyToken := &config.Auth.KeyToken
+	if keyToken.Secret != "" && keyToken.Secret == config.Auth.JwtSecret {
+		return errors.New("Auth.key_token.secret 不能与 Auth.jwt_secret 相同")
+	}
+	if keyToken.Secret == "" {
+		if config.Global.Env == EnvProd {
+			return errors.New("生产环境必须配置 Auth.key_token.secret")
+		}
+		// 非生产环境没有配置时使用随机密钥，重启后之前签发的 token 失效
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		keyToken.Secret = hex.EncodeToString(secret)
+	}
 	return nil
 }
 
@@ -220,6 +499,10 @@ func (ac *AppConfig) GetAuthConf() AuthConf {
 	if ac.Auth.ExpireHours == 0 {
 		ac.Auth.ExpireHours = 3
 	}
+	// 密钥地址泄露后可用的时间尽量短，播放过程中播放器通过心跳换取新 token
+	if ac.Auth.KeyToken.ExpireSeconds <= 0 {
+		ac.Auth.KeyToken.ExpireSeconds = 600
+	}
 	return ac.Auth
 }
 
@@ -232,3 +515,174 @@ func (ac *AppConfig) GetPassportConf() PassportConf {
 func (ac *AppConfig) GetCDNConf() map[string]CDNConf {
 	return ac.CDN
 }
+
+// GetCDNRouteConf 获取 CDN 调度配置
+func (ac *AppConfig) GetCDNRouteConf() CDNRouteConf {
+	if ac.CDNRoute.RegionHeader == "" {
+		ac.CDNRoute.RegionHeader = "X-Client-Region"
+	}
+	return ac.CDNRoute
+}
+
+// GetExpireSeconds 获取 CDN URL 签名有效期
+func (sc CDNSignConf) GetExpireSeconds() int {
+	// 切片在播放过程中才会请求，有效期需要覆盖一部影片的时长
+	if sc.ExpireSeconds <= 0 {
+		return 4 * 3600
+	}
+	return sc.ExpireSeconds
+}
+
+// GetSubtitleConf 获取字幕转换配置
+func (ac *AppConfig) GetSubtitleConf() SubtitleConf {
+	if ac.Subtitle.TimestampMPEGTS <= 0 {
+		ac.Subtitle.TimestampMPEGTS = 900000
+	}
+	if ac.Subtitle.MaxUploadSize <= 0 {
+		ac.Subtitle.MaxUploadSize = 10 << 20
+	}
+	return ac.Subtitle
+}
+
+// GetTrialConf 获取 app 的试看配置，app 没有单独配置时使用默认配置
+func (ac *AppConfig) GetTrialConf(appName string) TrialAppConf {
+	if conf, ok := ac.Trial.Apps[appName]; ok {
+		return conf
+	}
+	return ac.Trial.TrialAppConf
+}
+
+// GetC3u8Conf 获取 app 的 c3u8 协议配置，app 没有单独配置时使用默认配置
+func (ac *AppConfig) GetC3u8Conf(appName string) C3u8AppConf {
+	if conf, ok := ac.C3u8.Apps[appName]; ok {
+		return conf
+	}
+	return ac.C3u8.C3u8AppConf
+}
+
+// GetAdConf 获取 app 的广告配置，app 没有单独配置时使用默认配置
+func (ac *AppConfig) GetAdConf(appName string) AdAppConf {
+	if conf, ok := ac.Ad.Apps[appName]; ok {
+		return conf
+	}
+	return ac.Ad.AdAppConf
+}
+
+// GetPlaylistCacheConf 获取播放列表缓存配置
+func (ac *AppConfig) GetPlaylistCacheConf() PlaylistCacheConf {
+	if ac.PlaylistCache.LRUSize <= 0 {
+		ac.PlaylistCache.LRUSize = 1024
+	}
+	if ac.PlaylistCache.TTLSeconds <= 0 {
+		ac.PlaylistCache.TTLSeconds = 300
+	}
+	return ac.PlaylistCache
+}
+
+// GetSegmentProxyConf 获取切片代理配置
+func (ac *AppConfig) GetSegmentProxyConf() SegmentProxyConf {
+	if ac.SegmentProxy.MaxConcurrency <= 0 {
+		ac.SegmentProxy.MaxConcurrency = 64
+	}
+	if ac.SegmentProxy.MaxStreams <= 0 {
+		ac.SegmentProxy.MaxStreams = 512
+	}
+	if ac.SegmentProxy.QueueTimeoutMs <= 0 {
+		ac.SegmentProxy.QueueTimeoutMs = 3000
+	}
+	if ac.SegmentProxy.TimeoutSeconds <= 0 {
+		ac.SegmentProxy.TimeoutSeconds = 30
+	}
+	if ac.SegmentProxy.CacheMaxMB <= 0 {
+		ac.SegmentProxy.CacheMaxMB = 10240
+	}
+	if ac.SegmentProxy.CacheMaxFileSizeMB <= 0 {
+		ac.SegmentProxy.CacheMaxFileSizeMB = 32
+	}
+	return ac.SegmentProxy
+}
+
+// GetSegmentProxyAppConf 获取 app 的切片代理配置，app 没有单独配置时使用默认配置
+func (ac *AppConfig) GetSegmentProxyAppConf(appName string) SegmentProxyAppConf {
+	if conf, ok := ac.SegmentProxy.Apps[appName]; ok {
+		return conf
+	}
+	return ac.SegmentProxy.SegmentProxyAppConf
+}
+
+// GetWatermarkConf 获取 app 的 A/B 切片水印配置，app 没有单独配置时使用默认配置
+func (ac *AppConfig) GetWatermarkConf(appName string) WatermarkAppConf {
+	if conf, ok := ac.Watermark.Apps[appName]; ok {
+		return conf
+	}
+	return ac.Watermark.WatermarkAppConf
+}
+
+// GetPlaySessionConf 获取同时播放设备数限制配置
+func (ac *AppConfig) GetPlaySessionConf() PlaySessionConf {
+	if ac.PlaySession.TTLSeconds <= 0 {
+		ac.PlaySession.TTLSeconds = 120
+	}
+	return ac.PlaySession
+}
+
+// GetPlaySessionAppConf 获取 app 的同时播放设备数限制，app 没有单独配置时使用默认配置
+func (ac *AppConfig) GetPlaySessionAppConf(appName string) PlaySessionAppConf {
+	if conf, ok := ac.PlaySession.Apps[appName]; ok {
+		return conf
+	}
+	return ac.PlaySession.PlaySessionAppConf
+}
+
+// GetPlaySessionLimit 获取 app 中某个套餐的用户同时播放的设备数，0 表示不限制
+// 套餐没有单独配置时使用 max_streams
+func (ac *AppConfig) GetPlaySessionLimit(appName, plan string) int {
+	conf := ac.GetPlaySessionAppConf(appName)
+	if limit, ok := conf.Plans[plan]; ok && plan != "" {
+		return limit
+	}
+	return conf.MaxStreams
+}
+
+// GetQoEConf 获取播放质量上报配置
+func (ac *AppConfig) GetQoEConf() QoEConf {
+	if ac.QoE.BucketSeconds <= 0 {
+		ac.QoE.BucketSeconds = 300
+	}
+	if ac.QoE.FlushSeconds <= 0 {
+		ac.QoE.FlushSeconds = 30
+	}
+	if ac.QoE.QueueSize <= 0 {
+		ac.QoE.QueueSize = 10000
+	}
+	return ac.QoE
+}
+
+// GetHTTPCachePolicy 获取播放接口的 HTTP 缓存策略，配置文件中的策略整体覆盖内置策略
+func (ac *AppConfig) GetHTTPCachePolicy(endpoint string) HTTPCachePolicy {
+	if policy, ok := ac.HTTPCache[endpoint]; ok {
+		return policy
+	}
+	return defaultHTTPCachePolicy[endpoint]
+}
+
+// GetDefinitionConf 获取清晰度配置，配置文件中没有的字段使用内置配置补全
+func (ac *AppConfig) GetDefinitionConf(definition string) DefinitionConf {
+	definitionConf := defaultDefinitionConf[strings.ToLower(definition)]
+	if conf, ok := ac.Definition[definition]; ok {
+		if conf.Bandwidth > 0 {
+			definitionConf.Bandwidth = conf.Bandwidth
+		}
+		if conf.Resolution != "" {
+			definitionConf.Resolution = conf.Resolution
+		}
+		if conf.Codecs != "" {
+			definitionConf.Codecs = conf.Codecs
+		}
+	}
+	// 未知清晰度沿用 1080p 的码率，保证 BANDWIDTH 一定有值
+	if definitionConf.Bandwidth <= 0 {
+		definitionConf.Bandwidth = defaultDefinitionConf["1080p"].Bandwidth
+	}
+	return definitionConf
+}
@@ -7,6 +7,8 @@ const (
 	BizContextKeyLoginAccountName = "biz_login_account_name" // 业务 context key：登录账号名
 	BizContextKeyLoginToken       = "biz_login_login"        // 业务 context key：登录token
 	BizContextKeyApplicationName  = "biz_application_name"   // 业务 context key：应用名称
+	BizContextKeyLoginPlan        = "biz_login_plan"         // 业务 context key：登录用户的套餐
 	BizContextKeyDebugParam       = "biz_debug_param"        // 业务 context key：debug 参数
 	BizContextKeyLogger           = "biz_logger"             // 业务 context key：logger
+	BizContextKeyPlayCDN          = "biz_play_cdn"           // 业务 context key：本次播放请求的 CDN 排序
 )
@@ -17,6 +17,9 @@ CREATE TABLE `cine_video_encrypt` (
 	`video_id` char(32) NOT NULL DEFAULT '' COMMENT '视频id',
 	`key` char(64) NOT NULL DEFAULT '' COMMENT '加密 key',
 	`iv` char(64) NOT NULL DEFAULT '' COMMENT '加密向量',
+	`definition` varchar(50) NOT NULL DEFAULT '' COMMENT '清晰度，空表示所有清晰度',
+	`start_sequence` int(10) NOT NULL DEFAULT '0' COMMENT '起始TS序号(包含)',
+	`end_sequence` int(10) NOT NULL DEFAULT '-1' COMMENT '结束TS序号(包含)，-1 表示到最后',
 	`create_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '创建时间',
 	PRIMARY KEY(`video_encrypt_id`),
 	KEY `video_id` (`video_id`),
@@ -32,13 +35,207 @@ CREATE TABLE `cine_video_ts` (
 	`video_id` char(32) NOT NULL DEFAULT '' COMMENT '视频id',
 	`ts_sequence` int(10) unsigned NOT NULL DEFAULT '0' COMMENT 'TS序号',
 	`ts_path` varchar(500) NOT NULL DEFAULT '' COMMENT 'TS文件存储路径',
+	`ts_path_b` varchar(500) NOT NULL DEFAULT '' COMMENT 'A/B 水印的 B 版本切片路径，为空时没有 B 版本，ts_path 为 A 版本',
 	`duration` decimal(10,6) unsigned NOT NULL DEFAULT '0' COMMENT 'TS片段时长(秒)',
 	`definition` varchar(50) NOT NULL DEFAULT '' COMMENT '清晰度',
+	`ts_size` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT 'TS文件大小(字节)',
+	`byte_offset` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '切片在媒体文件中的起始字节',
+	`byte_length` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '切片字节长度，0 表示整个文件',
+	`container` varchar(10) NOT NULL DEFAULT 'ts' COMMENT '切片封装格式：ts | fmp4',
+	`init_path` varchar(500) NOT NULL DEFAULT '' COMMENT 'fmp4 初始化切片路径',
+	`init_byte_offset` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT 'fmp4 初始化切片起始字节',
+	`init_byte_length` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT 'fmp4 初始化切片字节长度，0 表示整个文件',
+	`codecs` varchar(100) NOT NULL DEFAULT '' COMMENT '编码，如 avc1.640028,mp4a.40.2',
+	`keyframes` text NULL COMMENT '关键帧列表 JSON：[{byte_offset, byte_length, time_offset}]，偏移相对切片起始，用于 I-frame m3u8',
 	`create_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '创建时间',
 	PRIMARY KEY(`video_ts_id`),
 	KEY `video_id` (`video_id`),
 	KEY `ts_sequence` (`ts_sequence`),
 	KEY `definition` (`definition`),
 	KEY `create_time` (`create_time`),
-	UNIQUE KEY `video_id_sequence` (`video_id`, `ts_sequence`)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='视频ts文件表';
\ No newline at end of file
+	UNIQUE KEY `video_id_definition_sequence` (`video_id`, `definition`, `ts_sequence`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='视频ts文件表';
+
+-- ----------------------------------------------------------
+-- 直播信息表（没有记录的视频为点播）
+-- ----------------------------------------------------------
+DROP TABLE IF EXISTS `cine_video_live`;
+CREATE TABLE `cine_video_live` (
+	`video_live_id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键id',
+	`video_id` char(32) NOT NULL DEFAULT '' COMMENT '视频id',
+	`playlist_type` varchar(10) NOT NULL DEFAULT 'live' COMMENT 'm3u8 类型：live 滑动窗口 | event 只追加',
+	`window_size` int(10) unsigned NOT NULL DEFAULT '6' COMMENT '滑动窗口切片数（live）',
+	`target_duration` int(10) unsigned NOT NULL DEFAULT '0' COMMENT 'EXT-X-TARGETDURATION，0 表示按切片计算',
+	`status` tinyint(3) unsigned NOT NULL DEFAULT '1' COMMENT '状态：1 直播中 2 已结束',
+	`create_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '创建时间',
+	`update_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '更新时间',
+	PRIMARY KEY(`video_live_id`),
+	UNIQUE KEY `video_id` (`video_id`),
+	KEY `create_time` (`create_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='直播信息表';
+
+
+-- ----------------------------------------------------------
+-- 字幕轨道表
+-- ----------------------------------------------------------
+DROP TABLE IF EXISTS `cine_video_subtitle`;
+CREATE TABLE `cine_video_subtitle` (
+	`video_subtitle_id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键id',
+	`video_id` char(32) NOT NULL DEFAULT '' COMMENT '视频id',
+	`language` varchar(35) NOT NULL DEFAULT '' COMMENT '语言（BCP 47），如 en、zh-Hans',
+	`name` varchar(64) NOT NULL DEFAULT '' COMMENT '显示名称',
+	`is_default` tinyint(3) unsigned NOT NULL DEFAULT '0' COMMENT '是否默认字幕：0 否 1 是',
+	`is_forced` tinyint(3) unsigned NOT NULL DEFAULT '0' COMMENT '是否强制字幕：0 否 1 是',
+	`create_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '创建时间',
+	`update_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '更新时间',
+	PRIMARY KEY(`video_subtitle_id`),
+	UNIQUE KEY `video_id_language_forced` (`video_id`, `language`, `is_forced`),
+	KEY `create_time` (`create_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='字幕轨道表';
+
+-- ----------------------------------------------------------
+-- 字幕切片表（WebVTT）
+-- ----------------------------------------------------------
+DROP TABLE IF EXISTS `cine_video_subtitle_segment`;
+CREATE TABLE `cine_video_subtitle_segment` (
+	`video_subtitle_segment_id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键id',
+	`video_subtitle_id` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '字幕轨道id',
+	`video_id` char(32) NOT NULL DEFAULT '' COMMENT '视频id',
+	`sequence` int(10) NOT NULL DEFAULT '0' COMMENT '切片序号',
+	`path` varchar(255) NOT NULL DEFAULT '' COMMENT 'WebVTT 切片路径',
+	`duration` decimal(10,6) NOT NULL DEFAULT '0.000000' COMMENT '切片时长(秒)',
+	`content` mediumtext NULL COMMENT 'WebVTT 切片内容（上传 SRT/ASS 转换生成，path 为空时由服务输出）',
+	`create_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '创建时间',
+	PRIMARY KEY(`video_subtitle_segment_id`),
+	UNIQUE KEY `subtitle_sequence` (`video_subtitle_id`, `sequence`),
+	KEY `video_id` (`video_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='字幕切片表';
+
+
+-- ----------------------------------------------------------
+-- 音轨表（多语言配音），切片保存在 cine_video_ts，definition 为音轨的 definition
+-- ----------------------------------------------------------
+DROP TABLE IF EXISTS `cine_video_audio`;
+CREATE TABLE `cine_video_audio` (
+	`video_audio_id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键id',
+	`video_id` char(32) NOT NULL DEFAULT '' COMMENT '视频id',
+	`definition` varchar(50) NOT NULL DEFAULT '' COMMENT '音轨切片在 cine_video_ts 中的 definition，如 audio-cmn',
+	`language` varchar(35) NOT NULL DEFAULT '' COMMENT '语言（BCP 47），如 cmn、yue',
+	`name` varchar(64) NOT NULL DEFAULT '' COMMENT '显示名称',
+	`channels` tinyint(3) unsigned NOT NULL DEFAULT '2' COMMENT '声道数',
+	`codecs` varchar(64) NOT NULL DEFAULT '' COMMENT '编码，如 mp4a.40.2',
+	`is_default` tinyint(3) unsigned NOT NULL DEFAULT '0' COMMENT '是否默认音轨：0 否 1 是',
+	`create_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '创建时间',
+	`update_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '更新时间',
+	PRIMARY KEY(`video_audio_id`),
+	UNIQUE KEY `video_id_definition` (`video_id`, `definition`),
+	KEY `create_time` (`create_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='音轨表';
+
+-- ----------------------------------------------------------
+-- 缩略图雪碧图表，每张雪碧图按 columns x rows 的网格排列缩略图，缩略图间隔 interval 秒
+-- ----------------------------------------------------------
+DROP TABLE IF EXISTS `cine_video_thumbnail`;
+CREATE TABLE `cine_video_thumbnail` (
+	`video_thumbnail_id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键id',
+	`video_id` char(32) NOT NULL DEFAULT '' COMMENT '视频id',
+	`sequence` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '雪碧图序号，从 0 开始',
+	`path` varchar(512) NOT NULL DEFAULT '' COMMENT '雪碧图路径，相对路径时拼接 CDN 域名',
+	`columns` smallint(5) unsigned NOT NULL DEFAULT '0' COMMENT '网格列数',
+	`rows` smallint(5) unsigned NOT NULL DEFAULT '0' COMMENT '网格行数',
+	`tile_width` smallint(5) unsigned NOT NULL DEFAULT '0' COMMENT '单个缩略图宽度(像素)',
+	`tile_height` smallint(5) unsigned NOT NULL DEFAULT '0' COMMENT '单个缩略图高度(像素)',
+	`tile_count` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '雪碧图中的缩略图数量，最后一张可以不满',
+	`interval` decimal(10,3) NOT NULL DEFAULT '0.000' COMMENT '相邻缩略图的时间间隔(秒)',
+	`create_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '创建时间',
+	PRIMARY KEY(`video_thumbnail_id`),
+	UNIQUE KEY `video_id_sequence` (`video_id`, `sequence`),
+	KEY `create_time` (`create_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='缩略图雪碧图表';
+
+-- ----------------------------------------------------------
+-- 广告组表（服务端插入广告），一个广告组包含按顺序播放的若干广告切片
+-- ----------------------------------------------------------
+DROP TABLE IF EXISTS `cine_ad_pod`;
+CREATE TABLE `cine_ad_pod` (
+	`ad_pod_id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键id',
+	`name` varchar(64) NOT NULL DEFAULT '' COMMENT '广告组名称',
+	`status` tinyint(3) unsigned NOT NULL DEFAULT '1' COMMENT '状态：1 启用 2 停用',
+	`create_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '创建时间',
+	`update_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '更新时间',
+	PRIMARY KEY(`ad_pod_id`),
+	KEY `create_time` (`create_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='广告组表';
+
+-- ----------------------------------------------------------
+-- 广告切片表，广告切片为不加密的 MPEG-TS
+-- ----------------------------------------------------------
+DROP TABLE IF EXISTS `cine_ad_segment`;
+CREATE TABLE `cine_ad_segment` (
+	`ad_segment_id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键id',
+	`ad_pod_id` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '广告组id',
+	`sequence` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '广告组内的序号',
+	`path` varchar(512) NOT NULL DEFAULT '' COMMENT '切片路径，相对路径时拼接 CDN 域名',
+	`duration` decimal(10,6) NOT NULL DEFAULT '0.000000' COMMENT '切片时长(秒)',
+	`create_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '创建时间',
+	PRIMARY KEY(`ad_segment_id`),
+	UNIQUE KEY `ad_pod_id_sequence` (`ad_pod_id`, `sequence`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='广告切片表';
+
+-- ----------------------------------------------------------
+-- A/B 水印用户表，记录用户的水印码，用于从泄露视频的 A/B 序列反查用户
+-- ----------------------------------------------------------
+DROP TABLE IF EXISTS `cine_watermark_user`;
+CREATE TABLE `cine_watermark_user` (
+	`watermark_user_id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键id',
+	`user_id` varchar(64) NOT NULL DEFAULT '' COMMENT '用户id',
+	`code` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '水印码（64 位），由用户id和水印密钥 HMAC 生成',
+	`create_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '创建时间',
+	PRIMARY KEY(`watermark_user_id`),
+	UNIQUE KEY `code` (`code`),
+	KEY `user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='A/B 水印用户表';
+
+-- ----------------------------------------------------------
+-- 观看进度表，记录用户每个视频最后的播放位置，用于续播和继续观看列表
+-- ----------------------------------------------------------
+DROP TABLE IF EXISTS `cine_watch_progress`;
+CREATE TABLE `cine_watch_progress` (
+	`watch_progress_id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键id',
+	`user_id` varchar(64) NOT NULL DEFAULT '' COMMENT '用户id',
+	`video_id` char(32) NOT NULL DEFAULT '' COMMENT '视频id',
+	`vod_id` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '影片id（cine_vod），播放器上报，继续观看列表中同一影片只保留最近观看的一集',
+	`position` decimal(10,3) NOT NULL DEFAULT '0.000' COMMENT '播放位置(秒)',
+	`duration` decimal(10,3) NOT NULL DEFAULT '0.000' COMMENT '视频总时长(秒)，播放器上报',
+	`create_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '创建时间',
+	`update_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '最后上报时间',
+	PRIMARY KEY(`watch_progress_id`),
+	UNIQUE KEY `user_id_video_id` (`user_id`, `video_id`),
+	KEY `user_id_update_time` (`user_id`, `update_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='观看进度表';
+
+-- ----------------------------------------------------------
+-- 播放质量汇总表，播放器上报的起播、卡顿、码率切换和播放失败按时间段、app、视频、CDN 汇总
+-- ----------------------------------------------------------
+DROP TABLE IF EXISTS `cine_qoe_stat`;
+CREATE TABLE `cine_qoe_stat` (
+	`qoe_stat_id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键id',
+	`bucket_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '时间段开始时间',
+	`app` varchar(64) NOT NULL DEFAULT '' COMMENT 'app 名称',
+	`video_id` char(32) NOT NULL DEFAULT '' COMMENT '视频id',
+	`cdn` varchar(128) NOT NULL DEFAULT '' COMMENT 'CDN 名称，上报的域名不在 CDN 配置中时为域名',
+	`plays` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '起播次数',
+	`startup_ms_total` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '起播耗时合计(毫秒)',
+	`startup_ms_max` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '最长起播耗时(毫秒)',
+	`rebuffers` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '卡顿次数',
+	`rebuffer_ms_total` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '卡顿时长合计(毫秒)',
+	`watch_ms_total` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '播放时长合计(毫秒)',
+	`bitrate_switches` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '码率切换次数',
+	`bitrate_total` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '起播和切换后的码率合计(bit/s)',
+	`bitrate_samples` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '码率样本数',
+	`errors` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '播放失败次数',
+	`update_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '更新时间',
+	PRIMARY KEY(`qoe_stat_id`),
+	UNIQUE KEY `bucket_time_app_video_id_cdn` (`bucket_time`, `app`, `video_id`, `cdn`),
+	KEY `app_bucket_time` (`app`, `bucket_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='播放质量汇总表';
@@ -72,6 +72,7 @@ func authLoginJWTHandle(c *gin.Context) (keepNext bool) {
 	// 提取用户信息
 	userIDStr := claims.Id
 	userName := ""
+	plan := ""
 
 	// 从 claims 中获取用户名，使用反射安全获取 PreferredUsername 字段
 	// claims 是指针类型，需要先解引用
@@ -87,6 +88,10 @@ func authLoginJWTHandle(c *gin.Context) (keepNext bool) {
 		} else if usernameField := claimsValue.FieldByName("Username"); usernameField.IsValid() && usernameField.Kind() == reflect.String {
 			userName = usernameField.String()
 		}
+		// 用户的 tag 作为套餐，用于同时播放设备数限制
+		if tagField := claimsValue.FieldByName("Tag"); tagField.IsValid() && tagField.Kind() == reflect.String {
+			plan = tagField.String()
+		}
 	}
 
 	applicationName := claims.Owner // Owner 通常是组织名称，对应应用名称
@@ -98,6 +103,7 @@ func authLoginJWTHandle(c *gin.Context) (keepNext bool) {
 	entity.ContextWithLoginAccountName(c, userName)
 	entity.ContextWithApplicationName(c, applicationName)
 	entity.ContextWithLoginToken(c, tokenString)
+	entity.ContextWithLoginPlan(c, plan)
 
 	logger.WithContext(c).Infof("[AuthLoginJWT] User authenticated: userID=%s, userName=%s, appName=%s", userIDStr, userName, applicationName)
 
@@ -6,6 +6,7 @@ import (
 	"runtime"
 
 	"github.com/aldge/cine_stream/app/dao"
+	"github.com/aldge/cine_stream/app/worker"
 	"github.com/aldge/cine_stream/cmd"
 	"github.com/aldge/cine_stream/config"
 	"github.com/aldge/cine_stream/logger"
@@ -32,6 +33,8 @@ func main() {
 	router.Init()
 	// DB 初始化
 	dao.InitDB()
+	// Redis 初始化
+	dao.InitRedis()
 
 	// 如果指定了迁移参数，执行迁移并退出
 	if cmd.FlagVar.GetMigrate() {
@@ -55,6 +58,9 @@ func main() {
 		os.Exit(0)
 	}
 
+	// 播放质量汇总任务
+	worker.StartQoE()
+
 	// 设置 gin 框架允许环境
 	gin.SetMode(config.GetAppConf().Global.GinMode)
 
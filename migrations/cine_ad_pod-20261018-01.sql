@@ -0,0 +1,33 @@
+-- +migrate Up
+-- ----------------------------------------------------------
+-- 广告组表（服务端插入广告），一个广告组包含按顺序播放的若干广告切片
+-- ----------------------------------------------------------
+DROP TABLE IF EXISTS `cine_ad_pod`;
+CREATE TABLE `cine_ad_pod` (
+    `ad_pod_id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键id',
+    `name` varchar(64) NOT NULL DEFAULT '' COMMENT '广告组名称',
+    `status` tinyint(3) unsigned NOT NULL DEFAULT '1' COMMENT '状态：1 启用 2 停用',
+    `create_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '创建时间',
+    `update_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '更新时间',
+    PRIMARY KEY(`ad_pod_id`),
+    KEY `create_time` (`create_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='广告组表';
+
+-- ----------------------------------------------------------
+-- 广告切片表，广告切片为不加密的 MPEG-TS
+-- ----------------------------------------------------------
+DROP TABLE IF EXISTS `cine_ad_segment`;
+CREATE TABLE `cine_ad_segment` (
+    `ad_segment_id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键id',
+    `ad_pod_id` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '广告组id',
+    `sequence` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '广告组内的序号',
+    `path` varchar(512) NOT NULL DEFAULT '' COMMENT '切片路径，相对路径时拼接 CDN 域名',
+    `duration` decimal(10,6) NOT NULL DEFAULT '0.000000' COMMENT '切片时长(秒)',
+    `create_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '创建时间',
+    PRIMARY KEY(`ad_segment_id`),
+    UNIQUE KEY `ad_pod_id_sequence` (`ad_pod_id`, `sequence`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='广告切片表';
+
+-- +migrate Down
+DROP TABLE IF EXISTS `cine_ad_segment`;
+DROP TABLE IF EXISTS `cine_ad_pod`;
@@ -0,0 +1,29 @@
+-- +migrate Up
+-- ----------------------------------------------------------
+-- 播放质量汇总表，播放器上报的起播、卡顿、码率切换和播放失败按时间段、app、视频、CDN 汇总
+-- ----------------------------------------------------------
+DROP TABLE IF EXISTS `cine_qoe_stat`;
+CREATE TABLE `cine_qoe_stat` (
+    `qoe_stat_id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键id',
+    `bucket_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '时间段开始时间',
+    `app` varchar(64) NOT NULL DEFAULT '' COMMENT 'app 名称',
+    `video_id` char(32) NOT NULL DEFAULT '' COMMENT '视频id',
+    `cdn` varchar(128) NOT NULL DEFAULT '' COMMENT 'CDN 名称，上报的域名不在 CDN 配置中时为域名',
+    `plays` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '起播次数',
+    `startup_ms_total` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '起播耗时合计(毫秒)',
+    `startup_ms_max` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '最长起播耗时(毫秒)',
+    `rebuffers` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '卡顿次数',
+    `rebuffer_ms_total` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '卡顿时长合计(毫秒)',
+    `watch_ms_total` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '播放时长合计(毫秒)',
+    `bitrate_switches` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '码率切换次数',
+    `bitrate_total` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '起播和切换后的码率合计(bit/s)',
+    `bitrate_samples` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '码率样本数',
+    `errors` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '播放失败次数',
+    `update_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '更新时间',
+    PRIMARY KEY(`qoe_stat_id`),
+    UNIQUE KEY `bucket_time_app_video_id_cdn` (`bucket_time`, `app`, `video_id`, `cdn`),
+    KEY `app_bucket_time` (`app`, `bucket_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='播放质量汇总表';
+
+-- +migrate Down
+DROP TABLE IF EXISTS `cine_qoe_stat`;
@@ -0,0 +1,23 @@
+-- +migrate Up
+-- ----------------------------------------------------------
+-- 音轨表（多语言配音），切片保存在 cine_video_ts，definition 为音轨的 definition
+-- ----------------------------------------------------------
+DROP TABLE IF EXISTS `cine_video_audio`;
+CREATE TABLE `cine_video_audio` (
+    `video_audio_id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键id',
+    `video_id` char(32) NOT NULL DEFAULT '' COMMENT '视频id',
+    `definition` varchar(50) NOT NULL DEFAULT '' COMMENT '音轨切片在 cine_video_ts 中的 definition，如 audio-cmn',
+    `language` varchar(35) NOT NULL DEFAULT '' COMMENT '语言（BCP 47），如 cmn、yue',
+    `name` varchar(64) NOT NULL DEFAULT '' COMMENT '显示名称',
+    `channels` tinyint(3) unsigned NOT NULL DEFAULT '2' COMMENT '声道数',
+    `codecs` varchar(64) NOT NULL DEFAULT '' COMMENT '编码，如 mp4a.40.2',
+    `is_default` tinyint(3) unsigned NOT NULL DEFAULT '0' COMMENT '是否默认音轨：0 否 1 是',
+    `create_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '创建时间',
+    `update_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '更新时间',
+    PRIMARY KEY(`video_audio_id`),
+    UNIQUE KEY `video_id_definition` (`video_id`, `definition`),
+    KEY `create_time` (`create_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='音轨表';
+
+-- +migrate Down
+DROP TABLE IF EXISTS `cine_video_audio`;
@@ -0,0 +1,12 @@
+-- +migrate Up
+-- 支持密钥轮换：每条加密信息作用于一段 TS 序号区间
+ALTER TABLE `cine_video_encrypt`
+    ADD COLUMN `definition` varchar(50) NOT NULL DEFAULT '' COMMENT '清晰度，空表示所有清晰度' AFTER `iv`,
+    ADD COLUMN `start_sequence` int(10) NOT NULL DEFAULT '0' COMMENT '起始TS序号(包含)' AFTER `definition`,
+    ADD COLUMN `end_sequence` int(10) NOT NULL DEFAULT '-1' COMMENT '结束TS序号(包含)，-1 表示到最后' AFTER `start_sequence`;
+
+-- +migrate Down
+ALTER TABLE `cine_video_encrypt`
+    DROP COLUMN `definition`,
+    DROP COLUMN `start_sequence`,
+    DROP COLUMN `end_sequence`;
@@ -0,0 +1,21 @@
+-- +migrate Up
+-- ----------------------------------------------------------
+-- 直播信息表（没有记录的视频为点播）
+-- ----------------------------------------------------------
+DROP TABLE IF EXISTS `cine_video_live`;
+CREATE TABLE `cine_video_live` (
+    `video_live_id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键id',
+    `video_id` char(32) NOT NULL DEFAULT '' COMMENT '视频id',
+    `playlist_type` varchar(10) NOT NULL DEFAULT 'live' COMMENT 'm3u8 类型：live 滑动窗口 | event 只追加',
+    `window_size` int(10) unsigned NOT NULL DEFAULT '6' COMMENT '滑动窗口切片数（live）',
+    `target_duration` int(10) unsigned NOT NULL DEFAULT '0' COMMENT 'EXT-X-TARGETDURATION，0 表示按切片计算',
+    `status` tinyint(3) unsigned NOT NULL DEFAULT '1' COMMENT '状态：1 直播中 2 已结束',
+    `create_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '创建时间',
+    `update_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '更新时间',
+    PRIMARY KEY(`video_live_id`),
+    UNIQUE KEY `video_id` (`video_id`),
+    KEY `create_time` (`create_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='直播信息表';
+
+-- +migrate Down
+DROP TABLE IF EXISTS `cine_video_live`;
@@ -0,0 +1,39 @@
+-- +migrate Up
+-- ----------------------------------------------------------
+-- 字幕轨道表
+-- ----------------------------------------------------------
+DROP TABLE IF EXISTS `cine_video_subtitle`;
+CREATE TABLE `cine_video_subtitle` (
+    `video_subtitle_id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键id',
+    `video_id` char(32) NOT NULL DEFAULT '' COMMENT '视频id',
+    `language` varchar(35) NOT NULL DEFAULT '' COMMENT '语言（BCP 47），如 en、zh-Hans',
+    `name` varchar(64) NOT NULL DEFAULT '' COMMENT '显示名称',
+    `is_default` tinyint(3) unsigned NOT NULL DEFAULT '0' COMMENT '是否默认字幕：0 否 1 是',
+    `is_forced` tinyint(3) unsigned NOT NULL DEFAULT '0' COMMENT '是否强制字幕：0 否 1 是',
+    `create_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '创建时间',
+    `update_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '更新时间',
+    PRIMARY KEY(`video_subtitle_id`),
+    UNIQUE KEY `video_id_language_forced` (`video_id`, `language`, `is_forced`),
+    KEY `create_time` (`create_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='字幕轨道表';
+
+-- ----------------------------------------------------------
+-- 字幕切片表（WebVTT）
+-- ----------------------------------------------------------
+DROP TABLE IF EXISTS `cine_video_subtitle_segment`;
+CREATE TABLE `cine_video_subtitle_segment` (
+    `video_subtitle_segment_id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键id',
+    `video_subtitle_id` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '字幕轨道id',
+    `video_id` char(32) NOT NULL DEFAULT '' COMMENT '视频id',
+    `sequence` int(10) NOT NULL DEFAULT '0' COMMENT '切片序号',
+    `path` varchar(255) NOT NULL DEFAULT '' COMMENT 'WebVTT 切片路径',
+    `duration` decimal(10,6) NOT NULL DEFAULT '0.000000' COMMENT '切片时长(秒)',
+    `create_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '创建时间',
+    PRIMARY KEY(`video_subtitle_segment_id`),
+    UNIQUE KEY `subtitle_sequence` (`video_subtitle_id`, `sequence`),
+    KEY `video_id` (`video_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='字幕切片表';
+
+-- +migrate Down
+DROP TABLE IF EXISTS `cine_video_subtitle_segment`;
+DROP TABLE IF EXISTS `cine_video_subtitle`;
@@ -0,0 +1,6 @@
+-- +migrate Up
+ALTER TABLE `cine_video_subtitle_segment`
+    ADD COLUMN `content` mediumtext NULL COMMENT 'WebVTT 切片内容（上传 SRT/ASS 转换生成，path 为空时由服务输出）' AFTER `duration`;
+
+-- +migrate Down
+ALTER TABLE `cine_video_subtitle_segment` DROP COLUMN `content`;
@@ -0,0 +1,24 @@
+-- +migrate Up
+-- ----------------------------------------------------------
+-- 缩略图雪碧图表，每张雪碧图按 columns x rows 的网格排列缩略图，缩略图间隔 interval 秒
+-- ----------------------------------------------------------
+DROP TABLE IF EXISTS `cine_video_thumbnail`;
+CREATE TABLE `cine_video_thumbnail` (
+    `video_thumbnail_id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键id',
+    `video_id` char(32) NOT NULL DEFAULT '' COMMENT '视频id',
+    `sequence` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '雪碧图序号，从 0 开始',
+    `path` varchar(512) NOT NULL DEFAULT '' COMMENT '雪碧图路径，相对路径时拼接 CDN 域名',
+    `columns` smallint(5) unsigned NOT NULL DEFAULT '0' COMMENT '网格列数',
+    `rows` smallint(5) unsigned NOT NULL DEFAULT '0' COMMENT '网格行数',
+    `tile_width` smallint(5) unsigned NOT NULL DEFAULT '0' COMMENT '单个缩略图宽度(像素)',
+    `tile_height` smallint(5) unsigned NOT NULL DEFAULT '0' COMMENT '单个缩略图高度(像素)',
+    `tile_count` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '雪碧图中的缩略图数量，最后一张可以不满',
+    `interval` decimal(10,3) NOT NULL DEFAULT '0.000' COMMENT '相邻缩略图的时间间隔(秒)',
+    `create_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '创建时间',
+    PRIMARY KEY(`video_thumbnail_id`),
+    UNIQUE KEY `video_id_sequence` (`video_id`, `sequence`),
+    KEY `create_time` (`create_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='缩略图雪碧图表';
+
+-- +migrate Down
+DROP TABLE IF EXISTS `cine_video_thumbnail`;
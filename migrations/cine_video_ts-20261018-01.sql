@@ -0,0 +1,6 @@
+-- +migrate Up
+ALTER TABLE `cine_video_ts`
+    ADD COLUMN `ts_size` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT 'TS文件大小(字节)' AFTER `definition`;
+
+-- +migrate Down
+ALTER TABLE `cine_video_ts` DROP COLUMN `ts_size`;
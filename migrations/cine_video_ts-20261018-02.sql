@@ -0,0 +1,10 @@
+-- +migrate Up
+-- 不同清晰度各自从 0 开始编号，唯一键加上清晰度
+ALTER TABLE `cine_video_ts`
+    DROP INDEX `video_id_sequence`,
+    ADD UNIQUE KEY `video_id_definition_sequence` (`video_id`, `definition`, `ts_sequence`);
+
+-- +migrate Down
+ALTER TABLE `cine_video_ts`
+    DROP INDEX `video_id_definition_sequence`,
+    ADD UNIQUE KEY `video_id_sequence` (`video_id`, `ts_sequence`);
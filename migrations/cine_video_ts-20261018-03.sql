@@ -0,0 +1,12 @@
+-- +migrate Up
+-- 支持 fMP4 / CMAF 切片
+ALTER TABLE `cine_video_ts`
+    ADD COLUMN `container` varchar(10) NOT NULL DEFAULT 'ts' COMMENT '切片封装格式：ts | fmp4' AFTER `ts_size`,
+    ADD COLUMN `init_path` varchar(500) NOT NULL DEFAULT '' COMMENT 'fmp4 初始化切片路径' AFTER `container`,
+    ADD COLUMN `codecs` varchar(100) NOT NULL DEFAULT '' COMMENT '编码，如 avc1.640028,mp4a.40.2' AFTER `init_path`;
+
+-- +migrate Down
+ALTER TABLE `cine_video_ts`
+    DROP COLUMN `container`,
+    DROP COLUMN `init_path`,
+    DROP COLUMN `codecs`;
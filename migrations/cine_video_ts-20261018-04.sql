@@ -0,0 +1,14 @@
+-- +migrate Up
+-- 支持按字节范围寻址的切片（多个切片共用一个媒体文件）
+ALTER TABLE `cine_video_ts`
+    ADD COLUMN `byte_offset` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '切片在媒体文件中的起始字节' AFTER `ts_size`,
+    ADD COLUMN `byte_length` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '切片字节长度，0 表示整个文件' AFTER `byte_offset`,
+    ADD COLUMN `init_byte_offset` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT 'fmp4 初始化切片起始字节' AFTER `init_path`,
+    ADD COLUMN `init_byte_length` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT 'fmp4 初始化切片字节长度，0 表示整个文件' AFTER `init_byte_offset`;
+
+-- +migrate Down
+ALTER TABLE `cine_video_ts`
+    DROP COLUMN `byte_offset`,
+    DROP COLUMN `byte_length`,
+    DROP COLUMN `init_byte_offset`,
+    DROP COLUMN `init_byte_length`;
@@ -0,0 +1,6 @@
+-- +migrate Up
+ALTER TABLE `cine_video_ts`
+    ADD COLUMN `keyframes` text NULL COMMENT '关键帧列表 JSON：[{byte_offset, byte_length, time_offset}]，偏移相对切片起始，用于 I-frame m3u8' AFTER `codecs`;
+
+-- +migrate Down
+ALTER TABLE `cine_video_ts` DROP COLUMN `keyframes`;
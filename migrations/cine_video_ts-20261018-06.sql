@@ -0,0 +1,6 @@
+-- +migrate Up
+ALTER TABLE `cine_video_ts`
+    ADD COLUMN `ts_path_b` varchar(500) NOT NULL DEFAULT '' COMMENT 'A/B 水印的 B 版本切片路径，为空时没有 B 版本，ts_path 为 A 版本' AFTER `ts_path`;
+
+-- +migrate Down
+ALTER TABLE `cine_video_ts` DROP COLUMN `ts_path_b`;
@@ -0,0 +1,21 @@
+-- +migrate Up
+-- ----------------------------------------------------------
+-- 观看进度表，记录用户每个视频最后的播放位置，用于续播和继续观看列表
+-- ----------------------------------------------------------
+DROP TABLE IF EXISTS `cine_watch_progress`;
+CREATE TABLE `cine_watch_progress` (
+    `watch_progress_id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键id',
+    `user_id` varchar(64) NOT NULL DEFAULT '' COMMENT '用户id',
+    `video_id` char(32) NOT NULL DEFAULT '' COMMENT '视频id',
+    `vod_id` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '影片id（cine_vod），播放器上报，继续观看列表中同一影片只保留最近观看的一集',
+    `position` decimal(10,3) NOT NULL DEFAULT '0.000' COMMENT '播放位置(秒)',
+    `duration` decimal(10,3) NOT NULL DEFAULT '0.000' COMMENT '视频总时长(秒)，播放器上报',
+    `create_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '创建时间',
+    `update_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '最后上报时间',
+    PRIMARY KEY(`watch_progress_id`),
+    UNIQUE KEY `user_id_video_id` (`user_id`, `video_id`),
+    KEY `user_id_update_time` (`user_id`, `update_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='观看进度表';
+
+-- +migrate Down
+DROP TABLE IF EXISTS `cine_watch_progress`;
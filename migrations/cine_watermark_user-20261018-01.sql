@@ -0,0 +1,17 @@
+-- +migrate Up
+-- ----------------------------------------------------------
+-- A/B 水印用户表，记录用户的水印码，用于从泄露视频的 A/B 序列反查用户
+-- ----------------------------------------------------------
+DROP TABLE IF EXISTS `cine_watermark_user`;
+CREATE TABLE `cine_watermark_user` (
+    `watermark_user_id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键id',
+    `user_id` varchar(64) NOT NULL DEFAULT '' COMMENT '用户id',
+    `code` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '水印码（64 位），由用户id和水印密钥 HMAC 生成',
+    `create_time` int(11) unsigned NOT NULL DEFAULT '0' COMMENT '创建时间',
+    PRIMARY KEY(`watermark_user_id`),
+    UNIQUE KEY `code` (`code`),
+    KEY `user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='A/B 水印用户表';
+
+-- +migrate Down
+DROP TABLE IF EXISTS `cine_watermark_user`;
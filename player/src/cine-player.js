@@ -4,10 +4,13 @@
  * 基于 DPlayer + HLS.js 的视频播放器 SDK，支持自定义加密协议解析。
  * 
  * 核心特性：
- * - 支持 AES-128-GCM 加密的 m3u8 内容解密
+ * - 支持 c3u8 v2 协议：每次播放 ECDH 协商密钥（X25519，不支持时 P-256），AES-256-GCM 解密 m3u8 内容
  * - m3u8 内容从内存读取，无需额外网络请求
  * - ts 分片由 HLS.js 原生加载，保证最佳性能
  * - 自动加载 DPlayer 和 HLS.js 依赖
+ * - 播放时定时发送心跳，服务端据此限制同一账号同时播放的设备数并保存观看进度
+ * - 自动从上次观看的位置续播
+ * - 上报播放质量：起播耗时、卡顿、码率切换、播放失败和切片所在的 CDN
  * 
  * 使用示例：
  * ```javascript
@@ -49,18 +52,41 @@ const CONFIG = {
   },
 
   /**
-   * AES-128-GCM 加密配置
-   * @property {string} KEY - 16 字节密钥
-   * @property {string} NONCE - 12 字节随机数
+   * c3u8 v2 加密配置
+   * 密钥由播放器和服务端的临时密钥对协商，nonce 由服务端每次随机生成，都不固定在 SDK 中
+   * @property {number} VERSION - 协议版本
+   * @property {string} HKDF_INFO - 派生内容密钥使用的 HKDF info
    * @property {string} ALGORITHM - 加密算法
    * @property {number} TAG_LENGTH - 认证标签长度（位）
    */
   CRYPTO: {
-    KEY: '0123456789abcdef',
-    NONCE: '0123456789ab',
+    VERSION: 2,
+    HKDF_INFO: 'cine-c3u8-v2',
     ALGORITHM: 'AES-GCM',
     TAG_LENGTH: 128
   },
+
+  /**
+   * 播放会话配置
+   * @property {string} DEVICE_ID_KEY - 设备 ID 在 localStorage 中的 key
+   * @property {number} HEARTBEAT_INTERVAL - 默认心跳间隔（秒），服务端返回间隔后以服务端为准
+   * @property {number} STREAM_LIMIT_CODE - 同时播放的设备数已达上限的错误码
+   */
+  SESSION: {
+    DEVICE_ID_KEY: 'cine_device_id',
+    HEARTBEAT_INTERVAL: 40,
+    STREAM_LIMIT_CODE: 1008
+  },
+
+  /**
+   * 播放质量上报配置
+   * @property {number} FLUSH_INTERVAL - 定时上报间隔（秒）
+   * @property {number} MAX_EVENTS - 每次上报最多的事件数，达到时立即上报
+   */
+  QOE: {
+    FLUSH_INTERVAL: 30,
+    MAX_EVENTS: 100
+  },
 };
 
 // ==================== 工具函数 ====================
@@ -79,6 +105,39 @@ function base64ToArrayBuffer(base64) {
   return bytes.buffer;
 }
 
+/**
+ * Base64url（无填充）字符串转 ArrayBuffer
+ * @param {string} base64url - Base64url 编码的字符串
+ * @returns {ArrayBuffer} 解码后的二进制数据
+ */
+function base64UrlToArrayBuffer(base64url) {
+  const base64 = base64url.replace(/-/g, '+').replace(/_/g, '/');
+  return base64ToArrayBuffer(base64 + '='.repeat((4 - base64.length % 4) % 4));
+}
+
+/**
+ * ArrayBuffer 转 Base64url（无填充）字符串
+ * @param {ArrayBuffer} buffer - 二进制数据
+ * @returns {string} Base64url 编码的字符串
+ */
+function arrayBufferToBase64Url(buffer) {
+  let binaryString = '';
+  const bytes = new Uint8Array(buffer);
+  for (let i = 0; i < bytes.length; i++) {
+    binaryString += String.fromCharCode(bytes[i]);
+  }
+  return btoa(binaryString).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+}
+
+/**
+ * ArrayBuffer 转十六进制字符串
+ * @param {ArrayBuffer} buffer - 二进制数据
+ * @returns {string} 十六进制字符串
+ */
+function arrayBufferToHex(buffer) {
+  return Array.from(new Uint8Array(buffer), b => b.toString(16).padStart(2, '0')).join('');
+}
+
 /**
  * 动态加载外部脚本
  * @param {string} src - 脚本 URL
@@ -95,6 +154,67 @@ function loadScript(src) {
   });
 }
 
+/**
+ * 获取当前浏览器的设备 ID，第一次使用时随机生成并保存在 localStorage
+ * localStorage 不可用（如隐私模式）时每次页面加载生成新的 ID
+ * @returns {string} 设备 ID
+ */
+function getDeviceId() {
+  try {
+    let deviceId = localStorage.getItem(CONFIG.SESSION.DEVICE_ID_KEY);
+    if (!deviceId) {
+      deviceId = crypto.randomUUID();
+      localStorage.setItem(CONFIG.SESSION.DEVICE_ID_KEY, deviceId);
+    }
+    return deviceId;
+  } catch (e) {
+    if (!getDeviceId._fallback) {
+      getDeviceId._fallback = crypto.randomUUID();
+    }
+    return getDeviceId._fallback;
+  }
+}
+
+/**
+ * 根据 c3u8 地址生成视频的播放接口地址：/play/<video_id>/<action>，保留 app 参数并带上设备 ID
+ * @param {string} url - c3u8 地址
+ * @param {string} action - 接口名，如 heartbeat、progress
+ * @returns {string|null} 接口地址，无法识别视频 ID 时为 null
+ */
+function buildPlayApiUrl(url, action) {
+  const urlObj = new URL(url, window.location.href);
+  const match = urlObj.pathname.match(/^(.*\/play\/[^/]+)\//);
+  if (!match) {
+    return null;
+  }
+  const apiUrl = new URL(`${match[1]}/${action}`, urlObj.origin);
+  const appName = urlObj.searchParams.get('app');
+  if (appName) {
+    apiUrl.searchParams.set('app', appName);
+  }
+  apiUrl.searchParams.set('device_id', getDeviceId());
+  return apiUrl.toString();
+}
+
+/**
+ * 根据 c3u8 地址生成播放质量上报地址：/qoe/beacon，保留 app 参数
+ * @param {string} url - c3u8 地址
+ * @returns {{beaconUrl: string, videoId: string}|null} 上报地址和视频 ID，无法识别视频 ID 时为 null
+ */
+function buildQoEBeaconUrl(url) {
+  const urlObj = new URL(url, window.location.href);
+  const match = urlObj.pathname.match(/^(.*)\/play\/([^/]+)\//);
+  if (!match) {
+    return null;
+  }
+  const beaconUrl = new URL(`${match[1]}/qoe/beacon`, urlObj.origin);
+  const appName = urlObj.searchParams.get('app');
+  if (appName) {
+    beaconUrl.searchParams.set('app', appName);
+  }
+  return { beaconUrl: beaconUrl.toString(), videoId: decodeURIComponent(match[2]) };
+}
+
 /**
  * 创建 HLS.js 加载统计对象
  * 用于 PlaylistLoader 回调，模拟网络请求统计信息
@@ -115,41 +235,104 @@ function createStats() {
 
 /**
  * 加密解密模块
- * 使用 Web Crypto API 实现 AES-128-GCM 解密
+ * 使用 Web Crypto API 实现 ECDH 密钥协商、HKDF 密钥派生和 AES-256-GCM 解密
  */
 const CryptoModule = {
+  /** @private 当前页面的临时密钥会话 Promise，同一页面的播放共用 */
+  _sessionPromise: null,
+
+  /**
+   * 获取临时密钥会话（私钥不可导出，只保存在内存中）
+   * @returns {Promise<{curve: string, keyPair: CryptoKeyPair, algorithm: Object, publicKey: string, keyId: string}>}
+   */
+  getSession() {
+    if (!this._sessionPromise) {
+      this._sessionPromise = this._createSession().catch(err => {
+        this._sessionPromise = null;
+        throw err;
+      });
+    }
+    return this._sessionPromise;
+  },
+
   /**
-   * AES-128-GCM 解密
-   * @param {string} encryptedBase64 - Base64 编码的密文（包含认证标签）
-   * @param {string} [key=CONFIG.CRYPTO.KEY] - 16 字节密钥
+   * 生成临时密钥对，优先使用 X25519，浏览器不支持时使用 P-256
+   * @private
+   */
+  async _createSession() {
+    let curve = 'x25519';
+    let algorithm = { name: 'X25519' };
+    let keyPair;
+    try {
+      keyPair = await crypto.subtle.generateKey(algorithm, false, ['deriveBits']);
+    } catch (e) {
+      curve = 'p256';
+      algorithm = { name: 'ECDH', namedCurve: 'P-256' };
+      keyPair = await crypto.subtle.generateKey(algorithm, false, ['deriveBits']);
+    }
+    const publicKeyBuffer = await crypto.subtle.exportKey('raw', keyPair.publicKey);
+    const keyHash = await crypto.subtle.digest('SHA-256', publicKeyBuffer);
+    return {
+      curve,
+      keyPair,
+      algorithm,
+      publicKey: arrayBufferToBase64Url(publicKeyBuffer),
+      keyId: arrayBufferToHex(keyHash.slice(0, 8))
+    };
+  },
+
+  /**
+   * 解密 c3u8 v2 响应
+   * @param {Object} envelope - 响应中的 data：{ v, kid, alg, epk, nonce, info }
+   * @param {Object} session - getSession 返回的临时密钥会话
    * @returns {Promise<string>} 解密后的明文字符串
-   * @throws {Error} 解密失败时抛出错误
+   * @throws {Error} 密钥 ID 不匹配或解密失败时抛出错误
    */
-  async decrypt(encryptedBase64, key = CONFIG.CRYPTO.KEY) {
+  async decryptEnvelope(envelope, session) {
+    if (envelope.kid !== session.keyId) {
+      throw new Error('Envelope key id mismatch');
+    }
     const encoder = new TextEncoder();
-    const keyBuffer = encoder.encode(key);
-    const nonceBuffer = encoder.encode(CONFIG.CRYPTO.NONCE);
-    const encryptedBuffer = base64ToArrayBuffer(encryptedBase64);
 
-    // 导入密钥
-    const cryptoKey = await crypto.subtle.importKey(
+    // ECDH 协商共享密钥
+    const serverKey = await crypto.subtle.importKey(
       'raw',
-      keyBuffer,
-      { name: CONFIG.CRYPTO.ALGORITHM },
+      base64UrlToArrayBuffer(envelope.epk),
+      session.algorithm,
+      false,
+      []
+    );
+    const sharedBits = await crypto.subtle.deriveBits(
+      { name: session.algorithm.name, public: serverKey },
+      session.keyPair.privateKey,
+      256
+    );
+
+    // HKDF-SHA256 派生 AES-256-GCM 密钥
+    const hkdfKey = await crypto.subtle.importKey('raw', sharedBits, 'HKDF', false, ['deriveKey']);
+    const contentKey = await crypto.subtle.deriveKey(
+      {
+        name: 'HKDF',
+        hash: 'SHA-256',
+        salt: new Uint8Array(0),
+        info: encoder.encode(CONFIG.CRYPTO.HKDF_INFO)
+      },
+      hkdfKey,
+      { name: CONFIG.CRYPTO.ALGORITHM, length: 256 },
       false,
       ['decrypt']
     );
 
-    // 执行解密（自动验证认证标签）
+    // 执行解密（自动验证认证标签，附加数据绑定协议版本和密钥 ID）
     const plaintextBuffer = await crypto.subtle.decrypt(
       {
         name: CONFIG.CRYPTO.ALGORITHM,
-        iv: nonceBuffer,
-        additionalData: new Uint8Array(0),
+        iv: base64UrlToArrayBuffer(envelope.nonce),
+        additionalData: encoder.encode(`cine-c3u8:v${CONFIG.CRYPTO.VERSION}:${envelope.kid}`),
         tagLength: CONFIG.CRYPTO.TAG_LENGTH
       },
-      cryptoKey,
-      encryptedBuffer
+      contentKey,
+      base64ToArrayBuffer(envelope.info)
     );
 
     return new TextDecoder().decode(plaintextBuffer);
@@ -180,45 +363,239 @@ const ProtocolModule = {
   /**
    * 解析加密协议，获取解密后的 m3u8 内容
    * 
-   * 协议响应格式：
+   * 请求带上播放器临时公钥和设备 ID：`?pk=<Base64url 公钥>&curve=x25519|p256&device_id=<设备 ID>`，
+   * 服务端把设备 ID 带到 m3u8 中的密钥地址上
+   * 
+   * 协议响应格式（v2）：
    * ```json
    * {
    *   "code": 0,
    *   "message": "success",
    *   "data": {
-   *     "info": "<Base64 编码的 AES-GCM 加密内容>"
+   *     "v": 2,
+   *     "kid": "<播放器公钥 SHA-256 前 8 字节>",
+   *     "alg": "ECDH-X25519+HKDF-SHA256+A256GCM",
+   *     "epk": "<服务端临时公钥>",
+   *     "nonce": "<随机 nonce>",
+   *     "info": "<Base64 编码的 AES-GCM 加密内容>",
+   *     "trial": { "episode": false, "duration": 300 }
    *   }
    * }
    * ```
+   * 没有播放权限但可以试看时返回 trial，m3u8 只包含试看范围内的切片
+   * 
+   * 同一账号同时播放的设备数已达上限时返回 HTTP 429，code 为 1008，抛出的错误带有 code
    * 
    * @param {string} url - 加密协议 URL
-   * @returns {Promise<string>} 解密后的 m3u8 内容
+   * @returns {Promise<{content: string, trial: Object|null}>} 解密后的 m3u8 内容和试看范围
    * @throws {Error} 请求失败、协议错误或解密失败时抛出错误
    */
   async parse(url) {
-    const response = await fetch(url);
-    if (!response.ok) {
-      throw new Error(`HTTP error: ${response.status}`);
+    const session = await CryptoModule.getSession();
+    const requestUrl = new URL(url, window.location.href);
+    requestUrl.searchParams.set('pk', session.publicKey);
+    requestUrl.searchParams.set('curve', session.curve);
+    requestUrl.searchParams.set('device_id', getDeviceId());
+
+    const response = await fetch(requestUrl.toString());
+    const data = await response.json().catch(() => null);
+    if (!response.ok || !data) {
+      const error = new Error(data?.message || `HTTP error: ${response.status}`);
+      error.code = data?.code;
+      throw error;
     }
 
-    const data = await response.json();
     if (data.code !== 0) {
-      throw new Error(data.message || 'Protocol error');
+      const error = new Error(data.message || 'Protocol error');
+      error.code = data.code;
+      throw error;
     }
 
     if (!data.data?.info) {
       throw new Error('Invalid protocol format: missing data.info');
     }
 
-    const decrypted = await CryptoModule.decrypt(data.data.info);
+    if (data.data.v !== CONFIG.CRYPTO.VERSION) {
+      throw new Error(`Unsupported protocol version: ${data.data.v}`);
+    }
+
+    const decrypted = await CryptoModule.decryptEnvelope(data.data, session);
     if (!decrypted.includes('#EXTM3U')) {
       throw new Error('Decrypted data is not valid m3u8 format');
     }
 
-    return decrypted;
+    return { content: decrypted, trial: data.data.trial || null };
   }
 };
 
+// ==================== 播放质量模块 ====================
+
+/**
+ * 播放质量采集
+ * 
+ * 采集起播耗时、卡顿（不包括拖动引起的缓冲）、码率切换、不可恢复的错误和实际播放时长，
+ * 记录事件发生时切片所在的域名，定时和页面关闭时用 navigator.sendBeacon 上报
+ */
+class QoECollector {
+  /**
+   * @param {string} beaconUrl - 上报地址
+   * @param {string} videoId - 视频 ID
+   * @param {boolean} autoplay - 是否自动播放；自动播放时起播耗时从创建开始计算（包括获取 c3u8），否则从用户点击播放开始
+   */
+  constructor(beaconUrl, videoId, autoplay) {
+    this.beaconUrl = beaconUrl;
+    this.videoId = videoId;
+    this.events = [];
+    this.cdnHost = '';
+    this._startAt = autoplay ? performance.now() : null;
+    this._started = false;
+    this._bitrate = 0;
+    this._waitingSince = null;
+    this._playingSince = null;
+    this._watchMs = 0;
+    this._timer = setInterval(() => this.flush(), CONFIG.QOE.FLUSH_INTERVAL * 1000);
+    this._onPageHide = () => this.flush();
+    window.addEventListener('pagehide', this._onPageHide);
+  }
+
+  /**
+   * 监听 video 元素和 HLS.js 事件
+   * @param {HTMLVideoElement} video - video 元素
+   * @param {Hls} hls - HLS.js 实例
+   */
+  attach(video, hls) {
+    video.addEventListener('play', () => {
+      if (this._startAt === null) this._startAt = performance.now();
+    });
+    video.addEventListener('playing', () => {
+      const now = performance.now();
+      if (!this._started) {
+        this._started = true;
+        this._push({
+          type: 'startup',
+          startup_ms: Math.round(now - (this._startAt ?? now)),
+          bitrate: this._bitrate
+        });
+      }
+      this._endRebuffer(now);
+      this._playingSince = now;
+    });
+    video.addEventListener('waiting', () => {
+      this._accumulateWatch();
+      if (this._started && !video.seeking) {
+        this._waitingSince = performance.now();
+      }
+    });
+    video.addEventListener('seeking', () => {
+      this._accumulateWatch();
+      this._waitingSince = null;
+    });
+    video.addEventListener('pause', () => {
+      this._accumulateWatch();
+      this._endRebuffer(performance.now());
+    });
+    video.addEventListener('ended', () => this._accumulateWatch());
+
+    hls.on(Hls.Events.FRAG_LOADED, (_, data) => {
+      try {
+        this.cdnHost = new URL(data.frag.url).host;
+      } catch (e) {
+        // 切片地址无法解析时保留上一个域名
+      }
+    });
+    hls.on(Hls.Events.LEVEL_SWITCHED, (_, data) => {
+      const bitrate = hls.levels[data.level]?.bitrate || 0;
+      if (!bitrate || bitrate === this._bitrate) return;
+      // 起播前的切换只记录起播码率
+      if (this._started) {
+        this._push({ type: 'bitrate_switch', bitrate });
+      }
+      this._bitrate = bitrate;
+    });
+    hls.on(Hls.Events.ERROR, (_, data) => {
+      if (!data.fatal) return;
+      this.reportError(`${data.type}: ${data.details}`);
+    });
+  }
+
+  /**
+   * 记录不可恢复的播放失败
+   * @param {string} message - 错误描述
+   */
+  reportError(message) {
+    this._push({ type: 'error', error: message });
+  }
+
+  /**
+   * 记录事件，达到每次上报的最大事件数时立即上报
+   * @private
+   * @param {Object} event - 事件
+   */
+  _push(event) {
+    this.events.push({ ...event, cdn_host: this.cdnHost });
+    if (this.events.length >= CONFIG.QOE.MAX_EVENTS) {
+      this.flush();
+    }
+  }
+
+  /**
+   * 卡顿结束，记录卡顿时长
+   * @private
+   * @param {number} now - 当前时间
+   */
+  _endRebuffer(now) {
+    if (this._waitingSince === null) return;
+    const durationMs = Math.round(now - this._waitingSince);
+    this._waitingSince = null;
+    if (durationMs > 0) {
+      this._push({ type: 'rebuffer', duration_ms: durationMs });
+    }
+  }
+
+  /**
+   * 累加播放中的时长，暂停、缓冲、拖动和上报时调用
+   * @private
+   */
+  _accumulateWatch() {
+    if (this._playingSince === null) return;
+    const now = performance.now();
+    this._watchMs += now - this._playingSince;
+    this._playingSince = null;
+  }
+
+  /**
+   * 上报已记录的事件和播放时长
+   * sendBeacon 在页面关闭时也能发出请求，以 text/plain 发送不需要 CORS 预检
+   */
+  flush() {
+    const playing = this._playingSince !== null;
+    this._accumulateWatch();
+    if (playing) this._playingSince = performance.now();
+    const watchMs = Math.round(this._watchMs);
+    if (watchMs > 0) {
+      this.events.push({ type: 'watch', duration_ms: watchMs, cdn_host: this.cdnHost });
+      this._watchMs = 0;
+    }
+    if (this.events.length === 0) return;
+
+    const body = JSON.stringify({ video_id: this.videoId, cdn_host: this.cdnHost, events: this.events });
+    this.events = [];
+    const sent = navigator.sendBeacon?.(this.beaconUrl, new Blob([body], { type: 'text/plain' }));
+    if (!sent) {
+      fetch(this.beaconUrl, { method: 'POST', body, keepalive: true }).catch(() => {});
+    }
+  }
+
+  /**
+   * 上报剩余的事件并停止采集
+   */
+  destroy() {
+    clearInterval(this._timer);
+    window.removeEventListener('pagehide', this._onPageHide);
+    this.flush();
+  }
+}
+
 // ==================== Playlist Loader ====================
 
 /**
@@ -275,12 +652,19 @@ class CinePlayer {
    * 创建 CinePlayer 实例
    * @param {Object} [options={}] - 配置选项
    * @param {Object} [options.dpPlayerConfig={}] - DPlayer 默认配置，会与 init 时的配置合并
+   * @param {Function} [options.onTrial] - 没有播放权限、播放的是试看内容时回调，参数为试看范围
+   * @param {Function} [options.onStreamLimit] - 同时播放的设备数已达上限时回调（播放已暂停），参数为服务端的提示信息
+   * @param {boolean} [options.resume=true] - 是否从上次观看的位置续播（已看完的视频从头播放）
+   * @param {number} [options.vodId] - 影片 ID，随观看进度上报，用于继续观看列表；不传时使用 c3u8 地址中的 vod_id 参数
+   * @param {boolean} [options.qoe=true] - 是否上报播放质量（服务端没有开启时上报会被忽略）
    */
   constructor(options = {}) {
     this._checkCompatibility();
 
     this.options = {
       dpPlayerConfig: {},
+      resume: true,
+      qoe: true,
       ...options
     };
 
@@ -290,6 +674,9 @@ class CinePlayer {
     /** @type {Hls|null} HLS.js 实例 */
     this.hls = null;
 
+    /** @type {Object|null} 试看范围，正常播放时为 null */
+    this.trial = null;
+
     /** @type {string|null} 内存中的 m3u8 内容 */
     this.m3u8Content = null;
 
@@ -298,6 +685,21 @@ class CinePlayer {
 
     /** @private 依赖库是否已加载 */
     this._dependenciesLoaded = false;
+
+    /** @private 播放心跳地址，非 c3u8 播放时为 null */
+    this._heartbeatUrl = null;
+
+    /** @private 心跳定时器 */
+    this._heartbeatTimer = null;
+
+    /** @private 随观看进度上报的影片 ID */
+    this._vodId = 0;
+
+    /** @private 当前的播放密钥 token，心跳时刷新，请求密钥时替换地址中的 token */
+    this._keyToken = null;
+
+    /** @private 播放质量采集，非 c3u8 播放或关闭上报时为 null */
+    this._qoe = null;
   }
 
   // ==================== 私有方法 ====================
@@ -333,6 +735,144 @@ class CinePlayer {
     });
   }
 
+  /**
+   * 开始发送播放心跳，续期当前设备的播放会话
+   * @private
+   * @param {string} url - c3u8 地址
+   */
+  _startHeartbeat(url) {
+    this._heartbeatUrl = buildPlayApiUrl(url, 'heartbeat');
+    if (!this._heartbeatUrl) return;
+    this._vodId = Number(this.options.vodId || new URL(url, window.location.href).searchParams.get('vod_id')) || 0;
+    this._scheduleHeartbeat(CONFIG.SESSION.HEARTBEAT_INTERVAL);
+    // 暂停时立即上报，保存准确的观看进度
+    this.player.video.addEventListener('pause', () => {
+      if (this._heartbeatUrl) this._sendHeartbeat();
+    });
+  }
+
+  /**
+   * 心跳请求体：当前播放位置、时长和影片 ID
+   * @private
+   * @param {boolean} stopped - 是否播放结束
+   * @returns {string} JSON 请求体
+   */
+  _heartbeatBody(stopped) {
+    return JSON.stringify({
+      stopped,
+      position: this.currentTime,
+      duration: Number.isFinite(this.duration) ? this.duration : 0,
+      vod_id: this._vodId,
+      key_token: this._keyToken || ''
+    });
+  }
+
+  /**
+   * 请求密钥时把地址中的 token 换成心跳刷新的 token
+   * 点播 m3u8 只加载一次，密钥地址中的 token 有效期很短
+   * @private
+   * @param {XMLHttpRequest} xhr - HLS.js 的请求
+   * @param {string} url - 请求地址
+   */
+  _setupKeyRequest(xhr, url) {
+    if (!this._keyToken || !url.includes('/play/key/')) return;
+    const keyUrl = new URL(url, window.location.href);
+    keyUrl.searchParams.set('token', this._keyToken);
+    xhr.open('GET', keyUrl.toString(), true);
+  }
+
+  /**
+   * 从上次观看的位置续播，没有观看记录或已看完时从头播放
+   * @private
+   * @param {string} url - c3u8 地址
+   */
+  async _resumeProgress(url) {
+    const progressUrl = buildPlayApiUrl(url, 'progress');
+    if (!progressUrl) return;
+    try {
+      const response = await fetch(progressUrl);
+      const data = await response.json();
+      const progress = data?.code === 0 ? data.data : null;
+      if (!progress || progress.position <= 0 || progress.finished) return;
+      const video = this.player?.video;
+      if (!video) return;
+      // 元数据加载完成后才能跳转
+      if (video.readyState >= 1) {
+        this.seek(progress.position);
+      } else {
+        video.addEventListener('loadedmetadata', () => this.seek(progress.position), { once: true });
+      }
+    } catch (e) {
+      console.warn('[CinePlayer] Load progress failed:', e);
+    }
+  }
+
+  /**
+   * 安排下一次心跳
+   * @private
+   * @param {number} interval - 间隔（秒）
+   */
+  _scheduleHeartbeat(interval) {
+    clearTimeout(this._heartbeatTimer);
+    this._heartbeatTimer = setTimeout(() => this._sendHeartbeat(), interval * 1000);
+  }
+
+  /**
+   * 发送心跳；暂停时也发送，暂停后继续播放不需要重新占用设备名额
+   * 设备数已达上限时暂停播放并回调 onStreamLimit，网络错误时按默认间隔重试
+   * @private
+   */
+  async _sendHeartbeat() {
+    let interval = CONFIG.SESSION.HEARTBEAT_INTERVAL;
+    try {
+      const response = await fetch(this._heartbeatUrl, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: this._heartbeatBody(false)
+      });
+      const data = await response.json().catch(() => null);
+      if (data?.code === CONFIG.SESSION.STREAM_LIMIT_CODE) {
+        // 停止心跳，暂停触发的上报不再发送
+        clearTimeout(this._heartbeatTimer);
+        this._heartbeatUrl = null;
+        this.pause();
+        if (typeof this.options.onStreamLimit === 'function') {
+          this.options.onStreamLimit(data.message);
+        }
+        return;
+      }
+      if (data?.code === 0 && data.data?.interval > 0) {
+        interval = data.data.interval;
+      }
+      if (data?.code === 0 && data.data?.key_token) {
+        this._keyToken = data.data.key_token;
+      }
+    } catch (e) {
+      console.warn('[CinePlayer] Heartbeat failed:', e);
+    }
+    if (this._heartbeatUrl) {
+      this._scheduleHeartbeat(interval);
+    }
+  }
+
+  /**
+   * 停止心跳，保存观看进度并释放当前设备的播放会话
+   * @private
+   */
+  _stopHeartbeat() {
+    clearTimeout(this._heartbeatTimer);
+    this._heartbeatTimer = null;
+    if (!this._heartbeatUrl) return;
+    // keepalive 保证页面关闭时请求仍能发出
+    fetch(this._heartbeatUrl, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: this._heartbeatBody(true),
+      keepalive: true
+    }).catch(() => {});
+    this._heartbeatUrl = null;
+  }
+
   /**
    * 加载 DPlayer 和 HLS.js 依赖库
    * @private
@@ -373,9 +913,11 @@ class CinePlayer {
     // ts 分片使用 HLS.js 默认 loader，保证最佳性能
     this.hls = new Hls({
       pLoader: createPlaylistLoader(this),
+      xhrSetup: (xhr, requestUrl) => this._setupKeyRequest(xhr, requestUrl),
       debug: false
     });
 
+    this._qoe?.attach(video, this.hls);
     this.hls.attachMedia(video);
 
     this.hls.on(Hls.Events.MEDIA_ATTACHED, () => {
@@ -418,6 +960,9 @@ class CinePlayer {
    */
   loadM3u8Content(content) {
     this.m3u8Content = content;
+    // 密钥地址中的 token，正常播放时由心跳刷新
+    const keyToken = /#EXT-X-KEY:[^\n]*\/play\/key\/[^"\n]*[?&]token=([^&"\n]*)/.exec(content)?.[1];
+    this._keyToken = keyToken ? decodeURIComponent(keyToken) : null;
 
     // 通知等待中的 PlaylistLoader
     if (this._m3u8ReadyResolve) {
@@ -468,6 +1013,13 @@ class CinePlayer {
     }
 
     // 如果是加密协议 URL，自动解析并加载
+    if (this.options.qoe) {
+      const beacon = buildQoEBeaconUrl(videoUrl);
+      if (beacon) {
+        const autoplay = Boolean(dpOptions.autoplay ?? this.options.dpPlayerConfig.autoplay);
+        this._qoe = new QoECollector(beacon.beaconUrl, beacon.videoId, autoplay);
+      }
+    }
     const placeholderUrl = 'memory://playlist.m3u8'; // 使用占位 URL，实际内容从内存读取
     this.player = new DPlayer({
       ...this.options.dpPlayerConfig,
@@ -482,8 +1034,29 @@ class CinePlayer {
       }
     });
     // 使用私密协议解开
-    const m3u8Content = await ProtocolModule.parse(videoUrl);
-    this.loadM3u8Content(m3u8Content);
+    let parsed;
+    try {
+      parsed = await ProtocolModule.parse(videoUrl);
+    } catch (e) {
+      this._qoe?.reportError(`c3u8: ${e.message}`);
+      if (e.code === CONFIG.SESSION.STREAM_LIMIT_CODE && typeof this.options.onStreamLimit === 'function') {
+        this.options.onStreamLimit(e.message);
+      }
+      throw e;
+    }
+    const { content, trial } = parsed;
+    this.trial = trial;
+    // 试看时通知业务方展示购买提示；正常播放时发送心跳（试看不限制设备数）
+    if (trial && typeof this.options.onTrial === 'function') {
+      this.options.onTrial(trial);
+    }
+    if (!trial) {
+      this._startHeartbeat(videoUrl);
+      if (this.options.resume) {
+        this._resumeProgress(videoUrl);
+      }
+    }
+    this.loadM3u8Content(content);
     return this.player;
   }
 
@@ -539,6 +1112,13 @@ class CinePlayer {
    * 销毁后实例不可再使用
    */
   destroy() {
+    this._stopHeartbeat();
+
+    if (this._qoe) {
+      this._qoe.destroy();
+      this._qoe = null;
+    }
+
     if (this.hls) {
       this.hls.destroy();
       this.hls = null;
@@ -551,6 +1131,7 @@ class CinePlayer {
 
     this.m3u8Content = null;
     this._m3u8ReadyResolve = null;
+    this._keyToken = null;
   }
 
   /**
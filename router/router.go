@@ -21,13 +21,57 @@ var (
 		{group: "/video_ts", relativePath: "/save", method: http.MethodPost, controllerHandle: controller.VideoTsSave},
 		{group: "/video_ts", relativePath: "/list", method: http.MethodGet, controllerHandle: controller.VideoTsList},
 
+		// 字幕相关
+		{group: "/video_subtitle", relativePath: "/save", method: http.MethodPost, controllerHandle: controller.VideoSubtitleSave},
+		{group: "/video_subtitle", relativePath: "/upload", method: http.MethodPost, controllerHandle: controller.VideoSubtitleUpload},
+		{group: "/video_subtitle", relativePath: "/list", method: http.MethodGet, controllerHandle: controller.VideoSubtitleList},
+
+		// 音轨相关
+		{group: "/video_audio", relativePath: "/save", method: http.MethodPost, controllerHandle: controller.VideoAudioSave},
+		{group: "/video_audio", relativePath: "/list", method: http.MethodGet, controllerHandle: controller.VideoAudioList},
+
+		// 缩略图相关
+		{group: "/video_thumbnail", relativePath: "/save", method: http.MethodPost, controllerHandle: controller.VideoThumbnailSave},
+		{group: "/video_thumbnail", relativePath: "/list", method: http.MethodGet, controllerHandle: controller.VideoThumbnailList},
+
+		// 广告相关
+		{group: "/ad_pod", relativePath: "/save", method: http.MethodPost, controllerHandle: controller.AdPodSave},
+		{group: "/ad_pod", relativePath: "/list", method: http.MethodGet, controllerHandle: controller.AdPodList},
+
+		// 直播相关
+		{group: "/live", relativePath: "/start", method: http.MethodPost, controllerHandle: controller.VideoLiveStart},
+		{group: "/live", relativePath: "/append", method: http.MethodPost, controllerHandle: controller.VideoLiveAppend},
+		{group: "/live", relativePath: "/finalize", method: http.MethodPost, controllerHandle: controller.VideoLiveFinalize},
+
 		// 播放相关
 		{group: "/play", relativePath: "/:video_id", method: http.MethodGet, controllerHandle: controller.Play},
 		{group: "/play", relativePath: "/:video_id/index.m3u8", method: http.MethodGet, controllerHandle: controller.PlayHlsIndexM3u8},
+		{group: "/play", relativePath: "/:video_id/:definition/index.m3u8", method: http.MethodGet, controllerHandle: controller.PlayHlsIndexM3u8},
+		{group: "/play", relativePath: "/:video_id/:definition/iframe.m3u8", method: http.MethodGet, controllerHandle: controller.PlayHlsIFrameM3u8},
+		{group: "/play", relativePath: "/:video_id/subtitle/:subtitle_id/index.m3u8", method: http.MethodGet, controllerHandle: controller.PlaySubtitleM3u8},
+		{group: "/play", relativePath: "/:video_id/subtitle/:subtitle_id/:segment", method: http.MethodGet, controllerHandle: controller.PlaySubtitleSegment},
+		{group: "/play", relativePath: "/:video_id/thumbnails.vtt", method: http.MethodGet, controllerHandle: controller.PlayThumbnailVTT},
+		{group: "/play", relativePath: "/:video_id/manifest.mpd", method: http.MethodGet, controllerHandle: controller.PlayDashManifest},
+		{group: "/play", relativePath: "/:video_id/seg/:seq", method: http.MethodGet, controllerHandle: controller.PlaySegment},
+		{group: "/play", relativePath: "/:video_id/heartbeat", method: http.MethodPost, controllerHandle: controller.PlayHeartbeat},
+		{group: "/play", relativePath: "/:video_id/progress", method: http.MethodGet, controllerHandle: controller.PlayProgress},
 		{group: "/play", relativePath: "/key/:video_id", method: http.MethodGet, controllerHandle: controller.PlayHlsIndexEncKey},
 
 		// cine 播放器私有协议
 		{group: "/play", relativePath: "/:video_id/index.c3u8", method: http.MethodGet, controllerHandle: controller.PlayCineHlsIndexC3u8},
+		{group: "/play", relativePath: "/:video_id/:definition/index.c3u8", method: http.MethodGet, controllerHandle: controller.PlayCineHlsIndexC3u8},
+
+		// CDN 调度
+		{group: "/cdn", relativePath: "/list", method: http.MethodGet, controllerHandle: controller.CDNList},
+		{group: "/cdn", relativePath: "/status", method: http.MethodPost, controllerHandle: controller.CDNStatus},
+
+		// A/B 水印
+		{group: "/watermark", relativePath: "/decode", method: http.MethodPost, controllerHandle: controller.WatermarkDecode},
+		{group: "/watch", relativePath: "/continue", method: http.MethodGet, controllerHandle: controller.WatchContinueList},
+
+		// 播放质量
+		{group: "/qoe", relativePath: "/beacon", method: http.MethodPost, controllerHandle: controller.QoEBeacon},
+		{group: "/qoe", relativePath: "/report", method: http.MethodGet, controllerHandle: controller.QoEReport},
 
 		// 资源站点接口
 		{group: "/provide", relativePath: "/json", method: http.MethodGet, controllerHandle: controller.ProvideIndex},
@@ -50,7 +94,7 @@ func Init() {
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowCredentials = true
 	corsConfig.AllowAllOrigins = true // 如果需要限制域名，可以改为 AllowOrigins
-	corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", "Cookie"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", "Cookie", "X-Device-ID"}
 	corsConfig.ExposeHeaders = []string{"Content-Length", "Content-Range"}
 	GinEngine.Use(cors.New(corsConfig))
 	// 使用 logger 中间件
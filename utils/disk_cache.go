@@ -0,0 +1,187 @@
+package utils
+
+import (
+	"container/list"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrDiskCacheTooLarge 写入的文件超过单个文件的大小限制
+var ErrDiskCacheTooLarge = errors.New("文件超过缓存大小限制")
+
+// diskCacheTempPrefix 写入中的临时文件前缀，启动时清理
+const diskCacheTempPrefix = ".tmp-"
+
+// DiskCache 并发安全的磁盘文件 LRU 缓存，总大小超过限制时淘汰最久未使用的文件
+// key 作为文件名，调用方需要保证只包含文件名可用的字符（如 hash 的 hex）
+type DiskCache struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64
+	size     int64
+	items    map[string]*list.Element
+	order    *list.List // 最近使用的在前
+}
+
+// diskCacheEntry 磁盘缓存中的一个文件
+type diskCacheEntry struct {
+	key  string
+	size int64
+}
+
+// NewDiskCache 创建磁盘缓存，加载目录中已有的文件（按修改时间排列使用顺序）
+func NewDiskCache(dir string, maxBytes int64) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	c := &DiskCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+
+	type cachedFile struct {
+		key     string
+		size    int64
+		modTime int64
+	}
+	var files []cachedFile
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		// 上次退出时没有写完的临时文件
+		if strings.HasPrefix(entry.Name(), diskCacheTempPrefix) {
+			_ = os.Remove(path)
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, cachedFile{key: entry.Name(), size: info.Size(), modTime: info.ModTime().UnixNano()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime > files[j].modTime
+	})
+	for _, file := range files {
+		c.items[file.key] = c.order.PushBack(&diskCacheEntry{key: file.key, size: file.size})
+		c.size += file.size
+	}
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+	return c, nil
+}
+
+// path 缓存文件路径，按 key 前两位分子目录，避免单个目录文件过多
+func (c *DiskCache) path(key string) string {
+	if len(key) < 2 {
+		return filepath.Join(c.dir, key)
+	}
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// Open 打开缓存的文件，不存在时返回 false；调用方负责关闭文件
+func (c *DiskCache) Open(key string) (*os.File, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	file, err := os.Open(c.path(key))
+	if err != nil {
+		// 文件被外部删除
+		c.removeElement(element)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return file, true
+}
+
+// Store 把 reader 的内容写入缓存，超过 maxFileSize 时返回 ErrDiskCacheTooLarge 且不缓存
+// 先写临时文件再改名，读取方不会看到写了一半的文件
+func (c *DiskCache) Store(key string, reader io.Reader, maxFileSize int64) error {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tempFile, err := os.CreateTemp(filepath.Dir(path), diskCacheTempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+
+	size, err := io.Copy(tempFile, io.LimitReader(reader, maxFileSize+1))
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if size > maxFileSize {
+		return ErrDiskCacheTooLarge
+	}
+	if err = os.Rename(tempFile.Name(), path); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.items[key]; ok {
+		entry := element.Value.(*diskCacheEntry)
+		c.size += size - entry.size
+		entry.size = size
+		c.order.MoveToFront(element)
+	} else {
+		c.items[key] = c.order.PushFront(&diskCacheEntry{key: key, size: size})
+		c.size += size
+	}
+	c.evict()
+	return nil
+}
+
+// Delete 删除缓存的文件
+func (c *DiskCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.items[key]; ok {
+		c.removeElement(element)
+	}
+}
+
+// Size 缓存文件的总大小（字节）
+func (c *DiskCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// evict 淘汰最久未使用的文件直到总大小不超过限制，调用方需持有锁
+// 已经打开的文件删除后仍然可以读完
+func (c *DiskCache) evict() {
+	for c.size > c.maxBytes && c.order.Len() > 0 {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// removeElement 删除条目和文件，调用方需持有锁
+func (c *DiskCache) removeElement(element *list.Element) {
+	entry := element.Value.(*diskCacheEntry)
+	c.order.Remove(element)
+	delete(c.items, entry.key)
+	c.size -= entry.size
+	_ = os.Remove(c.path(entry.key))
+}
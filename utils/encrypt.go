@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"crypto/hmac"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
 )
@@ -65,3 +67,10 @@ func (encrypt *encrypt) HashMD5Bytes(data []byte) string {
 	hash.Write(data)
 	return hex.EncodeToString(hash.Sum(nil))
 }
+
+// HmacSHA256 HMAC-SHA256 签名
+func (encrypt *encrypt) HmacSHA256(data, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
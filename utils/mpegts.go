@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"errors"
+)
+
+const (
+	tsPacketSize = 188  // MPEG-TS 包大小
+	tsSyncByte   = 0x47 // MPEG-TS 同步字节
+	tsPTSWrap    = int64(1) << 33
+)
+
+// TSKeyframe TS 切片中的一个关键帧（随机访问点）
+type TSKeyframe struct {
+	ByteOffset int64 // 关键帧 PES 第一个包在切片中的偏移
+	ByteLength int64 // 关键帧 PES 占用的字节数（到视频的下一个 PES 为止）
+	PTS        int64 // 关键帧的 PTS（90kHz），没有 PTS 时为 -1
+}
+
+// TSScanResult 扫描 TS 切片的结果
+type TSScanResult struct {
+	Keyframes []TSKeyframe
+	FirstPTS  int64 // 视频第一个 PES 的 PTS（90kHz），没有时为 -1
+}
+
+// KeyframeTimeOffset 关键帧相对切片开始的时间（秒），没有 PTS 时返回 0
+func (r *TSScanResult) KeyframeTimeOffset(keyframe TSKeyframe) float64 {
+	if keyframe.PTS < 0 || r.FirstPTS < 0 {
+		return 0
+	}
+	// PTS 为 33 位，跨越回绕时补上一个周期
+	diff := (keyframe.PTS - r.FirstPTS + tsPTSWrap) % tsPTSWrap
+	return float64(diff) / 90000
+}
+
+// ScanTSKeyframes 扫描 TS 切片，按 PAT/PMT 找到视频 PID，
+// 以 adaptation field 中 random_access_indicator 置位且是 PES 起始的包作为关键帧
+func ScanTSKeyframes(data []byte) (*TSScanResult, error) {
+	if len(data) < tsPacketSize || data[0] != tsSyncByte {
+		return nil, errors.New("不是 MPEG-TS 数据")
+	}
+	result := &TSScanResult{FirstPTS: -1}
+	pmtPID, videoPID := -1, -1
+	current := -1 // 正在统计长度的关键帧下标
+
+	packetCount := len(data) / tsPacketSize
+	for i := 0; i < packetCount; i++ {
+		offset := i * tsPacketSize
+		packet := data[offset : offset+tsPacketSize]
+		if packet[0] != tsSyncByte {
+			return nil, errors.New("MPEG-TS 同步字节错误")
+		}
+		pusi := packet[1]&0x40 != 0
+		pid := int(packet[1]&0x1F)<<8 | int(packet[2])
+		adaptationControl := (packet[3] >> 4) & 0x03
+		payloadStart := 4
+		randomAccess := false
+		if adaptationControl == 2 || adaptationControl == 3 {
+			adaptationLength := int(packet[4])
+			if adaptationLength > 0 {
+				randomAccess = packet[5]&0x40 != 0
+			}
+			payloadStart = 5 + adaptationLength
+		}
+		if adaptationControl == 2 || payloadStart >= tsPacketSize {
+			continue
+		}
+		payload := packet[payloadStart:]
+
+		switch {
+		case pid == 0 && pusi && pmtPID < 0:
+			pmtPID = parsePATProgramMapPID(payload)
+		case pid == pmtPID && pusi && videoPID < 0:
+			videoPID = parsePMTVideoPID(payload)
+		case pid == videoPID && pusi:
+			// 视频新的 PES 开始，上一个关键帧到此结束
+			if current >= 0 {
+				result.Keyframes[current].ByteLength = int64(offset) - result.Keyframes[current].ByteOffset
+				current = -1
+			}
+			pts := parsePESPTS(payload)
+			if result.FirstPTS < 0 {
+				result.FirstPTS = pts
+			}
+			if randomAccess {
+				result.Keyframes = append(result.Keyframes, TSKeyframe{ByteOffset: int64(offset), PTS: pts})
+				current = len(result.Keyframes) - 1
+			}
+		}
+	}
+	if current >= 0 {
+		result.Keyframes[current].ByteLength = int64(packetCount*tsPacketSize) - result.Keyframes[current].ByteOffset
+	}
+	if videoPID < 0 {
+		return nil, errors.New("MPEG-TS 中没有找到视频流")
+	}
+	return result, nil
+}
+
+// parsePATProgramMapPID 解析 PAT，返回第一个节目的 PMT PID
+func parsePATProgramMapPID(payload []byte) int {
+	section := psiSection(payload)
+	// table_id(1) section_length(2) transport_stream_id(2) version(1) section_number(1) last_section_number(1)
+	if len(section) < 12 || section[0] != 0x00 {
+		return -1
+	}
+	sectionLength := int(section[1]&0x0F)<<8 | int(section[2])
+	end := 3 + sectionLength - 4 // 去掉 CRC32
+	if end > len(section) {
+		end = len(section)
+	}
+	for i := 8; i+4 <= end; i += 4 {
+		programNumber := int(section[i])<<8 | int(section[i+1])
+		if programNumber == 0 {
+			continue // network PID
+		}
+		return int(section[i+2]&0x1F)<<8 | int(section[i+3])
+	}
+	return -1
+}
+
+// parsePMTVideoPID 解析 PMT，返回第一个视频流的 PID
+func parsePMTVideoPID(payload []byte) int {
+	section := psiSection(payload)
+	if len(section) < 12 || section[0] != 0x02 {
+		return -1
+	}
+	sectionLength := int(section[1]&0x0F)<<8 | int(section[2])
+	end := 3 + sectionLength - 4
+	if end > len(section) {
+		end = len(section)
+	}
+	programInfoLength := int(section[10]&0x0F)<<8 | int(section[11])
+	for i := 12 + programInfoLength; i+5 <= end; {
+		streamType := section[i]
+		elementaryPID := int(section[i+1]&0x1F)<<8 | int(section[i+2])
+		esInfoLength := int(section[i+3]&0x0F)<<8 | int(section[i+4])
+		switch streamType {
+		case 0x01, 0x02, 0x10, 0x1B, 0x24: // MPEG-1/2、MPEG-4、H.264、H.265
+			return elementaryPID
+		}
+		i += 5 + esInfoLength
+	}
+	return -1
+}
+
+// psiSection 跳过 pointer_field 返回 PSI 表数据
+func psiSection(payload []byte) []byte {
+	if len(payload) == 0 {
+		return nil
+	}
+	pointer := int(payload[0])
+	if 1+pointer >= len(payload) {
+		return nil
+	}
+	return payload[1+pointer:]
+}
+
+// parsePESPTS 解析 PES 头中的 PTS，没有时返回 -1
+func parsePESPTS(payload []byte) int64 {
+	// packet_start_code_prefix(3) stream_id(1) PES_packet_length(2) flags(2) header_data_length(1)
+	if len(payload) < 14 || payload[0] != 0 || payload[1] != 0 || payload[2] != 1 {
+		return -1
+	}
+	if payload[7]&0x80 == 0 {
+		return -1
+	}
+	p := payload[9:14]
+	return int64(p[0]>>1&0x07)<<30 | int64(p[1])<<22 | int64(p[2]>>1)<<15 | int64(p[3])<<7 | int64(p[4]>>1)
+}
@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+const (
+	testPMTPID   = 0x100
+	testVideoPID = 0x101
+	testAudioPID = 0x102
+)
+
+// testTSPacket 生成一个 188 字节的 TS 包，randomAccess 时带 adaptation field 并置位 random_access_indicator
+func testTSPacket(pid int, pusi, randomAccess bool, payload []byte) []byte {
+	packet := make([]byte, 0, tsPacketSize)
+	pusiBit := byte(0)
+	if pusi {
+		pusiBit = 0x40
+	}
+	packet = append(packet, tsSyncByte, pusiBit|byte(pid>>8&0x1F), byte(pid))
+	if randomAccess {
+		packet = append(packet, 0x30, 1, 0x40)
+	} else {
+		packet = append(packet, 0x10)
+	}
+	packet = append(packet, payload...)
+	for len(packet) < tsPacketSize {
+		packet = append(packet, 0xFF)
+	}
+	return packet[:tsPacketSize]
+}
+
+// testPATPacket PAT：节目 1 的 PMT PID 为 testPMTPID
+func testPATPacket() []byte {
+	section := []byte{0x00, 0xB0, 13, 0x00, 0x01, 0xC1, 0x00, 0x00,
+		0x00, 0x01, 0xE0 | testPMTPID>>8, testPMTPID & 0xFF,
+		0, 0, 0, 0}
+	return testTSPacket(0, true, false, append([]byte{0}, section...))
+}
+
+// testPMTPacket PMT：一路 AAC 音频和一路 streamType 的视频
+func testPMTPacket(streamType byte) []byte {
+	section := []byte{0x02, 0xB0, 23, 0x00, 0x01, 0xC1, 0x00, 0x00,
+		0xE0 | testVideoPID>>8, testVideoPID & 0xFF, 0xF0, 0x00,
+		0x0F, 0xE0 | testAudioPID>>8, testAudioPID & 0xFF, 0xF0, 0x00,
+		streamType, 0xE0 | testVideoPID>>8, testVideoPID & 0xFF, 0xF0, 0x00,
+		0, 0, 0, 0}
+	return testTSPacket(testPMTPID, true, false, append([]byte{0}, section...))
+}
+
+// testPESHeader 视频 PES 头，pts 小于 0 时不带 PTS
+func testPESHeader(pts int64) []byte {
+	if pts < 0 {
+		return []byte{0, 0, 1, 0xE0, 0, 0, 0x80, 0x00, 0}
+	}
+	return []byte{0, 0, 1, 0xE0, 0, 0, 0x80, 0x80, 5,
+		byte(0x21 | pts>>29&0x0E), byte(pts >> 22), byte(pts>>14 | 1), byte(pts >> 7), byte(pts<<1 | 1)}
+}
+
+// testTS 拼接 TS 包
+func testTS(packets ...[]byte) []byte {
+	var data []byte
+	for _, packet := range packets {
+		data = append(data, packet...)
+	}
+	return data
+}
+
+func TestScanTSKeyframes(t *testing.T) {
+	video := func(pts int64, randomAccess bool) []byte {
+		return testTSPacket(testVideoPID, true, randomAccess, testPESHeader(pts))
+	}
+	continuation := testTSPacket(testVideoPID, false, false, nil)
+	audio := testTSPacket(testAudioPID, true, true, testPESHeader(1000))
+	const p = int64(tsPacketSize)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    *TSScanResult
+		wantErr bool
+	}{
+		{
+			name: "两个关键帧，长度到视频的下一个 PES",
+			data: testTS(testPATPacket(), testPMTPacket(0x1B),
+				video(90000, true), continuation, audio, video(93000, false),
+				video(270000, true), continuation),
+			want: &TSScanResult{
+				FirstPTS: 90000,
+				Keyframes: []TSKeyframe{
+					{ByteOffset: 2 * p, ByteLength: 3 * p, PTS: 90000},
+					{ByteOffset: 6 * p, ByteLength: 2 * p, PTS: 270000},
+				},
+			},
+		},
+		{
+			name: "音频的随机访问点不是关键帧，FirstPTS 取第一个有 PTS 的视频 PES，H.265 视频",
+			data: testTS(testPATPacket(), testPMTPacket(0x24), audio, video(-1, false), video(180000, true)),
+			want: &TSScanResult{
+				FirstPTS:  180000,
+				Keyframes: []TSKeyframe{{ByteOffset: 4 * p, ByteLength: p, PTS: 180000}},
+			},
+		},
+		{
+			name: "没有关键帧",
+			data: testTS(testPATPacket(), testPMTPacket(0x1B), video(90000, false)),
+			want: &TSScanResult{FirstPTS: 90000},
+		},
+		{
+			name:    "PMT 中没有视频流",
+			data:    testTS(testPATPacket(), testPMTPacket(0x0F), audio),
+			wantErr: true,
+		},
+		{
+			name:    "同步字节错误",
+			data:    testTS(testPATPacket(), append([]byte{0x00}, testPMTPacket(0x1B)[1:]...)),
+			wantErr: true,
+		},
+		{
+			name:    "不是 MPEG-TS 数据",
+			data:    []byte("#EXTM3U"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ScanTSKeyframes(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ScanTSKeyframes() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ScanTSKeyframes() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTSScanResultKeyframeTimeOffset(t *testing.T) {
+	tests := []struct {
+		name     string
+		firstPTS int64
+		pts      int64
+		want     float64
+	}{
+		{name: "第一个关键帧", firstPTS: 90000, pts: 90000, want: 0},
+		{name: "2 秒后", firstPTS: 90000, pts: 270000, want: 2},
+		{name: "PTS 回绕", firstPTS: tsPTSWrap - 45000, pts: 45000, want: 1},
+		{name: "关键帧没有 PTS", firstPTS: 90000, pts: -1, want: 0},
+		{name: "切片没有 PTS", firstPTS: -1, pts: 90000, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &TSScanResult{FirstPTS: tt.firstPTS}
+			if got := result.KeyframeTimeOffset(TSKeyframe{PTS: tt.pts}); got != tt.want {
+				t.Errorf("KeyframeTimeOffset() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
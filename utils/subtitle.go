@@ -0,0 +1,291 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// 字幕格式
+const (
+	SubtitleFormatSRT = "srt"
+	SubtitleFormatASS = "ass"
+)
+
+var (
+	srtTimingRegexp   = regexp.MustCompile(`^\s*(\d+:\d{1,2}:\d{1,2}[,.]\d{1,3})\s*-->\s*(\d+:\d{1,2}:\d{1,2}[,.]\d{1,3})`)
+	assOverrideRegexp = regexp.MustCompile(`\{[^}]*\}`)
+	assDrawingRegexp  = regexp.MustCompile(`\\p[1-9]`)
+	subtitleTagRegexp = regexp.MustCompile(`<(/?)([a-zA-Z]+)[^>]*>`)
+)
+
+// SubtitleCue 一条字幕
+type SubtitleCue struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string // WebVTT 的 cue 文本，只保留 <i> <b> <u> 标签
+}
+
+// DecodeSubtitleText 字幕文件转为 UTF-8 文本，支持 UTF-8（可带 BOM）和带 BOM 的 UTF-16，换行统一为 \n
+func DecodeSubtitleText(data []byte) (string, error) {
+	var text string
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		text = string(data[3:])
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}), bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		bigEndian := data[0] == 0xFE
+		data = data[2:]
+		units := make([]uint16, 0, len(data)/2)
+		for i := 0; i+1 < len(data); i += 2 {
+			if bigEndian {
+				units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+			} else {
+				units = append(units, uint16(data[i+1])<<8|uint16(data[i]))
+			}
+		}
+		text = string(utf16.Decode(units))
+	default:
+		text = string(data)
+	}
+	if !utf8.ValidString(text) {
+		return "", errors.New("字幕文件编码不是 UTF-8 或带 BOM 的 UTF-16")
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.ReplaceAll(text, "\r", "\n"), nil
+}
+
+// DetectSubtitleFormat 根据文件名和内容判断字幕格式
+func DetectSubtitleFormat(filename, text string) string {
+	switch strings.ToLower(strings.TrimPrefix(pathExt(filename), ".")) {
+	case SubtitleFormatSRT:
+		return SubtitleFormatSRT
+	case SubtitleFormatASS, "ssa":
+		return SubtitleFormatASS
+	}
+	if strings.HasPrefix(strings.TrimSpace(text), "[Script Info]") || strings.Contains(text, "\n[Events]") {
+		return SubtitleFormatASS
+	}
+	return SubtitleFormatSRT
+}
+
+// pathExt 返回文件扩展名（含 .）
+func pathExt(filename string) string {
+	if i := strings.LastIndex(filename, "."); i >= 0 {
+		return filename[i:]
+	}
+	return ""
+}
+
+// ParseSubtitle 按格式解析字幕，返回按开始时间排序的字幕列表
+func ParseSubtitle(format, text string) ([]SubtitleCue, error) {
+	var cues []SubtitleCue
+	var err error
+	switch format {
+	case SubtitleFormatSRT:
+		cues, err = ParseSRT(text)
+	case SubtitleFormatASS:
+		cues, err = ParseASS(text)
+	default:
+		return nil, fmt.Errorf("不支持的字幕格式: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(cues, func(i, j int) bool {
+		return cues[i].Start < cues[j].Start
+	})
+	return cues, nil
+}
+
+// ParseSRT 解析 SRT 字幕
+func ParseSRT(text string) ([]SubtitleCue, error) {
+	var cues []SubtitleCue
+	for _, block := range strings.Split(text, "\n\n") {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+		// 时间行之前可能有序号行
+		timingIndex := -1
+		for i, line := range lines {
+			if srtTimingRegexp.MatchString(line) {
+				timingIndex = i
+				break
+			}
+		}
+		if timingIndex < 0 {
+			continue
+		}
+		match := srtTimingRegexp.FindStringSubmatch(lines[timingIndex])
+		start, err := parseSubtitleTimestamp(match[1])
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseSubtitleTimestamp(match[2])
+		if err != nil {
+			return nil, err
+		}
+		cueText := cleanCueText(strings.Join(lines[timingIndex+1:], "\n"))
+		if end <= start || cueText == "" {
+			continue
+		}
+		cues = append(cues, SubtitleCue{Start: start, End: end, Text: cueText})
+	}
+	return cues, nil
+}
+
+// ParseASS 解析 ASS/SSA 字幕，样式和特效标签全部去掉，只保留文本
+func ParseASS(text string) ([]SubtitleCue, error) {
+	var cues []SubtitleCue
+	inEvents := false
+	var format []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			inEvents = strings.EqualFold(line, "[Events]")
+			continue
+		}
+		if !inEvents {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "Format":
+			format = nil
+			for _, field := range strings.Split(value, ",") {
+				format = append(format, strings.ToLower(strings.TrimSpace(field)))
+			}
+		case "Dialogue":
+			if len(format) == 0 {
+				return nil, errors.New("ASS 字幕缺少 [Events] 的 Format 行")
+			}
+			// Text 是最后一个字段，可以包含逗号
+			fields := strings.SplitN(value, ",", len(format))
+			if len(fields) < len(format) {
+				continue
+			}
+			values := make(map[string]string, len(format))
+			for i, field := range format {
+				values[field] = strings.TrimSpace(fields[i])
+			}
+			start, err := parseSubtitleTimestamp(values["start"])
+			if err != nil {
+				return nil, err
+			}
+			end, err := parseSubtitleTimestamp(values["end"])
+			if err != nil {
+				return nil, err
+			}
+			rawText := fields[len(format)-1]
+			// 绘图指令不是文本
+			if assDrawingRegexp.MatchString(strings.Join(assOverrideRegexp.FindAllString(rawText, -1), "")) {
+				continue
+			}
+			rawText = assOverrideRegexp.ReplaceAllString(rawText, "")
+			rawText = strings.NewReplacer(`\N`, "\n", `\n`, "\n", `\h`, " ").Replace(rawText)
+			cueText := cleanCueText(rawText)
+			if end <= start || cueText == "" {
+				continue
+			}
+			cues = append(cues, SubtitleCue{Start: start, End: end, Text: cueText})
+		}
+	}
+	return cues, nil
+}
+
+// parseSubtitleTimestamp 解析 SRT(00:00:01,000) 和 ASS(0:00:01.00) 的时间
+func parseSubtitleTimestamp(value string) (time.Duration, error) {
+	value = strings.Replace(strings.TrimSpace(value), ",", ".", 1)
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("字幕时间格式错误: %s", value)
+	}
+	hours, err1 := strconv.Atoi(parts[0])
+	minutes, err2 := strconv.Atoi(parts[1])
+	seconds, err3 := strconv.ParseFloat(parts[2], 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, fmt.Errorf("字幕时间格式错误: %s", value)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+		time.Duration(seconds*float64(time.Second)+0.5), nil
+}
+
+// cleanCueText 转为 WebVTT 的 cue 文本：只保留 <i> <b> <u>，其它标签去掉，特殊字符转义，去掉空行
+func cleanCueText(text string) string {
+	text = assOverrideRegexp.ReplaceAllString(text, "")
+	var builder strings.Builder
+	last := 0
+	for _, loc := range subtitleTagRegexp.FindAllStringSubmatchIndex(text, -1) {
+		builder.WriteString(escapeCueText(text[last:loc[0]]))
+		closing, name := text[loc[2]:loc[3]], strings.ToLower(text[loc[4]:loc[5]])
+		if name == "i" || name == "b" || name == "u" {
+			builder.WriteString("<" + closing + name + ">")
+		}
+		last = loc[1]
+	}
+	builder.WriteString(escapeCueText(text[last:]))
+
+	var lines []string
+	for _, line := range strings.Split(builder.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// escapeCueText 转义 WebVTT cue 文本中的特殊字符，cue 文本不能包含 -->
+func escapeCueText(text string) string {
+	text = strings.ReplaceAll(text, "-->", "->")
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// FormatWebVTTTimestamp 格式化 WebVTT 时间 00:00:01.000
+func FormatWebVTTTimestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// SplitSubtitleCues 按视频切片的时长（秒）切分按开始时间排序的字幕，
+// 跨越切片边界的字幕在两个切片中都输出（时间保持不变）
+func SplitSubtitleCues(cues []SubtitleCue, durations []float64) [][]SubtitleCue {
+	segmentCues := make([][]SubtitleCue, len(durations))
+	var segmentStart time.Duration
+	for i, duration := range durations {
+		segmentEnd := segmentStart + time.Duration(duration*float64(time.Second))
+		// 最后一个切片包含视频结束之后的字幕
+		last := i == len(durations)-1
+		for _, cue := range cues {
+			if cue.Start >= segmentEnd && !last {
+				break
+			}
+			if cue.End > segmentStart {
+				segmentCues[i] = append(segmentCues[i], cue)
+			}
+		}
+		segmentStart = segmentEnd
+	}
+	return segmentCues
+}
+
+// BuildWebVTT 生成 WebVTT 文件内容，mpegts 大于等于 0 时输出 X-TIMESTAMP-MAP（LOCAL 0 对应视频的 MPEG-TS 起始时间）
+func BuildWebVTT(cues []SubtitleCue, mpegts int64) string {
+	var builder strings.Builder
+	builder.WriteString("WEBVTT\n")
+	if mpegts >= 0 {
+		builder.WriteString(fmt.Sprintf("X-TIMESTAMP-MAP=MPEGTS:%d,LOCAL:00:00:00.000\n", mpegts))
+	}
+	for _, cue := range cues {
+		builder.WriteString("\n")
+		builder.WriteString(FormatWebVTTTimestamp(cue.Start) + " --> " + FormatWebVTTTimestamp(cue.End) + "\n")
+		builder.WriteString(cue.Text + "\n")
+	}
+	return builder.String()
+}
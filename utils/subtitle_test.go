@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSubtitle(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		text    string
+		want    []SubtitleCue
+		wantErr bool
+	}{
+		{
+			name:   "SRT 按开始时间排序",
+			format: SubtitleFormatSRT,
+			text: "2\n00:00:05,000 --> 00:00:06,000\n第二句\n\n" +
+				"1\n00:00:01,000 --> 00:00:02,500\n第一句\n",
+			want: []SubtitleCue{
+				{Start: time.Second, End: 2500 * time.Millisecond, Text: "第一句"},
+				{Start: 5 * time.Second, End: 6 * time.Second, Text: "第二句"},
+			},
+		},
+		{
+			name:   "SRT 只保留 i b u 标签并转义",
+			format: SubtitleFormatSRT,
+			text:   "1\n00:00:01,000 --> 00:00:02,000\n<font color=\"red\">A & B</font> <I>-->C</I>\n\n",
+			want: []SubtitleCue{
+				{Start: time.Second, End: 2 * time.Second, Text: "A &amp; B <i>-&gt;C</i>"},
+			},
+		},
+		{
+			name:   "SRT 跳过结束时间不大于开始时间和空文本的字幕",
+			format: SubtitleFormatSRT,
+			text: "1\n00:00:02,000 --> 00:00:01,000\n倒序\n\n" +
+				"2\n00:00:03,000 --> 00:00:04,000\n{\\an8}<font color=\"red\"></font>\n\n" +
+				"3\n00:00:05,000 --> 00:00:06,000\n保留\n",
+			want: []SubtitleCue{
+				{Start: 5 * time.Second, End: 6 * time.Second, Text: "保留"},
+			},
+		},
+		{
+			name:   "ASS 去掉样式标签，文本可以包含逗号",
+			format: SubtitleFormatASS,
+			text: "[Script Info]\nTitle: test\n\n[Events]\n" +
+				"Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n" +
+				"Dialogue: 0,0:00:03.00,0:00:04.00,Default,,0,0,0,,{\\an8\\pos(10,20)}上方{\\i1}斜体{\\i0}\\N第二行\n" +
+				"Dialogue: 0,0:00:01.50,0:00:02.00,Default,,0,0,0,,你好，世界,再见\n",
+			want: []SubtitleCue{
+				{Start: 1500 * time.Millisecond, End: 2 * time.Second, Text: "你好，世界,再见"},
+				{Start: 3 * time.Second, End: 4 * time.Second, Text: "上方斜体\n第二行"},
+			},
+		},
+		{
+			name:   "ASS 跳过绘图指令",
+			format: SubtitleFormatASS,
+			text: "[Events]\nFormat: Layer, Start, End, Style, Text\n" +
+				"Dialogue: 0,0:00:01.00,0:00:02.00,Default,{\\p1}m 0 0 l 100 0 100 100{\\p0}\n" +
+				"Dialogue: 0,0:00:01.00,0:00:02.00,Default,文本\\h空格\n",
+			want: []SubtitleCue{
+				{Start: time.Second, End: 2 * time.Second, Text: "文本 空格"},
+			},
+		},
+		{
+			name:    "ASS 缺少 Format 行",
+			format:  SubtitleFormatASS,
+			text:    "[Events]\nDialogue: 0,0:00:01.00,0:00:02.00,Default,文本\n",
+			wantErr: true,
+		},
+		{
+			name:    "不支持的格式",
+			format:  "vtt",
+			text:    "WEBVTT\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSubtitle(tt.format, tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSubtitle() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSubtitle() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitSubtitleCues(t *testing.T) {
+	cue := func(start, end float64) SubtitleCue {
+		return SubtitleCue{
+			Start: time.Duration(start * float64(time.Second)),
+			End:   time.Duration(end * float64(time.Second)),
+		}
+	}
+	tests := []struct {
+		name      string
+		cues      []SubtitleCue
+		durations []float64
+		want      [][]SubtitleCue
+	}{
+		{
+			name:      "字幕在切片内",
+			cues:      []SubtitleCue{cue(1, 2), cue(12, 13)},
+			durations: []float64{10, 10},
+			want:      [][]SubtitleCue{{cue(1, 2)}, {cue(12, 13)}},
+		},
+		{
+			name:      "跨越切片边界的字幕在两个切片中都输出",
+			cues:      []SubtitleCue{cue(9, 11), cue(19.5, 31)},
+			durations: []float64{10, 10, 10, 10},
+			want:      [][]SubtitleCue{{cue(9, 11)}, {cue(9, 11), cue(19.5, 31)}, {cue(19.5, 31)}, {cue(19.5, 31)}},
+		},
+		{
+			name:      "结束时间等于切片边界时只在前一个切片",
+			cues:      []SubtitleCue{cue(8, 10), cue(10, 12)},
+			durations: []float64{10, 10},
+			want:      [][]SubtitleCue{{cue(8, 10)}, {cue(10, 12)}},
+		},
+		{
+			name:      "视频结束之后的字幕放在最后一个切片",
+			cues:      []SubtitleCue{cue(1, 2), cue(25, 26)},
+			durations: []float64{10, 10},
+			want:      [][]SubtitleCue{{cue(1, 2)}, {cue(25, 26)}},
+		},
+		{
+			name:      "切片没有字幕",
+			cues:      []SubtitleCue{cue(21, 22)},
+			durations: []float64{10, 10, 10},
+			want:      [][]SubtitleCue{nil, nil, {cue(21, 22)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SplitSubtitleCues(tt.cues, tt.durations); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitSubtitleCues() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildWebVTT(t *testing.T) {
+	cues := []SubtitleCue{{Start: 3723456 * time.Millisecond, End: 3724 * time.Second, Text: "<i>你好</i>"}}
+	tests := []struct {
+		name   string
+		cues   []SubtitleCue
+		mpegts int64
+		want   string
+	}{
+		{
+			name:   "带 X-TIMESTAMP-MAP",
+			cues:   cues,
+			mpegts: 900000,
+			want:   "WEBVTT\nX-TIMESTAMP-MAP=MPEGTS:900000,LOCAL:00:00:00.000\n\n01:02:03.456 --> 01:02:04.000\n<i>你好</i>\n",
+		},
+		{
+			name:   "不输出 X-TIMESTAMP-MAP",
+			cues:   cues,
+			mpegts: -1,
+			want:   "WEBVTT\n\n01:02:03.456 --> 01:02:04.000\n<i>你好</i>\n",
+		},
+		{
+			name:   "没有字幕",
+			mpegts: -1,
+			want:   "WEBVTT\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BuildWebVTT(tt.cues, tt.mpegts); got != tt.want {
+				t.Errorf("BuildWebVTT() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeSubtitleText(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string
+		wantErr bool
+	}{
+		{name: "UTF-8 BOM 和 CRLF", data: []byte("\xEF\xBB\xBF第一行\r\n第二行\r"), want: "第一行\n第二行\n"},
+		{name: "UTF-16LE BOM", data: []byte{0xFF, 0xFE, 0x60, 0x4F, 0x7D, 0x59, 0x0D, 0x00, 0x0A, 0x00}, want: "你好\n"},
+		{name: "UTF-16BE BOM", data: []byte{0xFE, 0xFF, 0x4F, 0x60, 0x59, 0x7D}, want: "你好"},
+		{name: "不是 UTF-8", data: []byte{0xC4, 0xE3, 0xBA, 0xC3}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeSubtitleText(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeSubtitleText() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("DecodeSubtitleText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}